@@ -0,0 +1,357 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/otiai10/copy"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+const (
+	// Model config TRTIS reads from a model folder
+	CONFIG_FILENAME = "config.pbtxt"
+	// Marker file in a model folder recording the cache entry it links to
+	CACHE_REF_FILENAME = ".trtis-cache-ref"
+
+	treesDir = "trees"
+	refsDir  = "refs"
+	lockFile = ".lock"
+)
+
+var ErrNotCached = errors.New("model was not installed from the model cache")
+
+// Contents of the marker file in a model folder
+type CacheRef struct {
+	Cache string `json:"cache"`
+	Hash  string `json:"hash"`
+	Model string `json:"model"`
+}
+
+// Read the cache entry a model folder links to. Returns an error satisfying os.IsNotExist if
+// the model was not installed from a cache.
+func ReadRef(modelDir string) (*CacheRef, error) {
+	data, err := ioutil.ReadFile(filepath.Join(modelDir, CACHE_REF_FILENAME))
+	if err != nil {
+		return nil, err
+	}
+	ref := &CacheRef{}
+	if err := json.Unmarshal(data, ref); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// Content addressed cache of model trees on a node.
+// Model folders in the TRTIS repository are link farms into a cached tree and each model
+// folder holds a reference to the tree so it is only deleted when no models use it.
+// The loader installs models through the cache, the proxy and monitor remove them.
+type ModelCache struct {
+	root string
+	log  logr.Logger
+}
+
+func NewModelCache(root string, log logr.Logger) (*ModelCache, error) {
+	for _, dir := range []string{treesDir, refsDir} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &ModelCache{
+		root: root,
+		log:  log.WithName("ModelCache"),
+	}, nil
+}
+
+// Hash the files in a model tree. The top level model config and marker files are excluded as they
+// are written for each deployment.
+func HashTree(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || rel == CONFIG_FILENAME || rel == CACHE_REF_FILENAME || rel == OWNER_FILENAME {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), info.Size())
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Hold an exclusive lock on the cache while running fn. The lock is shared with the
+// other processes on the node using the cache.
+func (c *ModelCache) withLock(fn func() error) error {
+	f, err := os.OpenFile(filepath.Join(c.root, lockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return fn()
+}
+
+// Install a staged model into the model repository as a link farm into the cache.
+// The link farm is built beside the model folder and swapped in, see relink.
+func (c *ModelCache) Install(stagedModel, modelRepo, modelName string) error {
+	hash, err := HashTree(stagedModel)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(modelRepo, modelName)
+	tree := filepath.Join(c.root, treesDir, hash)
+	return c.withLock(func() error {
+		if _, err := os.Stat(tree); os.IsNotExist(err) {
+			c.log.Info("Adding model to cache", "hash", hash)
+			tmp, err := ioutil.TempDir(filepath.Join(c.root, treesDir), ".tmp-")
+			if err != nil {
+				return err
+			}
+			if err := copy.Copy(stagedModel, tmp); err != nil {
+				os.RemoveAll(tmp)
+				return err
+			}
+			if err := c.addTree(tmp, hash); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else {
+			c.log.Info("Found model in cache", "hash", hash)
+		}
+		return c.relink(hash, modelName, dst, filepath.Join(stagedModel, CONFIG_FILENAME))
+	})
+}
+
+// Add a version folder from a staged model to a model already in the repository. The model's
+// versions and the new one are cached as a new tree and the model folder is relinked to it, so
+// the folder is never written in place and other models sharing the old tree are untouched.
+func (c *ModelCache) InstallVersion(stagedModel, modelRepo, modelName string, version int64) error {
+	name := strconv.FormatInt(version, 10)
+	dst := filepath.Join(modelRepo, modelName)
+	return c.withLock(func() error {
+		if _, err := os.Stat(filepath.Join(dst, name)); err == nil {
+			return fmt.Errorf("version %d of model %s already exists", version, modelName)
+		}
+		tmp, err := ioutil.TempDir(filepath.Join(c.root, treesDir), ".tmp-")
+		if err != nil {
+			return err
+		}
+		// The versions being served are linked into the new tree if the model was installed
+		// from a cache, and otherwise copied
+		if _, err = ReadRef(dst); err == nil {
+			err = linkTree(dst, tmp)
+		} else {
+			err = copy.Copy(dst, tmp)
+		}
+		if err == nil {
+			err = copy.Copy(filepath.Join(stagedModel, name), filepath.Join(tmp, name))
+		}
+		if err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+		hash, err := HashTree(tmp)
+		if err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(c.root, treesDir, hash)); err == nil {
+			os.RemoveAll(tmp)
+		} else if err := c.addTree(tmp, hash); err != nil {
+			return err
+		}
+		c.log.Info("Adding model version to cache", "model", modelName, "version", version, "hash", hash)
+		return c.relink(hash, modelName, dst, filepath.Join(stagedModel, CONFIG_FILENAME))
+	})
+}
+
+// Move a prepared tree into the cache under its hash. The config and marker files are
+// left out as they belong to the model folders linking to the tree.
+func (c *ModelCache) addTree(tmp, hash string) error {
+	for _, name := range []string{CONFIG_FILENAME, CACHE_REF_FILENAME, OWNER_FILENAME} {
+		os.Remove(filepath.Join(tmp, name))
+	}
+	if err := os.Rename(tmp, filepath.Join(c.root, treesDir, hash)); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return nil
+}
+
+// Point a model folder at a cached tree. A complete link farm with the config, the reference and
+// the owner of the current folder is built in a hidden folder beside it and swapped with the model
+// folder in one rename, so TRTIS only ever sees the old or the new model. The reference the old
+// folder held is then released. Must be called with the cache lock held.
+func (c *ModelCache) relink(hash, modelName, dst, configFile string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dst), "."+modelName+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := linkTree(filepath.Join(c.root, treesDir, hash), tmp); err != nil {
+		return err
+	}
+	if err := c.addRef(hash, modelName, dst); err != nil {
+		return err
+	}
+	if err := writeRef(tmp, &CacheRef{Cache: c.root, Hash: hash, Model: modelName}); err != nil {
+		return err
+	}
+	if owner, err := ioutil.ReadFile(filepath.Join(dst, OWNER_FILENAME)); err == nil {
+		if err := ioutil.WriteFile(filepath.Join(tmp, OWNER_FILENAME), owner, 0644); err != nil {
+			return err
+		}
+	}
+	if err := copy.Copy(configFile, filepath.Join(tmp, CONFIG_FILENAME)); err != nil {
+		return err
+	}
+
+	old, err := ReadRef(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		return os.Rename(tmp, dst)
+	}
+	// The old folder is left at tmp and removed on return
+	if err := swapDirs(tmp, dst); err != nil {
+		return err
+	}
+	if old == nil || (old.Cache == c.root && old.Hash == hash) {
+		return nil
+	}
+	if old.Cache == c.root {
+		return c.releaseRef(old)
+	}
+	other, err := NewModelCache(old.Cache, c.log)
+	if err != nil {
+		return err
+	}
+	return other.withLock(func() error {
+		return other.releaseRef(old)
+	})
+}
+
+// Put back a model folder that has gone missing as a link farm into the tree it referenced.
+// Returns ErrNotCached if the tree has since been removed from the cache.
+func (c *ModelCache) Restore(ref *CacheRef, modelDir string) error {
+	tree := filepath.Join(c.root, treesDir, ref.Hash)
+	return c.withLock(func() error {
+		if _, err := os.Stat(tree); os.IsNotExist(err) {
+			return ErrNotCached
+		} else if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(modelDir); err != nil {
+			return err
+		}
+		if err := linkTree(tree, modelDir); err != nil {
+			return err
+		}
+		if err := c.addRef(ref.Hash, ref.Model, modelDir); err != nil {
+			return err
+		}
+		return writeRef(modelDir, ref)
+	})
+}
+
+// Record that a model folder links to a cached tree
+func (c *ModelCache) addRef(hash, modelName, modelDir string) error {
+	refDir := filepath.Join(c.root, refsDir, hash)
+	if err := os.MkdirAll(refDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(refDir, modelName), []byte(modelDir), 0644)
+}
+
+// Write the marker recording the cached tree a model folder links to
+func writeRef(modelDir string, ref *CacheRef) error {
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(modelDir, CACHE_REF_FILENAME), data, 0644)
+}
+
+// Drop a model folder's reference to a cached tree, deleting the tree if no other models reference it.
+// Must be called with the lock of the cache the reference is in held.
+func (c *ModelCache) releaseRef(ref *CacheRef) error {
+	refDir := filepath.Join(ref.Cache, refsDir, ref.Hash)
+	if err := os.Remove(filepath.Join(refDir, ref.Model)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	refs, err := ioutil.ReadDir(refDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(refs) == 0 {
+		c.log.Info("Removing unreferenced model from cache", "hash", ref.Hash)
+		if err := os.RemoveAll(filepath.Join(ref.Cache, treesDir, ref.Hash)); err != nil {
+			return err
+		}
+		return os.RemoveAll(refDir)
+	}
+	return nil
+}
+
+// Remove a model folder and its reference, deleting the cached tree if no other models reference it.
+// Must be called with the cache lock held.
+func (c *ModelCache) removeModelLocked(modelDir string) error {
+	ref, err := ReadRef(modelDir)
+	if os.IsNotExist(err) {
+		return os.RemoveAll(modelDir)
+	} else if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(modelDir); err != nil {
+		return err
+	}
+	return c.releaseRef(ref)
+}
+
+// Remove a model folder from the model repository. If the model was installed from a model cache
+// its reference is released and the cached tree deleted once no model folders reference it.
+func RemoveModel(modelDir string, log logr.Logger) error {
+	ref, err := ReadRef(modelDir)
+	if os.IsNotExist(err) {
+		return os.RemoveAll(modelDir)
+	} else if err != nil {
+		return err
+	}
+	c, err := NewModelCache(ref.Cache, log)
+	if err != nil {
+		return err
+	}
+	return c.withLock(func() error {
+		return c.removeModelLocked(modelDir)
+	})
+}
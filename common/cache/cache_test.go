@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"testing"
+)
+
+func stageModel(g *gomega.GomegaWithT, dir, name, configData string) string {
+	model := filepath.Join(dir, name)
+	g.Expect(os.MkdirAll(filepath.Join(model, "1"), 0755)).Should(gomega.BeNil())
+	g.Expect(ioutil.WriteFile(filepath.Join(model, "1", "model.graphdef"), []byte("graph"), 0644)).Should(gomega.BeNil())
+	g.Expect(ioutil.WriteFile(filepath.Join(model, CONFIG_FILENAME), []byte(configData), 0644)).Should(gomega.BeNil())
+	return model
+}
+
+func TestCacheSharedBetweenModels(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	root, err := ioutil.TempDir("", "cache")
+	g.Expect(err).Should(gomega.BeNil())
+	defer os.RemoveAll(root)
+	staging := filepath.Join(root, "staging")
+	repo := filepath.Join(root, "repo")
+	cache, err := NewModelCache(filepath.Join(root, "cache"), logf.Log)
+	g.Expect(err).Should(gomega.BeNil())
+
+	g.Expect(cache.Install(stageModel(g, staging, "a", `name: "a"`), repo, "a")).Should(gomega.BeNil())
+	g.Expect(cache.Install(stageModel(g, staging, "b", `name: "b"`), repo, "b")).Should(gomega.BeNil())
+
+	// Both models link to the same cached file but keep their own config
+	infoA, err := os.Stat(filepath.Join(repo, "a", "1", "model.graphdef"))
+	g.Expect(err).Should(gomega.BeNil())
+	infoB, err := os.Stat(filepath.Join(repo, "b", "1", "model.graphdef"))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(os.SameFile(infoA, infoB)).Should(gomega.BeTrue())
+	data, err := ioutil.ReadFile(filepath.Join(repo, "b", CONFIG_FILENAME))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(string(data)).Should(gomega.Equal(`name: "b"`))
+
+	trees, err := ioutil.ReadDir(filepath.Join(root, "cache", treesDir))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(trees).Should(gomega.HaveLen(1))
+
+	// The cached tree is only removed once both models are removed
+	g.Expect(RemoveModel(filepath.Join(repo, "a"), logf.Log)).Should(gomega.BeNil())
+	trees, _ = ioutil.ReadDir(filepath.Join(root, "cache", treesDir))
+	g.Expect(trees).Should(gomega.HaveLen(1))
+	g.Expect(RemoveModel(filepath.Join(repo, "b"), logf.Log)).Should(gomega.BeNil())
+	trees, _ = ioutil.ReadDir(filepath.Join(root, "cache", treesDir))
+	g.Expect(trees).Should(gomega.HaveLen(0))
+	_, err = os.Stat(filepath.Join(repo, "b"))
+	g.Expect(os.IsNotExist(err)).Should(gomega.BeTrue())
+}
+
+func TestInstallVersionRelinksModel(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	root, err := ioutil.TempDir("", "cache")
+	g.Expect(err).Should(gomega.BeNil())
+	defer os.RemoveAll(root)
+	staging := filepath.Join(root, "staging")
+	repo := filepath.Join(root, "repo")
+	cache, err := NewModelCache(filepath.Join(root, "cache"), logf.Log)
+	g.Expect(err).Should(gomega.BeNil())
+
+	g.Expect(cache.Install(stageModel(g, staging, "a", `name: "a"`), repo, "a")).Should(gomega.BeNil())
+	g.Expect(cache.Install(stageModel(g, staging, "b", `name: "b"`), repo, "b")).Should(gomega.BeNil())
+	owner := &ModelOwner{Namespace: "default", Pod: "a-1", UID: "uid-1"}
+	g.Expect(owner.Write(filepath.Join(repo, "a"))).Should(gomega.BeNil())
+	before, err := ReadRef(filepath.Join(repo, "a"))
+	g.Expect(err).Should(gomega.BeNil())
+
+	staged := filepath.Join(staging, "a2")
+	g.Expect(os.MkdirAll(filepath.Join(staged, "2"), 0755)).Should(gomega.BeNil())
+	g.Expect(ioutil.WriteFile(filepath.Join(staged, "2", "model.graphdef"), []byte("graph v2"), 0644)).Should(gomega.BeNil())
+	g.Expect(ioutil.WriteFile(filepath.Join(staged, CONFIG_FILENAME), []byte(`name: "a" version_policy: { all { }}`), 0644)).Should(gomega.BeNil())
+	g.Expect(cache.InstallVersion(staged, repo, "a", 2)).Should(gomega.BeNil())
+	g.Expect(cache.InstallVersion(staged, repo, "a", 2)).ShouldNot(gomega.BeNil())
+
+	// The model links to a new tree with both versions, keeping its owner, and b still links to the old tree
+	after, err := ReadRef(filepath.Join(repo, "a"))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(after.Hash).ShouldNot(gomega.Equal(before.Hash))
+	data, err := ioutil.ReadFile(filepath.Join(repo, "a", "2", "model.graphdef"))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(string(data)).Should(gomega.Equal("graph v2"))
+	data, err = ioutil.ReadFile(filepath.Join(repo, "a", CONFIG_FILENAME))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(string(data)).Should(gomega.ContainSubstring("version_policy"))
+	readOwner, err := ReadOwner(filepath.Join(repo, "a"))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(readOwner).Should(gomega.Equal(owner))
+	infoA, err := os.Stat(filepath.Join(repo, "a", "1", "model.graphdef"))
+	g.Expect(err).Should(gomega.BeNil())
+	infoB, err := os.Stat(filepath.Join(repo, "b", "1", "model.graphdef"))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(os.SameFile(infoA, infoB)).Should(gomega.BeTrue())
+	_, err = os.Stat(filepath.Join(repo, "b", "2"))
+	g.Expect(os.IsNotExist(err)).Should(gomega.BeTrue())
+	entries, err := ioutil.ReadDir(repo)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(entries).Should(gomega.HaveLen(2))
+
+	trees, err := ioutil.ReadDir(filepath.Join(root, "cache", treesDir))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(trees).Should(gomega.HaveLen(2))
+	g.Expect(RemoveModel(filepath.Join(repo, "b"), logf.Log)).Should(gomega.BeNil())
+	trees, _ = ioutil.ReadDir(filepath.Join(root, "cache", treesDir))
+	g.Expect(trees).Should(gomega.HaveLen(1))
+	g.Expect(trees[0].Name()).Should(gomega.Equal(after.Hash))
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+)
+
+// Recreate the folders of src in dst hard linking each file, falling back to relative symlinks
+// if src and dst are on different file systems. Symlinks in src, such as those of a link farm
+// on another file system than its cache, are linked to the file they point at.
+func linkTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if p, err = filepath.EvalSymlinks(p); err != nil {
+				return err
+			}
+		}
+		if err := os.Link(p, target); err != nil {
+			relLink, rerr := filepath.Rel(filepath.Dir(target), p)
+			if rerr != nil {
+				return err
+			}
+			return os.Symlink(relLink, target)
+		}
+		return nil
+	})
+}
+
+// Exchange two folders in one rename so the folder at b is replaced without a moment where it is
+// missing. File systems without RENAME_EXCHANGE, such as NFS, fall back to two renames.
+func swapDirs(a, b string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+	if err != unix.EINVAL && err != unix.ENOSYS && err != unix.EOPNOTSUPP {
+		return err
+	}
+	moved := a + ".old"
+	if err := os.Rename(b, moved); err != nil {
+		return err
+	}
+	if err := os.Rename(a, b); err != nil {
+		os.Rename(moved, b)
+		return err
+	}
+	return os.Rename(moved, a)
+}
@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Marker file in a model folder recording the pod the model was installed for
+const OWNER_FILENAME = ".trtis-owner"
+
+// Contents of the ownership marker file
+type ModelOwner struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	UID       string `json:"uid"`
+}
+
+// Read the owner of a model folder. Returns an error satisfying os.IsNotExist if it has no owner.
+func ReadOwner(modelDir string) (*ModelOwner, error) {
+	data, err := ioutil.ReadFile(filepath.Join(modelDir, OWNER_FILENAME))
+	if err != nil {
+		return nil, err
+	}
+	owner := &ModelOwner{}
+	if err := json.Unmarshal(data, owner); err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+// Record the pod as the owner of an installed model so the model can be removed if the pod goes away
+func (o *ModelOwner) Write(modelDir string) error {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(modelDir, OWNER_FILENAME), data, 0644)
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sync"
+	"time"
+)
+
+const FLUSH_POLL_INTERVAL = 10 * time.Millisecond
+
+// Records events through a broadcaster like the Kubernetes components do. Repeated events are
+// counted on one event and each object's events are rate limited so a failure repeating in a loop
+// cannot flood the API server.
+type Recorder struct {
+	recorder    record.EventRecorder
+	broadcaster record.EventBroadcaster
+	mu          sync.Mutex
+	recorded    int
+	written     int
+}
+
+func NewEventRecorder(events typedcorev1.EventInterface, source v1.EventSource) *Recorder {
+	r := &Recorder{broadcaster: record.NewBroadcaster()}
+	r.broadcaster.StartRecordingToSink(&countingSink{EventSink: &typedcorev1.EventSinkImpl{Interface: events}, recorder: r})
+	r.recorder = r.broadcaster.NewRecorder(scheme.Scheme, source)
+	return r
+}
+
+func (r *Recorder) Event(object runtime.Object, eventType, reason, message string) {
+	r.count(&r.recorded)
+	r.recorder.Event(object, eventType, reason, message)
+}
+
+func (r *Recorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	r.count(&r.recorded)
+	r.recorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+func (r *Recorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventType, reason, messageFmt string, args ...interface{}) {
+	r.count(&r.recorded)
+	r.recorder.PastEventf(object, timestamp, eventType, reason, messageFmt, args...)
+}
+
+func (r *Recorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventType, reason, messageFmt string, args ...interface{}) {
+	r.count(&r.recorded)
+	r.recorder.AnnotatedEventf(object, annotations, eventType, reason, messageFmt, args...)
+}
+
+func (r *Recorder) count(n *int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*n++
+}
+
+func (r *Recorder) pending() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.written < r.recorded
+}
+
+// Wait up to timeout for the events recorded so far to be written then stop recording, for components
+// about to exit. Events dropped by the rate limit are never written so hold it up until the timeout.
+func (r *Recorder) Flush(timeout time.Duration) {
+	wait.PollImmediate(FLUSH_POLL_INTERVAL, timeout, func() (bool, error) {
+		return !r.pending(), nil
+	})
+	r.broadcaster.Shutdown()
+}
+
+var _ record.EventRecorder = &Recorder{}
+
+// Counts the events written so Flush knows when none are left
+type countingSink struct {
+	record.EventSink
+	recorder *Recorder
+}
+
+func (s *countingSink) Create(event *v1.Event) (*v1.Event, error) {
+	defer s.recorder.count(&s.recorder.written)
+	return s.EventSink.Create(event)
+}
+
+func (s *countingSink) Update(event *v1.Event) (*v1.Event, error) {
+	defer s.recorder.count(&s.recorder.written)
+	return s.EventSink.Update(event)
+}
+
+func (s *countingSink) Patch(event *v1.Event, data []byte) (*v1.Event, error) {
+	defer s.recorder.count(&s.recorder.written)
+	return s.EventSink.Patch(event, data)
+}
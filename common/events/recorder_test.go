@@ -0,0 +1,27 @@
+package events
+
+import (
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func TestFlushWaitsForRecordedEvents(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	clientset := fake.NewSimpleClientset()
+	recorder := NewEventRecorder(clientset.CoreV1().Events("default"), v1.EventSource{Component: "test"})
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"}}
+
+	recorder.Event(pod, v1.EventTypeNormal, "Loaded", "first")
+	recorder.Eventf(pod, v1.EventTypeWarning, "Failed", "%s", "second")
+	start := time.Now()
+	recorder.Flush(10 * time.Second)
+	g.Expect(time.Since(start)).Should(gomega.BeNumerically("<", 5*time.Second))
+
+	events, err := clientset.CoreV1().Events("default").List(metav1.ListOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(events.Items).Should(gomega.HaveLen(2))
+}
@@ -0,0 +1,16 @@
+module github.com/seldonio/trtis-scheduler/common
+
+go 1.12
+
+require (
+	github.com/go-logr/logr v0.1.0
+	github.com/golang/protobuf v1.3.2
+	github.com/onsi/gomega v1.7.0
+	github.com/otiai10/copy v1.0.2
+	golang.org/x/sys v0.0.0-20190826190057-c7b8b68b1456
+	google.golang.org/grpc v1.26.0
+	k8s.io/api v0.17.0
+	k8s.io/apimachinery v0.17.0
+	k8s.io/client-go v0.17.0
+	sigs.k8s.io/controller-runtime v0.4.0
+)
@@ -0,0 +1,16 @@
+// Package v1alpha1 contains the TrtisModel API of the machinelearning.seldon.io group
+// +groupName=machinelearning.seldon.io
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	GroupVersion = schema.GroupVersion{Group: "machinelearning.seldon.io", Version: "v1alpha1"}
+
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	AddToScheme = SchemeBuilder.AddToScheme
+)
@@ -0,0 +1,90 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// How the model is shared with other TrtisModels on a TRTIS server
+type IsolationMode string
+
+const (
+	// The model keeps its name on the server, so TrtisModels of the same model are never
+	// placed on the same node
+	IsolationShared IsolationMode = "Shared"
+	// The loader prefixes the model name with the namespace and deployment, so each TrtisModel
+	// loads its own copy of the model
+	IsolationUnique IsolationMode = "Unique"
+)
+
+// Overrides of the dynamic batching settings in the model config
+type Batching struct {
+	MaxBatchSize        *int32  `json:"maxBatchSize,omitempty"`
+	PreferredBatchSizes []int32 `json:"preferredBatchSizes,omitempty"`
+	MaxQueueDelayUs     *int64  `json:"maxQueueDelayUs,omitempty"`
+}
+
+type TrtisModelSpec struct {
+	// Uri of the model: gs://, s3://, https:// (tar or zip archive) or file://
+	ModelUri string `json:"modelUri"`
+	// Optional checksum of a model archive as <sha256|md5>:<hex digest>
+	ModelChecksum string `json:"modelChecksum,omitempty"`
+	// Name of the model on the TRTIS server, defaults to the last part of the model uri
+	ModelName string `json:"modelName,omitempty"`
+	// GPU memory the model needs on a node
+	GpuMemory resource.Quantity `json:"gpuMemory"`
+	// Number of replicas, defaults to 1
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Replicas that may be unavailable during voluntary disruptions, defaults to 1
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	Batching       *Batching           `json:"batching,omitempty"`
+	// Shared or Unique, defaults to Shared
+	Isolation IsolationMode `json:"isolation,omitempty"`
+}
+
+// State of one replica of the model
+type ReplicaStatus struct {
+	Pod  string `json:"pod"`
+	Node string `json:"node,omitempty"`
+	// GPU memory requested by the replica
+	GpuMemory string `json:"gpuMemory,omitempty"`
+	// GPU memory used and in total on the node as reported by the node's monitor
+	NodeGpuMemoryUsed  string `json:"nodeGpuMemoryUsed,omitempty"`
+	NodeGpuMemoryTotal string `json:"nodeGpuMemoryTotal,omitempty"`
+	Ready              bool   `json:"ready"`
+	// Progress of the loader and why the replica is not ready
+	LoaderPhase string `json:"loaderPhase,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+type TrtisModelStatus struct {
+	ObservedGeneration int64           `json:"observedGeneration,omitempty"`
+	Replicas           int32           `json:"replicas"`
+	ReadyReplicas      int32           `json:"readyReplicas"`
+	ReplicaStatuses    []ReplicaStatus `json:"replicaStatuses,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// A model served by TRTIS on the nodes the trtis-scheduler places its replicas on
+type TrtisModel struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TrtisModelSpec   `json:"spec,omitempty"`
+	Status TrtisModelStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+type TrtisModelList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TrtisModel `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TrtisModel{}, &TrtisModelList{})
+}
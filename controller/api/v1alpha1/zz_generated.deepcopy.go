@@ -0,0 +1,163 @@
+// Deep copy functions for the TrtisModel types, in the form controller-gen generates them
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Batching) DeepCopyInto(out *Batching) {
+	*out = *in
+	if in.MaxBatchSize != nil {
+		in, out := &in.MaxBatchSize, &out.MaxBatchSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PreferredBatchSizes != nil {
+		in, out := &in.PreferredBatchSizes, &out.PreferredBatchSizes
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxQueueDelayUs != nil {
+		in, out := &in.MaxQueueDelayUs, &out.MaxQueueDelayUs
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Batching.
+func (in *Batching) DeepCopy() *Batching {
+	if in == nil {
+		return nil
+	}
+	out := new(Batching)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicaStatus) DeepCopyInto(out *ReplicaStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicaStatus.
+func (in *ReplicaStatus) DeepCopy() *ReplicaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrtisModel) DeepCopyInto(out *TrtisModel) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrtisModel.
+func (in *TrtisModel) DeepCopy() *TrtisModel {
+	if in == nil {
+		return nil
+	}
+	out := new(TrtisModel)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TrtisModel) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrtisModelList) DeepCopyInto(out *TrtisModelList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TrtisModel, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrtisModelList.
+func (in *TrtisModelList) DeepCopy() *TrtisModelList {
+	if in == nil {
+		return nil
+	}
+	out := new(TrtisModelList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TrtisModelList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrtisModelSpec) DeepCopyInto(out *TrtisModelSpec) {
+	*out = *in
+	out.GpuMemory = in.GpuMemory.DeepCopy()
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.Batching != nil {
+		in, out := &in.Batching, &out.Batching
+		*out = new(Batching)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrtisModelSpec.
+func (in *TrtisModelSpec) DeepCopy() *TrtisModelSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TrtisModelSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrtisModelStatus) DeepCopyInto(out *TrtisModelStatus) {
+	*out = *in
+	if in.ReplicaStatuses != nil {
+		in, out := &in.ReplicaStatuses, &out.ReplicaStatuses
+		*out = make([]ReplicaStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrtisModelStatus.
+func (in *TrtisModelStatus) DeepCopy() *TrtisModelStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TrtisModelStatus)
+	in.DeepCopyInto(out)
+	return out
+}
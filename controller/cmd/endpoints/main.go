@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"github.com/seldonio/trtis-scheduler/controller/endpoints"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"os"
+	"os/signal"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"syscall"
+	"time"
+)
+
+var (
+	trtisHttpPort  = flag.Int("trtis-http-port", 8000, "TRTIS http port published on each node")
+	trtisGrpcPort  = flag.Int("trtis-grpc-port", 8001, "TRTIS grpc port published on each node")
+	endpointSlices = flag.Bool("endpoint-slices", false, "Also keep an EndpointSlice for each model")
+	namespace      = flag.String("namespace", "", "Namespace to watch model pods in, empty for all namespaces")
+	workers        = flag.Int("workers", 2, "Number of models synced concurrently")
+	resyncPeriod   = flag.Duration("resync-period", 10*time.Minute, "Interval at which all models are synced again")
+)
+
+func main() {
+	flag.Parse()
+
+	logf.SetLogger(logf.ZapLogger(false))
+	log := logf.Log.WithName("endpoints")
+	log.Info("Started")
+
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.Error(err, "Failed to get in cluster config")
+		os.Exit(1)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Error(err, "Failed to create k8s client")
+		os.Exit(1)
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, *resyncPeriod, informers.WithNamespace(*namespace))
+	controller := endpoints.NewController(client, factory.Core().V1().Pods(), endpoints.Options{
+		Ports: endpoints.Ports{
+			Http: int32(*trtisHttpPort),
+			Grpc: int32(*trtisGrpcPort),
+		},
+		EndpointSlices: *endpointSlices,
+		Namespace:      *namespace,
+	}, log)
+
+	stop := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-sigs
+		log.Info("Stopping")
+		close(stop)
+	}()
+
+	factory.Start(stop)
+	if err := controller.Run(*workers, stop); err != nil {
+		log.Error(err, "Failed to run controller")
+		os.Exit(1)
+	}
+}
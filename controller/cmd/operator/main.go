@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"github.com/seldonio/trtis-scheduler/controller/api/v1alpha1"
+	"github.com/seldonio/trtis-scheduler/controller/operator"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"os"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+var (
+	loaderImage          = flag.String("loader-image", "seldonio/trtis-loader:0.1", "Image of the loader init container")
+	proxyImage           = flag.String("proxy-image", "seldonio/trtis-proxy:0.1", "Image of the proxy container")
+	schedulerName        = flag.String("scheduler-name", "trtis-scheduler", "Scheduler placing model pods")
+	serviceAccountName   = flag.String("model-service-account", "trtis-model", "Service account model pods run as, it must be able to get and patch the pod and create events")
+	modelRepoClaim       = flag.String("model-repo-claim", "nfs-pvc", "Claim of the volume holding the TRTIS model repository of each node")
+	modelRepoMountPath   = flag.String("model-repo-mount-path", "/trtis", "Where the model repository volume is mounted in model pods")
+	metricsAddr          = flag.String("metrics-addr", ":8080", "The address the metric endpoint binds to")
+	enableLeaderElection = flag.Bool("enable-leader-election", false, "Elect a leader so only one operator reconciles at a time")
+)
+
+func main() {
+	flag.Parse()
+
+	logf.SetLogger(logf.ZapLogger(false))
+	log := logf.Log.WithName("operator")
+	log.Info("Started")
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		log.Error(err, "Failed to add client-go types to scheme")
+		os.Exit(1)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		log.Error(err, "Failed to add TrtisModel types to scheme")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:             scheme,
+		MetricsBindAddress: *metricsAddr,
+		LeaderElection:     *enableLeaderElection,
+		LeaderElectionID:   "trtis-operator",
+	})
+	if err != nil {
+		log.Error(err, "Failed to create manager")
+		os.Exit(1)
+	}
+
+	reconciler := &operator.TrtisModelReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Options: operator.Options{
+			LoaderImage:        *loaderImage,
+			ProxyImage:         *proxyImage,
+			SchedulerName:      *schedulerName,
+			ServiceAccountName: *serviceAccountName,
+			ModelRepoClaim:     *modelRepoClaim,
+			ModelRepoMountPath: *modelRepoMountPath,
+		},
+		Log: log,
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		log.Error(err, "Failed to create controller")
+		os.Exit(1)
+	}
+
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		log.Error(err, "Failed to run manager")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"github.com/seldonio/trtis-scheduler/controller/inject"
+	"github.com/seldonio/trtis-scheduler/controller/operator"
+	"github.com/seldonio/trtis-scheduler/controller/validate"
+	"os"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var (
+	port               = flag.Int("port", 9443, "Port the webhook server listens on")
+	certDir            = flag.String("cert-dir", "/tmp/k8s-webhook-server/serving-certs", "Folder holding the server tls.crt and tls.key")
+	metricsAddr        = flag.String("metrics-addr", ":8080", "The address the metric endpoint binds to")
+	loaderImage        = flag.String("loader-image", "seldonio/trtis-loader:0.1", "Image of the injected loader init container")
+	proxyImage         = flag.String("proxy-image", "seldonio/trtis-proxy:0.1", "Image of the injected proxy container")
+	schedulerName      = flag.String("scheduler-name", "trtis-scheduler", "Scheduler set on model pods and whose pods are validated")
+	modelRepoClaim     = flag.String("model-repo-claim", "nfs-pvc", "Claim of the volume holding the TRTIS model repository of each node")
+	modelRepoMountPath = flag.String("model-repo-mount-path", "/trtis", "Where the model repository volume is mounted in model pods")
+)
+
+func main() {
+	flag.Parse()
+
+	logf.SetLogger(logf.ZapLogger(false))
+	log := logf.Log.WithName("webhook")
+	log.Info("Started")
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		MetricsBindAddress: *metricsAddr,
+		Port:               *port,
+		CertDir:            *certDir,
+	})
+	if err != nil {
+		log.Error(err, "Failed to create manager")
+		os.Exit(1)
+	}
+
+	options := &operator.Options{
+		LoaderImage:        *loaderImage,
+		ProxyImage:         *proxyImage,
+		SchedulerName:      *schedulerName,
+		ModelRepoClaim:     *modelRepoClaim,
+		ModelRepoMountPath: *modelRepoMountPath,
+	}
+	server := mgr.GetWebhookServer()
+	server.Register(inject.WEBHOOK_PATH, &webhook.Admission{Handler: &inject.PodInjector{Options: options, Log: log}})
+	server.Register(validate.WEBHOOK_PATH, &webhook.Admission{Handler: &validate.PodValidator{
+		Client:        mgr.GetClient(),
+		SchedulerName: *schedulerName,
+		Log:           log,
+	}})
+
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		log.Error(err, "Failed to run manager")
+		os.Exit(1)
+	}
+}
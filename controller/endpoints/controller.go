@@ -0,0 +1,276 @@
+package endpoints
+
+import (
+	"fmt"
+	"github.com/go-logr/logr"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"strings"
+	"time"
+)
+
+const MAX_RETRIES = 5
+
+type Options struct {
+	Ports Ports
+	// Also keep an EndpointSlice for each model
+	EndpointSlices bool
+	// Namespace the pod informer watches, empty for all namespaces
+	Namespace string
+}
+
+// Keeps a headless Service and Endpoints for each model, listing the TRTIS ports on the
+// nodes where the model is loaded, so clients can call TRTIS directly without the proxy.
+// Models are found from the model ID annotation of their pods and keyed by namespace/model ID.
+type Controller struct {
+	client     kubernetes.Interface
+	podLister  corelisters.PodLister
+	podsSynced cache.InformerSynced
+	queue      workqueue.RateLimitingInterface
+	options    Options
+	log        logr.Logger
+}
+
+func NewController(client kubernetes.Interface, podInformer coreinformers.PodInformer, options Options, log logr.Logger) *Controller {
+	c := &Controller{
+		client:     client,
+		podLister:  podInformer.Lister(),
+		podsSynced: podInformer.Informer().HasSynced,
+		queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), CONTROLLER_NAME),
+		options:    options,
+		log:        log.WithName("EndpointsController"),
+	}
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueuePod,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.enqueuePod(oldObj)
+			c.enqueuePod(newObj)
+		},
+		DeleteFunc: c.enqueuePod,
+	})
+	return c
+}
+
+func modelKey(namespace, modelId string) string {
+	return namespace + "/" + modelId
+}
+
+// Model IDs may contain a slash but namespaces can not
+func splitModelKey(key string) (string, string) {
+	parts := strings.SplitN(key, "/", 2)
+	return parts[0], parts[1]
+}
+
+func (c *Controller) enqueuePod(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	if modelId := pod.Annotations[ANNOTATION_MODEL_ID]; modelId != "" {
+		c.queue.Add(modelKey(pod.Namespace, modelId))
+	}
+}
+
+// Queue the models of Services left from before the controller started so those whose pods
+// have all gone are removed
+func (c *Controller) enqueueManagedServices() error {
+	services, err := c.client.CoreV1().Services(c.options.Namespace).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{LABEL_MANAGED_BY: CONTROLLER_NAME}).String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, service := range services.Items {
+		if modelId := service.Annotations[ANNOTATION_MODEL_ID]; modelId != "" {
+			c.queue.Add(modelKey(service.Namespace, modelId))
+		}
+	}
+	return nil
+}
+
+// Reconcile models with workers until stop is closed
+func (c *Controller) Run(workers int, stop <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	c.log.Info("Waiting for pod cache to sync")
+	if !cache.WaitForCacheSync(stop, c.podsSynced) {
+		return fmt.Errorf("failed to sync pod cache")
+	}
+	if err := c.enqueueManagedServices(); err != nil {
+		c.log.Error(err, "Failed to list model services")
+	}
+	c.log.Info("Starting workers", "workers", workers)
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stop)
+	}
+	<-stop
+	c.log.Info("Stopping workers")
+	return nil
+}
+
+func (c *Controller) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+func (c *Controller) processNextItem() bool {
+	item, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(item)
+	key := item.(string)
+	err := c.sync(key)
+	if err == nil {
+		c.queue.Forget(item)
+	} else if c.queue.NumRequeues(item) < MAX_RETRIES {
+		c.log.Error(err, "Failed to sync model endpoints, retrying", "model", key)
+		c.queue.AddRateLimited(item)
+	} else {
+		c.log.Error(err, "Failed to sync model endpoints, dropping until the next change", "model", key)
+		c.queue.Forget(item)
+	}
+	return true
+}
+
+func (c *Controller) sync(key string) error {
+	namespace, modelId := splitModelKey(key)
+	pods, err := c.podLister.Pods(namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	nodes, claimed := findModelNodes(pods, modelId)
+	if claimed == 0 {
+		return c.deleteService(namespace, modelId)
+	}
+
+	service, err := c.ensureService(buildService(namespace, modelId, c.options.Ports), modelId)
+	if err != nil {
+		return err
+	}
+	if err := c.ensureEndpoints(buildEndpoints(service, modelId, nodes, c.options.Ports, c.options.EndpointSlices), modelId); err != nil {
+		return err
+	}
+	if c.options.EndpointSlices {
+		if err := c.ensureEndpointSlice(service, modelId, nodes); err != nil {
+			return err
+		}
+	}
+	c.log.V(1).Info("Synced model endpoints", "model", key, "ready", len(nodes.ready), "notReady", len(nodes.notReady))
+	return nil
+}
+
+func notManagedError(kind, namespace, name, modelId string) error {
+	return fmt.Errorf("%s %s/%s for model %s exists and is not managed by %s", kind, namespace, name, modelId, CONTROLLER_NAME)
+}
+
+func (c *Controller) ensureService(desired *v1.Service, modelId string) (*v1.Service, error) {
+	services := c.client.CoreV1().Services(desired.Namespace)
+	existing, err := services.Get(desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		c.log.Info("Creating model service", "namespace", desired.Namespace, "name", desired.Name, "model", modelId)
+		return services.Create(desired)
+	} else if err != nil {
+		return nil, err
+	}
+	if !managedFor(existing, modelId) {
+		return nil, notManagedError("Service", existing.Namespace, existing.Name, modelId)
+	}
+	if equality.Semantic.DeepEqual(existing.Spec.Ports, desired.Spec.Ports) {
+		return existing, nil
+	}
+	existing.Spec.Ports = desired.Spec.Ports
+	return services.Update(existing)
+}
+
+func (c *Controller) ensureEndpoints(desired *v1.Endpoints, modelId string) error {
+	endpoints := c.client.CoreV1().Endpoints(desired.Namespace)
+	existing, err := endpoints.Get(desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = endpoints.Create(desired)
+		return err
+	} else if err != nil {
+		return err
+	}
+	if !managedFor(existing, modelId) {
+		return notManagedError("Endpoints", existing.Namespace, existing.Name, modelId)
+	}
+	if equality.Semantic.DeepEqual(existing.Subsets, desired.Subsets) &&
+		equality.Semantic.DeepEqual(existing.OwnerReferences, desired.OwnerReferences) &&
+		existing.Labels[LABEL_SKIP_MIRROR] == desired.Labels[LABEL_SKIP_MIRROR] {
+		return nil
+	}
+	c.log.Info("Updating model endpoints", "namespace", desired.Namespace, "name", desired.Name, "model", modelId,
+		"ready", len(desired.Subsets) > 0 && len(desired.Subsets[0].Addresses) > 0)
+	existing.Subsets = desired.Subsets
+	existing.OwnerReferences = desired.OwnerReferences
+	if skipMirror, ok := desired.Labels[LABEL_SKIP_MIRROR]; ok {
+		existing.Labels[LABEL_SKIP_MIRROR] = skipMirror
+	} else {
+		delete(existing.Labels, LABEL_SKIP_MIRROR)
+	}
+	_, err = endpoints.Update(existing)
+	return err
+}
+
+func (c *Controller) ensureEndpointSlice(service *v1.Service, modelId string, nodes *modelNodes) error {
+	desired := buildEndpointSlice(service, modelId, nodes, c.options.Ports)
+	slices := c.client.DiscoveryV1beta1().EndpointSlices(desired.Namespace)
+	existing, err := slices.Get(desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = slices.Create(desired)
+		return err
+	} else if err != nil {
+		return err
+	}
+	if !managedFor(existing, modelId) {
+		return notManagedError("EndpointSlice", existing.Namespace, existing.Name, modelId)
+	}
+	if equality.Semantic.DeepEqual(existing.Endpoints, desired.Endpoints) &&
+		equality.Semantic.DeepEqual(existing.Ports, desired.Ports) &&
+		equality.Semantic.DeepEqual(existing.OwnerReferences, desired.OwnerReferences) {
+		return nil
+	}
+	existing.Endpoints = desired.Endpoints
+	existing.Ports = desired.Ports
+	existing.OwnerReferences = desired.OwnerReferences
+	_, err = slices.Update(existing)
+	return err
+}
+
+// Remove the Service of a model no pod claims. Its Endpoints and EndpointSlice are owned
+// by the Service and removed with it.
+func (c *Controller) deleteService(namespace, modelId string) error {
+	name := ServiceName(modelId)
+	services := c.client.CoreV1().Services(namespace)
+	existing, err := services.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !managedFor(existing, modelId) {
+		return nil
+	}
+	c.log.Info("Deleting model service", "namespace", namespace, "name", name, "model", modelId)
+	propagation := metav1.DeletePropagationBackground
+	err = services.Delete(name, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package endpoints
+
+import (
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"strings"
+	"testing"
+)
+
+func modelPod(name, modelId, nodeName, hostIp string, ready bool) *v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: map[string]string{ANNOTATION_MODEL_ID: modelId},
+		},
+		Spec: v1.PodSpec{NodeName: nodeName},
+		Status: v1.PodStatus{
+			Phase:      v1.PodRunning,
+			HostIP:     hostIp,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestServiceName(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	g.Expect(ServiceName("simple")).Should(gomega.Equal("trtis-simple"))
+	g.Expect(ServiceName("Resnet50_NetDef")).Should(gomega.HavePrefix("trtis-resnet50-netdef-"))
+
+	// IDs which only differ in characters a Service name can not have get different names
+	g.Expect(ServiceName("resnet50_netdef")).ShouldNot(gomega.Equal(ServiceName("resnet50.netdef")))
+	g.Expect(ServiceName("Simple")).ShouldNot(gomega.Equal(ServiceName("simple")))
+	long := strings.Repeat("m", 70)
+	g.Expect(len(ServiceName(long + "a"))).Should(gomega.BeNumerically("<=", MAX_NAME_LENGTH))
+	g.Expect(ServiceName(long + "a")).ShouldNot(gomega.Equal(ServiceName(long + "b")))
+}
+
+func TestSyncKeepsEndpointsOfReadyNodes(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	podInformer := factory.Core().V1().Pods()
+	c := NewController(client, podInformer, Options{Ports: Ports{Http: 8000, Grpc: 8001}, EndpointSlices: true}, logf.Log)
+
+	pods := podInformer.Informer().GetIndexer()
+	g.Expect(pods.Add(modelPod("a", "simple", "node1", "10.0.0.1", true))).Should(gomega.BeNil())
+	g.Expect(pods.Add(modelPod("b", "simple", "node2", "10.0.0.2", false))).Should(gomega.BeNil())
+	g.Expect(pods.Add(modelPod("c", "resnet", "node3", "10.0.0.3", true))).Should(gomega.BeNil())
+	g.Expect(c.sync("default/simple")).Should(gomega.BeNil())
+
+	service, err := client.CoreV1().Services("default").Get("trtis-simple", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(service.Spec.ClusterIP).Should(gomega.Equal(v1.ClusterIPNone))
+	g.Expect(service.Spec.Selector).Should(gomega.BeEmpty())
+
+	endpoints, err := client.CoreV1().Endpoints("default").Get("trtis-simple", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(endpoints.Subsets).Should(gomega.HaveLen(1))
+	g.Expect(endpoints.Subsets[0].Addresses).Should(gomega.HaveLen(1))
+	g.Expect(endpoints.Subsets[0].Addresses[0].IP).Should(gomega.Equal("10.0.0.1"))
+	g.Expect(endpoints.Subsets[0].NotReadyAddresses).Should(gomega.HaveLen(1))
+	g.Expect(endpoints.Subsets[0].Ports).Should(gomega.HaveLen(2))
+	// The controller keeps the slice so the Endpoints are not mirrored
+	g.Expect(endpoints.Labels[LABEL_SKIP_MIRROR]).Should(gomega.Equal("true"))
+
+	slice, err := client.DiscoveryV1beta1().EndpointSlices("default").Get("trtis-simple", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(slice.Endpoints).Should(gomega.HaveLen(2))
+
+	// The model becomes ready on the second node
+	g.Expect(pods.Update(modelPod("b", "simple", "node2", "10.0.0.2", true))).Should(gomega.BeNil())
+	g.Expect(c.sync("default/simple")).Should(gomega.BeNil())
+	endpoints, err = client.CoreV1().Endpoints("default").Get("trtis-simple", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(endpoints.Subsets[0].Addresses).Should(gomega.HaveLen(2))
+	g.Expect(endpoints.Subsets[0].NotReadyAddresses).Should(gomega.BeEmpty())
+
+	// The Service goes once no pod claims the model
+	g.Expect(pods.Delete(modelPod("a", "simple", "node1", "10.0.0.1", true))).Should(gomega.BeNil())
+	g.Expect(pods.Delete(modelPod("b", "simple", "node2", "10.0.0.2", true))).Should(gomega.BeNil())
+	g.Expect(c.sync("default/simple")).Should(gomega.BeNil())
+	_, err = client.CoreV1().Services("default").Get("trtis-simple", metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).Should(gomega.BeTrue())
+}
+
+func TestSyncLeavesUnmanagedService(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	client := fake.NewSimpleClientset(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "trtis-simple", Namespace: "default"},
+	})
+	factory := informers.NewSharedInformerFactory(client, 0)
+	podInformer := factory.Core().V1().Pods()
+	c := NewController(client, podInformer, Options{Ports: Ports{Http: 8000, Grpc: 8001}}, logf.Log)
+
+	g.Expect(c.sync("default/simple")).Should(gomega.BeNil())
+	_, err := client.CoreV1().Services("default").Get("trtis-simple", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+
+	g.Expect(podInformer.Informer().GetIndexer().Add(modelPod("a", "simple", "node1", "10.0.0.1", true))).Should(gomega.BeNil())
+	g.Expect(c.sync("default/simple")).ShouldNot(gomega.BeNil())
+}
@@ -0,0 +1,205 @@
+package endpoints
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	ANNOTATION_MODEL_ID = "seldon.io/trtis-model-id"
+	LABEL_MANAGED_BY    = "app.kubernetes.io/managed-by"
+	LABEL_HOSTNAME      = "kubernetes.io/hostname"
+	CONTROLLER_NAME     = "trtis-endpoints"
+	SERVICE_PREFIX      = "trtis-"
+	PORT_NAME_HTTP      = "http"
+	PORT_NAME_GRPC      = "grpc"
+	MAX_NAME_LENGTH     = 63
+	// Stops the EndpointSlice mirroring controller copying Endpoints the controller also keeps a slice for
+	LABEL_SKIP_MIRROR = "endpointslice.kubernetes.io/skip-mirror"
+	// Hex digits of the model ID hash added to names which had to be changed
+	NAME_HASH_LENGTH = 8
+)
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// The TRTIS ports published on each node
+type Ports struct {
+	Http int32
+	Grpc int32
+}
+
+// Name of the Service for a model. Model IDs need not be valid DNS labels so characters
+// a Service name can not have are replaced. A name which had to be changed or shortened ends
+// with a hash of the model ID so different IDs do not share a Service.
+func ServiceName(modelId string) string {
+	name := SERVICE_PREFIX + invalidNameChars.ReplaceAllString(strings.ToLower(modelId), "-")
+	if name == SERVICE_PREFIX+modelId && len(name) <= MAX_NAME_LENGTH && !strings.HasSuffix(name, "-") {
+		return name
+	}
+	hash := sha256.Sum256([]byte(modelId))
+	suffix := "-" + hex.EncodeToString(hash[:])[:NAME_HASH_LENGTH]
+	if len(name) > MAX_NAME_LENGTH-len(suffix) {
+		name = name[:MAX_NAME_LENGTH-len(suffix)]
+	}
+	return strings.TrimRight(name, "-") + suffix
+}
+
+// The nodes a model's pods run on, by host IP. A node is ready once a pod there reports the
+// model ready, which the proxy readiness probe does when TRTIS has a version of it loaded.
+type modelNodes struct {
+	ready    map[string]string
+	notReady map[string]string
+}
+
+func podReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Find the nodes of the pods serving a model and how many pods claim it. Pods that have not
+// been given a node yet still claim the model so its Service is kept.
+func findModelNodes(pods []*v1.Pod, modelId string) (*modelNodes, int) {
+	nodes := &modelNodes{ready: map[string]string{}, notReady: map[string]string{}}
+	claimed := 0
+	for _, pod := range pods {
+		if pod.Annotations[ANNOTATION_MODEL_ID] != modelId {
+			continue
+		}
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		claimed++
+		if pod.Status.HostIP == "" {
+			continue
+		}
+		if podReady(pod) && pod.DeletionTimestamp == nil {
+			nodes.ready[pod.Status.HostIP] = pod.Spec.NodeName
+		} else {
+			nodes.notReady[pod.Status.HostIP] = pod.Spec.NodeName
+		}
+	}
+	// Another pod of the model on the node may be ready
+	for ip := range nodes.ready {
+		delete(nodes.notReady, ip)
+	}
+	return nodes, claimed
+}
+
+func sortedIps(addresses map[string]string) []string {
+	ips := make([]string, 0, len(addresses))
+	for ip := range addresses {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func managedMeta(name, namespace, modelId string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:        name,
+		Namespace:   namespace,
+		Labels:      map[string]string{LABEL_MANAGED_BY: CONTROLLER_NAME},
+		Annotations: map[string]string{ANNOTATION_MODEL_ID: modelId},
+	}
+}
+
+// Whether an object was created by this controller for the model
+func managedFor(meta metav1.Object, modelId string) bool {
+	return meta.GetLabels()[LABEL_MANAGED_BY] == CONTROLLER_NAME && meta.GetAnnotations()[ANNOTATION_MODEL_ID] == modelId
+}
+
+func ownedBy(service *v1.Service) []metav1.OwnerReference {
+	return []metav1.OwnerReference{*metav1.NewControllerRef(service, v1.SchemeGroupVersion.WithKind("Service"))}
+}
+
+// A headless Service without a selector, as the TRTIS DaemonSet pods on every node share
+// the same labels. Its endpoints are kept by the controller.
+func buildService(namespace, modelId string, ports Ports) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: managedMeta(ServiceName(modelId), namespace, modelId),
+		Spec: v1.ServiceSpec{
+			ClusterIP: v1.ClusterIPNone,
+			Ports: []v1.ServicePort{
+				{Name: PORT_NAME_HTTP, Protocol: v1.ProtocolTCP, Port: ports.Http},
+				{Name: PORT_NAME_GRPC, Protocol: v1.ProtocolTCP, Port: ports.Grpc},
+			},
+		},
+	}
+}
+
+// Endpoints for the Service. When the controller keeps an EndpointSlice as well the Endpoints
+// are not mirrored into a second slice.
+func buildEndpoints(service *v1.Service, modelId string, nodes *modelNodes, ports Ports, skipMirror bool) *v1.Endpoints {
+	endpoints := &v1.Endpoints{ObjectMeta: managedMeta(service.Name, service.Namespace, modelId)}
+	endpoints.OwnerReferences = ownedBy(service)
+	if skipMirror {
+		endpoints.Labels[LABEL_SKIP_MIRROR] = "true"
+	}
+	if len(nodes.ready) == 0 && len(nodes.notReady) == 0 {
+		return endpoints
+	}
+	address := func(ip string, nodeName string) v1.EndpointAddress {
+		return v1.EndpointAddress{IP: ip, NodeName: &nodeName}
+	}
+	subset := v1.EndpointSubset{
+		Ports: []v1.EndpointPort{
+			{Name: PORT_NAME_HTTP, Protocol: v1.ProtocolTCP, Port: ports.Http},
+			{Name: PORT_NAME_GRPC, Protocol: v1.ProtocolTCP, Port: ports.Grpc},
+		},
+	}
+	for _, ip := range sortedIps(nodes.ready) {
+		subset.Addresses = append(subset.Addresses, address(ip, nodes.ready[ip]))
+	}
+	for _, ip := range sortedIps(nodes.notReady) {
+		subset.NotReadyAddresses = append(subset.NotReadyAddresses, address(ip, nodes.notReady[ip]))
+	}
+	endpoints.Subsets = []v1.EndpointSubset{subset}
+	return endpoints
+}
+
+// An IPv4 EndpointSlice for the Service. Nodes with only an IPv6 host IP are left out.
+func buildEndpointSlice(service *v1.Service, modelId string, nodes *modelNodes, ports Ports) *discovery.EndpointSlice {
+	slice := &discovery.EndpointSlice{
+		ObjectMeta:  managedMeta(service.Name, service.Namespace, modelId),
+		AddressType: discovery.AddressTypeIPv4,
+	}
+	slice.OwnerReferences = ownedBy(service)
+	slice.Labels[discovery.LabelServiceName] = service.Name
+	slice.Labels[discovery.LabelManagedBy] = CONTROLLER_NAME
+
+	port := func(name string, number int32) discovery.EndpointPort {
+		protocol := v1.ProtocolTCP
+		return discovery.EndpointPort{Name: &name, Protocol: &protocol, Port: &number}
+	}
+	slice.Ports = []discovery.EndpointPort{port(PORT_NAME_HTTP, ports.Http), port(PORT_NAME_GRPC, ports.Grpc)}
+
+	endpoint := func(ip, nodeName string, ready bool) discovery.Endpoint {
+		return discovery.Endpoint{
+			Addresses:  []string{ip},
+			Conditions: discovery.EndpointConditions{Ready: &ready},
+			Topology:   map[string]string{LABEL_HOSTNAME: nodeName},
+		}
+	}
+	for _, ip := range sortedIps(nodes.ready) {
+		if net.ParseIP(ip).To4() != nil {
+			slice.Endpoints = append(slice.Endpoints, endpoint(ip, nodes.ready[ip], true))
+		}
+	}
+	for _, ip := range sortedIps(nodes.notReady) {
+		if net.ParseIP(ip).To4() != nil {
+			slice.Endpoints = append(slice.Endpoints, endpoint(ip, nodes.notReady[ip], false))
+		}
+	}
+	return slice
+}
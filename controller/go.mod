@@ -0,0 +1,15 @@
+module github.com/seldonio/trtis-scheduler/controller
+
+go 1.12
+
+require (
+	github.com/go-logr/logr v0.1.0
+	github.com/onsi/gomega v1.7.0
+	golang.org/x/oauth2 v0.0.0-20191202225959-858c2ad4c8b6 // indirect
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0 // indirect
+	k8s.io/api v0.17.0
+	k8s.io/apimachinery v0.17.0
+	k8s.io/client-go v0.17.0
+	k8s.io/utils v0.0.0-20191218082557-f07c713de883 // indirect
+	sigs.k8s.io/controller-runtime v0.4.0
+)
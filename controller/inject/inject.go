@@ -0,0 +1,134 @@
+package inject
+
+import (
+	"fmt"
+	"github.com/seldonio/trtis-scheduler/controller/api/v1alpha1"
+	"github.com/seldonio/trtis-scheduler/controller/operator"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// Pod annotations describing the model to inject the loader and proxy for
+	ANNOTATION_MODEL_URI      = "seldon.io/trtis-model-uri"
+	ANNOTATION_MODEL_CHECKSUM = "seldon.io/trtis-model-checksum"
+	ANNOTATION_GPU_MEMORY     = "seldon.io/trtis-gpu-mem"
+)
+
+// Whether the pod is a model pod to inject: it has a model ID and a model uri
+func ShouldInject(pod *v1.Pod) bool {
+	return pod.Annotations[operator.ANNOTATION_MODEL_ID] != "" && pod.Annotations[ANNOTATION_MODEL_URI] != ""
+}
+
+// Describe the pod's model as a TrtisModel so its containers are built as the operator builds them.
+// The model name is left to the loader, which reads the seldon.io/trtis-model-name annotation itself.
+func modelFromPod(pod *v1.Pod) (*v1alpha1.TrtisModel, error) {
+	model := &v1alpha1.TrtisModel{
+		Spec: v1alpha1.TrtisModelSpec{
+			ModelUri:      pod.Annotations[ANNOTATION_MODEL_URI],
+			ModelChecksum: pod.Annotations[ANNOTATION_MODEL_CHECKSUM],
+		},
+	}
+	if gpuMemory := pod.Annotations[ANNOTATION_GPU_MEMORY]; gpuMemory != "" {
+		quantity, err := resource.ParseQuantity(gpuMemory)
+		if err != nil {
+			return nil, fmt.Errorf("annotation %s %q is not a quantity, e.g. 400Mi: %s", ANNOTATION_GPU_MEMORY, gpuMemory, err)
+		}
+		model.Spec.GpuMemory = quantity
+	}
+	return model, nil
+}
+
+// Add the loader init container, proxy container and model repository volume to a model pod
+// and have the trtis-scheduler place it. Containers and volumes the pod already has are kept,
+// so a proxy container in the pod, e.g. to set its GPU memory limit, is only completed.
+func Inject(pod *v1.Pod, options *operator.Options) error {
+	model, err := modelFromPod(pod)
+	if err != nil {
+		return err
+	}
+	pod.Spec.SchedulerName = options.SchedulerName
+
+	if findContainer(pod.Spec.InitContainers, operator.LOADER_CONTAINER_NAME) == nil {
+		pod.Spec.InitContainers = append([]v1.Container{options.LoaderContainer(model)}, pod.Spec.InitContainers...)
+	}
+	proxy := options.ProxyContainer(model)
+	if existing := findContainer(pod.Spec.Containers, operator.PROXY_CONTAINER_NAME); existing != nil {
+		completeContainer(existing, &proxy)
+	} else {
+		pod.Spec.Containers = append(pod.Spec.Containers, proxy)
+	}
+
+	volume := options.RepoVolume()
+	for _, existing := range pod.Spec.Volumes {
+		if existing.Name == volume.Name {
+			return nil
+		}
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+	return nil
+}
+
+func findContainer(containers []v1.Container, name string) *v1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+// Fill in the fields of a container the pod left empty
+func completeContainer(container *v1.Container, desired *v1.Container) {
+	if container.Image == "" {
+		container.Image = desired.Image
+	}
+	if len(container.Command) == 0 {
+		container.Command = desired.Command
+	}
+	if len(container.Args) == 0 {
+		container.Args = desired.Args
+	}
+	if len(container.Ports) == 0 {
+		container.Ports = desired.Ports
+	}
+	if container.ReadinessProbe == nil {
+		container.ReadinessProbe = desired.ReadinessProbe
+	}
+	if container.LivenessProbe == nil {
+		container.LivenessProbe = desired.LivenessProbe
+	}
+	for _, env := range desired.Env {
+		found := false
+		for _, existing := range container.Env {
+			if existing.Name == env.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			container.Env = append(container.Env, env)
+		}
+	}
+	for _, mount := range desired.VolumeMounts {
+		found := false
+		for _, existing := range container.VolumeMounts {
+			if existing.Name == mount.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+		}
+	}
+	for name, quantity := range desired.Resources.Limits {
+		if _, ok := container.Resources.Limits[name]; ok {
+			continue
+		}
+		if container.Resources.Limits == nil {
+			container.Resources.Limits = v1.ResourceList{}
+		}
+		container.Resources.Limits[name] = quantity
+	}
+}
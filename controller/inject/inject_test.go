@@ -0,0 +1,79 @@
+package inject
+
+import (
+	"github.com/onsi/gomega"
+	"github.com/seldonio/trtis-scheduler/controller/operator"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+var testOptions = &operator.Options{
+	LoaderImage:        "seldonio/trtis-loader:0.1",
+	ProxyImage:         "seldonio/trtis-proxy:0.1",
+	SchedulerName:      "trtis-scheduler",
+	ModelRepoClaim:     "nfs-pvc",
+	ModelRepoMountPath: "/trtis",
+}
+
+func modelPod(annotations map[string]string, containers ...v1.Container) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "default", Annotations: annotations},
+		Spec:       v1.PodSpec{Containers: containers},
+	}
+}
+
+func TestInjectAddsLoaderAndProxy(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	pod := modelPod(map[string]string{
+		operator.ANNOTATION_MODEL_ID: "simple",
+		ANNOTATION_MODEL_URI:         "gs://seldon-models/trtis/simple-model/simple",
+		ANNOTATION_GPU_MEMORY:        "400Mi",
+	})
+	g.Expect(ShouldInject(pod)).Should(gomega.BeTrue())
+	g.Expect(Inject(pod, testOptions)).Should(gomega.BeNil())
+
+	g.Expect(pod.Spec.SchedulerName).Should(gomega.Equal("trtis-scheduler"))
+	g.Expect(pod.Spec.InitContainers).Should(gomega.HaveLen(1))
+	g.Expect(pod.Spec.InitContainers[0].Args).Should(gomega.ContainElement("gs://seldon-models/trtis/simple-model/simple"))
+	g.Expect(pod.Spec.Containers).Should(gomega.HaveLen(1))
+	g.Expect(pod.Spec.Containers[0].Resources.Limits[operator.RESOURCE_TRTIS_GPU_MEMORY]).Should(gomega.Equal(resource.MustParse("400Mi")))
+	g.Expect(pod.Spec.Volumes).Should(gomega.HaveLen(1))
+
+	// Injecting again changes nothing
+	g.Expect(Inject(pod, testOptions)).Should(gomega.BeNil())
+	g.Expect(pod.Spec.InitContainers).Should(gomega.HaveLen(1))
+	g.Expect(pod.Spec.Containers).Should(gomega.HaveLen(1))
+	g.Expect(pod.Spec.Volumes).Should(gomega.HaveLen(1))
+}
+
+func TestInjectCompletesProxyContainer(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	pod := modelPod(map[string]string{
+		operator.ANNOTATION_MODEL_ID: "simple",
+		ANNOTATION_MODEL_URI:         "gs://seldon-models/trtis/simple-model/simple",
+	}, v1.Container{
+		Name:      operator.PROXY_CONTAINER_NAME,
+		Image:     "seldonio/trtis-proxy:0.2",
+		Resources: v1.ResourceRequirements{Limits: v1.ResourceList{operator.RESOURCE_TRTIS_GPU_MEMORY: resource.MustParse("1Gi")}},
+	})
+	g.Expect(Inject(pod, testOptions)).Should(gomega.BeNil())
+	proxy := pod.Spec.Containers[0]
+	g.Expect(pod.Spec.Containers).Should(gomega.HaveLen(1))
+	g.Expect(proxy.Image).Should(gomega.Equal("seldonio/trtis-proxy:0.2"))
+	g.Expect(proxy.Args).ShouldNot(gomega.BeEmpty())
+	g.Expect(proxy.Env).Should(gomega.HaveLen(4))
+	g.Expect(proxy.Resources.Limits[operator.RESOURCE_TRTIS_GPU_MEMORY]).Should(gomega.Equal(resource.MustParse("1Gi")))
+}
+
+func TestInjectRejectsBadGpuMemory(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	pod := modelPod(map[string]string{
+		operator.ANNOTATION_MODEL_ID: "simple",
+		ANNOTATION_MODEL_URI:         "gs://seldon-models/trtis/simple-model/simple",
+		ANNOTATION_GPU_MEMORY:        "lots",
+	})
+	g.Expect(Inject(pod, testOptions)).ShouldNot(gomega.BeNil())
+	g.Expect(ShouldInject(modelPod(map[string]string{operator.ANNOTATION_MODEL_ID: "simple"}))).Should(gomega.BeFalse())
+}
@@ -0,0 +1,45 @@
+package inject
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-logr/logr"
+	"github.com/seldonio/trtis-scheduler/controller/operator"
+	"k8s.io/api/core/v1"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const WEBHOOK_PATH = "/mutate-pod"
+
+// Mutating admission webhook injecting the loader and proxy into model pods on creation
+type PodInjector struct {
+	Options *operator.Options
+	Log     logr.Logger
+	decoder *admission.Decoder
+}
+
+func (i *PodInjector) InjectDecoder(d *admission.Decoder) error {
+	i.decoder = d
+	return nil
+}
+
+func (i *PodInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &v1.Pod{}
+	if err := i.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if !ShouldInject(pod) {
+		return admission.Allowed("not a TRTIS model pod")
+	}
+	if err := Inject(pod, i.Options); err != nil {
+		i.Log.Info("Rejecting model pod", "namespace", req.Namespace, "name", pod.Name, "generateName", pod.GenerateName, "reason", err.Error())
+		return admission.Denied(err.Error())
+	}
+	marshaled, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	i.Log.Info("Injected model pod", "namespace", req.Namespace, "generateName", pod.GenerateName, "model", pod.Annotations[operator.ANNOTATION_MODEL_ID])
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
@@ -0,0 +1,189 @@
+package operator
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/seldonio/trtis-scheduler/controller/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sort"
+)
+
+const (
+	// Annotations the monitor sets on each node and the loader sets on its pod
+	ANNOTATION_TRTIS_GPU_MEMORY_USED  = "seldon.io/trtis-gpu-mem-used"
+	ANNOTATION_TRTIS_GPU_MEMORY_TOTAL = "seldon.io/trtis-gpu-mem-total"
+	ANNOTATION_LOADER_PHASE           = "seldon.io/trtis-loader-phase"
+	ANNOTATION_LOADER_MESSAGE         = "seldon.io/trtis-loader-message"
+)
+
+// Renders the Deployment, Service and PodDisruptionBudget of each TrtisModel and reports
+// the node, GPU memory and readiness of its replicas in its status
+type TrtisModelReconciler struct {
+	client.Client
+	Scheme  *runtime.Scheme
+	Options Options
+	Log     logr.Logger
+}
+
+func (r *TrtisModelReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("trtismodel", req.NamespacedName)
+
+	model := &v1alpha1.TrtisModel{}
+	if err := r.Get(ctx, req.NamespacedName, model); err != nil {
+		// The owned objects of a deleted model are garbage collected
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if model.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	objectMeta := metav1.ObjectMeta{Name: model.Name, Namespace: model.Namespace}
+	deployment := &appsv1.Deployment{ObjectMeta: objectMeta}
+	if err := r.createOrUpdate(ctx, "Deployment", model, deployment, func() { r.Options.renderDeployment(model, deployment) }, log); err != nil {
+		log.Error(err, "Failed to reconcile deployment")
+		return ctrl.Result{}, err
+	}
+	service := &v1.Service{ObjectMeta: objectMeta}
+	if err := r.createOrUpdate(ctx, "Service", model, service, func() { renderService(model, service) }, log); err != nil {
+		log.Error(err, "Failed to reconcile service")
+		return ctrl.Result{}, err
+	}
+	pdb := &policyv1beta1.PodDisruptionBudget{ObjectMeta: objectMeta}
+	if err := r.createOrUpdate(ctx, "PodDisruptionBudget", model, pdb, func() { renderPodDisruptionBudget(model, pdb) }, log); err != nil {
+		log.Error(err, "Failed to reconcile pod disruption budget")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.updateStatus(ctx, model); err != nil {
+		log.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+type object interface {
+	runtime.Object
+	metav1.Object
+}
+
+func (r *TrtisModelReconciler) createOrUpdate(ctx context.Context, kind string, model *v1alpha1.TrtisModel, obj object, render func(), log logr.Logger) error {
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, obj, func() error {
+		render()
+		return controllerutil.SetControllerReference(model, obj, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	if result != controllerutil.OperationResultNone {
+		log.Info("Reconciled", "kind", kind, "name", obj.GetName(), "operation", result)
+	}
+	return nil
+}
+
+func podCondition(pod *v1.Pod, conditionType v1.PodConditionType) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == conditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// Describe a replica from its pod and the GPU memory its node reports
+func (r *TrtisModelReconciler) replicaStatus(ctx context.Context, pod *v1.Pod) v1alpha1.ReplicaStatus {
+	status := v1alpha1.ReplicaStatus{
+		Pod:         pod.Name,
+		Node:        pod.Spec.NodeName,
+		LoaderPhase: pod.Annotations[ANNOTATION_LOADER_PHASE],
+	}
+	for _, container := range pod.Spec.Containers {
+		if quantity, ok := container.Resources.Limits[RESOURCE_TRTIS_GPU_MEMORY]; ok {
+			status.GpuMemory = quantity.String()
+		}
+	}
+	if ready := podCondition(pod, v1.PodReady); ready != nil && ready.Status == v1.ConditionTrue {
+		status.Ready = true
+	}
+
+	if pod.Spec.NodeName != "" {
+		node := &v1.Node{}
+		if err := r.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node); err == nil {
+			status.NodeGpuMemoryUsed = node.Annotations[ANNOTATION_TRTIS_GPU_MEMORY_USED]
+			status.NodeGpuMemoryTotal = node.Annotations[ANNOTATION_TRTIS_GPU_MEMORY_TOTAL]
+		} else if !errors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to get node", "node", pod.Spec.NodeName)
+		}
+	}
+
+	if !status.Ready {
+		if scheduled := podCondition(pod, v1.PodScheduled); scheduled != nil && scheduled.Status != v1.ConditionTrue {
+			status.Message = scheduled.Message
+		} else if message := pod.Annotations[ANNOTATION_LOADER_MESSAGE]; message != "" {
+			status.Message = message
+		} else if ready := podCondition(pod, v1.PodReady); ready != nil {
+			status.Message = ready.Message
+		}
+	}
+	return status
+}
+
+func (r *TrtisModelReconciler) updateStatus(ctx context.Context, model *v1alpha1.TrtisModel) error {
+	pods := &v1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(model.Namespace), client.MatchingLabels(selectorLabels(model))); err != nil {
+		return err
+	}
+	status := v1alpha1.TrtisModelStatus{ObservedGeneration: model.Generation}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		replica := r.replicaStatus(ctx, pod)
+		status.Replicas++
+		if replica.Ready {
+			status.ReadyReplicas++
+		}
+		status.ReplicaStatuses = append(status.ReplicaStatuses, replica)
+	}
+	sort.Slice(status.ReplicaStatuses, func(i, j int) bool {
+		return status.ReplicaStatuses[i].Pod < status.ReplicaStatuses[j].Pod
+	})
+	if equality.Semantic.DeepEqual(model.Status, status) {
+		return nil
+	}
+	model.Status = status
+	return r.Status().Update(ctx, model)
+}
+
+// Reconcile the model of a pod when the pod changes so replica statuses stay current
+func podToModel(obj handler.MapObject) []reconcile.Request {
+	name := obj.Meta.GetLabels()[LABEL_MODEL]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.Meta.GetNamespace(), Name: name}}}
+}
+
+func (r *TrtisModelReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.TrtisModel{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&v1.Service{}).
+		Owns(&policyv1beta1.PodDisruptionBudget{}).
+		Watches(&source.Kind{Type: &v1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(podToModel)}).
+		Complete(r)
+}
@@ -0,0 +1,106 @@
+package operator
+
+import (
+	"context"
+	"github.com/onsi/gomega"
+	"github.com/seldonio/trtis-scheduler/controller/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"testing"
+)
+
+var testOptions = Options{
+	LoaderImage:        "seldonio/trtis-loader:0.1",
+	ProxyImage:         "seldonio/trtis-proxy:0.1",
+	SchedulerName:      "trtis-scheduler",
+	ServiceAccountName: "trtis-model",
+	ModelRepoClaim:     "nfs-pvc",
+	ModelRepoMountPath: "/trtis",
+}
+
+func TestModelNames(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	model := &v1alpha1.TrtisModel{
+		ObjectMeta: metav1.ObjectMeta{Name: "resnet", Namespace: "tenant"},
+		Spec:       v1alpha1.TrtisModelSpec{ModelUri: "gs://seldon-models/trtis/resnet/resnet50_netdef.tar.gz"},
+	}
+	g.Expect(ModelName(model)).Should(gomega.Equal("resnet50_netdef"))
+	g.Expect(ModelId(model)).Should(gomega.Equal("resnet50_netdef"))
+	model.Spec.Isolation = v1alpha1.IsolationUnique
+	g.Expect(ModelId(model)).Should(gomega.Equal("tenant-resnet-resnet50_netdef"))
+	g.Expect(testOptions.loaderArgs(model)).Should(gomega.ContainElement("--unique-model-name"))
+}
+
+func TestReconcileRendersModel(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	g.Expect(v1alpha1.AddToScheme(scheme.Scheme)).Should(gomega.BeNil())
+
+	replicas := int32(2)
+	maxBatchSize := int32(8)
+	model := &v1alpha1.TrtisModel{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple", Namespace: "default"},
+		Spec: v1alpha1.TrtisModelSpec{
+			ModelUri:  "gs://seldon-models/trtis/simple-model/simple",
+			GpuMemory: resource.MustParse("400Mi"),
+			Replicas:  &replicas,
+			Batching:  &v1alpha1.Batching{MaxBatchSize: &maxBatchSize, PreferredBatchSizes: []int32{4, 8}},
+		},
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple-1", Namespace: "default", Labels: map[string]string{LABEL_MODEL: "simple"}},
+		Spec: v1.PodSpec{
+			NodeName: "node1",
+			Containers: []v1.Container{{
+				Name:      PROXY_CONTAINER_NAME,
+				Resources: v1.ResourceRequirements{Limits: v1.ResourceList{RESOURCE_TRTIS_GPU_MEMORY: resource.MustParse("400Mi")}},
+			}},
+		},
+		Status: v1.PodStatus{Phase: v1.PodRunning, Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}},
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        "node1",
+		Annotations: map[string]string{ANNOTATION_TRTIS_GPU_MEMORY_TOTAL: "16000000000"},
+	}}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, model, pod, node)
+	r := &TrtisModelReconciler{Client: client, Scheme: scheme.Scheme, Options: testOptions, Log: logf.Log}
+
+	key := types.NamespacedName{Name: "simple", Namespace: "default"}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	g.Expect(err).Should(gomega.BeNil())
+
+	ctx := context.Background()
+	deployment := &appsv1.Deployment{}
+	g.Expect(client.Get(ctx, key, deployment)).Should(gomega.BeNil())
+	g.Expect(*deployment.Spec.Replicas).Should(gomega.Equal(replicas))
+	g.Expect(deployment.OwnerReferences).Should(gomega.HaveLen(1))
+	template := deployment.Spec.Template
+	g.Expect(template.Spec.SchedulerName).Should(gomega.Equal("trtis-scheduler"))
+	g.Expect(template.Spec.ServiceAccountName).Should(gomega.Equal("trtis-model"))
+	g.Expect(template.Annotations).Should(gomega.HaveKeyWithValue(ANNOTATION_MODEL_ID, "simple"))
+	g.Expect(template.Annotations).Should(gomega.HaveKeyWithValue(ANNOTATION_PREFERRED_BATCH_SIZES, "4,8"))
+	g.Expect(template.Spec.InitContainers[0].Args).Should(gomega.ContainElement("/trtis/$(NODE_NAME)"))
+	g.Expect(template.Spec.Containers[0].Resources.Limits).Should(gomega.HaveKey(v1.ResourceName(RESOURCE_TRTIS_GPU_MEMORY)))
+
+	g.Expect(client.Get(ctx, key, &v1.Service{})).Should(gomega.BeNil())
+	g.Expect(client.Get(ctx, key, &policyv1beta1.PodDisruptionBudget{})).Should(gomega.BeNil())
+
+	updated := &v1alpha1.TrtisModel{}
+	g.Expect(client.Get(ctx, key, updated)).Should(gomega.BeNil())
+	g.Expect(updated.Status.Replicas).Should(gomega.Equal(int32(1)))
+	g.Expect(updated.Status.ReadyReplicas).Should(gomega.Equal(int32(1)))
+	g.Expect(updated.Status.ReplicaStatuses[0]).Should(gomega.Equal(v1alpha1.ReplicaStatus{
+		Pod:                "simple-1",
+		Node:               "node1",
+		GpuMemory:          "400Mi",
+		NodeGpuMemoryTotal: "16000000000",
+		Ready:              true,
+	}))
+}
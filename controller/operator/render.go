@@ -0,0 +1,288 @@
+package operator
+
+import (
+	"fmt"
+	"github.com/seldonio/trtis-scheduler/controller/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	ANNOTATION_MODEL_ID              = "seldon.io/trtis-model-id"
+	ANNOTATION_MODEL_NAME            = "seldon.io/trtis-model-name"
+	ANNOTATION_CLIENT_MODEL_NAME     = "seldon.io/trtis-client-model-name"
+	ANNOTATION_MAX_BATCH_SIZE        = "seldon.io/trtis-max-batch-size"
+	ANNOTATION_PREFERRED_BATCH_SIZES = "seldon.io/trtis-preferred-batch-sizes"
+	ANNOTATION_MAX_QUEUE_DELAY_US    = "seldon.io/trtis-max-queue-delay-us"
+	RESOURCE_TRTIS_GPU_MEMORY        = "seldon.io/trtis-gpu-mem"
+	LABEL_MODEL                      = "seldon.io/trtis-model"
+	LOADER_CONTAINER_NAME            = "trtis-loader"
+	PROXY_CONTAINER_NAME             = "model"
+	REPO_VOLUME_NAME                 = "trtis-repo"
+	PROXY_HTTP_PORT                  = 9000
+	PROXY_GRPC_PORT                  = 9001
+	PROXY_HEALTH_PORT                = 9002
+)
+
+var archiveExtensions = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+// How the pods of a TrtisModel are built
+type Options struct {
+	LoaderImage   string
+	ProxyImage    string
+	SchedulerName string
+	// Service account model pods run as, allowed to read and patch their own pod and record events
+	ServiceAccountName string
+	// Claim of the volume holding the model repository of each node, as mounted by the TRTIS DaemonSet
+	ModelRepoClaim string
+	// Where the volume is mounted in the loader and proxy. The node's repository is the NODE_NAME folder in it.
+	ModelRepoMountPath string
+}
+
+// The name of the model on the TRTIS server before any unique prefix: the spec model name or
+// the last part of the model uri without an archive extension, as the loader names it
+func ModelName(model *v1alpha1.TrtisModel) string {
+	if model.Spec.ModelName != "" {
+		return model.Spec.ModelName
+	}
+	p := model.Spec.ModelUri
+	if uri, err := url.Parse(p); err == nil && uri.Path != "" {
+		p = uri.Path
+	}
+	name := path.Base(strings.TrimSuffix(p, "/"))
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// The model ID the scheduler uses to place one copy of a model on each node. Unique models
+// are prefixed as the loader prefixes their name on the server.
+func ModelId(model *v1alpha1.TrtisModel) string {
+	if model.Spec.Isolation == v1alpha1.IsolationUnique {
+		return fmt.Sprintf("%s-%s-%s", model.Namespace, model.Name, ModelName(model))
+	}
+	return ModelName(model)
+}
+
+func Replicas(model *v1alpha1.TrtisModel) int32 {
+	if model.Spec.Replicas != nil {
+		return *model.Spec.Replicas
+	}
+	return 1
+}
+
+func selectorLabels(model *v1alpha1.TrtisModel) map[string]string {
+	return map[string]string{LABEL_MODEL: model.Name}
+}
+
+// Pod annotations for the scheduler and the loader's model config overrides
+func podAnnotations(model *v1alpha1.TrtisModel) map[string]string {
+	annotations := map[string]string{ANNOTATION_MODEL_ID: ModelId(model)}
+	if model.Spec.Isolation == v1alpha1.IsolationUnique && model.Spec.ModelName != "" {
+		// The loader's --model-name would drop the unique prefix, so the names are given to it here
+		annotations[ANNOTATION_MODEL_NAME] = ModelId(model)
+		annotations[ANNOTATION_CLIENT_MODEL_NAME] = model.Spec.ModelName
+	}
+	if batching := model.Spec.Batching; batching != nil {
+		if batching.MaxBatchSize != nil {
+			annotations[ANNOTATION_MAX_BATCH_SIZE] = strconv.Itoa(int(*batching.MaxBatchSize))
+		}
+		if len(batching.PreferredBatchSizes) > 0 {
+			sizes := make([]string, len(batching.PreferredBatchSizes))
+			for i, size := range batching.PreferredBatchSizes {
+				sizes[i] = strconv.Itoa(int(size))
+			}
+			annotations[ANNOTATION_PREFERRED_BATCH_SIZES] = strings.Join(sizes, ",")
+		}
+		if batching.MaxQueueDelayUs != nil {
+			annotations[ANNOTATION_MAX_QUEUE_DELAY_US] = strconv.FormatInt(*batching.MaxQueueDelayUs, 10)
+		}
+	}
+	return annotations
+}
+
+func fieldEnv(name, fieldPath string) v1.EnvVar {
+	return v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{APIVersion: "v1", FieldPath: fieldPath}}}
+}
+
+var podEnv = []v1.EnvVar{
+	fieldEnv("POD_NAME", "metadata.name"),
+	fieldEnv("POD_NAMESPACE", "metadata.namespace"),
+	fieldEnv("NODE_IP", "status.hostIP"),
+	fieldEnv("NODE_NAME", "spec.nodeName"),
+}
+
+func (o *Options) loaderArgs(model *v1alpha1.TrtisModel) []string {
+	args := []string{"--model-uri", model.Spec.ModelUri, "--trtis-model-repo", path.Join(o.ModelRepoMountPath, "$(NODE_NAME)"), "--trtis-host", "$(NODE_IP)"}
+	if model.Spec.ModelChecksum != "" {
+		args = append(args, "--model-checksum", model.Spec.ModelChecksum)
+	}
+	if model.Spec.Isolation == v1alpha1.IsolationUnique {
+		if model.Spec.ModelName == "" {
+			args = append(args, "--unique-model-name")
+		}
+	} else if model.Spec.ModelName != "" {
+		args = append(args, "--model-name", model.Spec.ModelName)
+	}
+	return args
+}
+
+// The proxy finds the model name the loader recorded on the pod unless it is given one
+func (o *Options) proxyArgs(model *v1alpha1.TrtisModel) []string {
+	args := []string{"--trtis-model-repo", path.Join(o.ModelRepoMountPath, "$(NODE_NAME)"), "--trtis-host", "$(NODE_IP)"}
+	if model.Spec.Isolation != v1alpha1.IsolationUnique && model.Spec.ModelName != "" {
+		args = append(args, "--model-name", model.Spec.ModelName)
+	}
+	return args
+}
+
+func (o *Options) repoVolumeMounts() []v1.VolumeMount {
+	return []v1.VolumeMount{{Name: REPO_VOLUME_NAME, MountPath: o.ModelRepoMountPath}}
+}
+
+func healthProbe(path string) *v1.Probe {
+	return &v1.Probe{Handler: v1.Handler{HTTPGet: &v1.HTTPGetAction{Path: path, Port: intstr.FromInt(PROXY_HEALTH_PORT), Scheme: v1.URISchemeHTTP}}, PeriodSeconds: 5}
+}
+
+// The init container installing the model in the node's model repository
+func (o *Options) LoaderContainer(model *v1alpha1.TrtisModel) v1.Container {
+	return v1.Container{
+		Name:         LOADER_CONTAINER_NAME,
+		Image:        o.LoaderImage,
+		Args:         o.loaderArgs(model),
+		Env:          podEnv,
+		VolumeMounts: o.repoVolumeMounts(),
+	}
+}
+
+// The proxy container serving the model and unloading it when the pod stops. The GPU memory
+// limit is left out if the model does not give one.
+func (o *Options) ProxyContainer(model *v1alpha1.TrtisModel) v1.Container {
+	container := v1.Container{
+		Name:    PROXY_CONTAINER_NAME,
+		Image:   o.ProxyImage,
+		Command: []string{"/trtis-proxy"},
+		Args:    o.proxyArgs(model),
+		Ports: []v1.ContainerPort{
+			{Name: "http", ContainerPort: PROXY_HTTP_PORT, Protocol: v1.ProtocolTCP},
+			{Name: "grpc", ContainerPort: PROXY_GRPC_PORT, Protocol: v1.ProtocolTCP},
+		},
+		ReadinessProbe: healthProbe("/ready"),
+		LivenessProbe:  healthProbe("/live"),
+		Env:            podEnv,
+		VolumeMounts:   o.repoVolumeMounts(),
+	}
+	if !model.Spec.GpuMemory.IsZero() {
+		container.Resources = v1.ResourceRequirements{
+			Limits:   v1.ResourceList{RESOURCE_TRTIS_GPU_MEMORY: model.Spec.GpuMemory},
+			Requests: v1.ResourceList{RESOURCE_TRTIS_GPU_MEMORY: model.Spec.GpuMemory},
+		}
+	}
+	return container
+}
+
+// The volume holding the model repository of each node
+func (o *Options) RepoVolume() v1.Volume {
+	return v1.Volume{
+		Name: REPO_VOLUME_NAME,
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: o.ModelRepoClaim},
+		},
+	}
+}
+
+func (o *Options) podSpec(model *v1alpha1.TrtisModel) v1.PodSpec {
+	return v1.PodSpec{
+		SchedulerName:      o.SchedulerName,
+		ServiceAccountName: o.ServiceAccountName,
+		InitContainers:     []v1.Container{o.LoaderContainer(model)},
+		Containers:         []v1.Container{o.ProxyContainer(model)},
+		Volumes:            []v1.Volume{o.RepoVolume()},
+	}
+}
+
+// Set the desired state of the model's Deployment, leaving fields the API server defaults
+func (o *Options) renderDeployment(model *v1alpha1.TrtisModel, deployment *appsv1.Deployment) {
+	replicas := Replicas(model)
+	deployment.Labels = selectorLabels(model)
+	deployment.Spec.Replicas = &replicas
+	if deployment.Spec.Selector == nil {
+		deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: selectorLabels(model)}
+	}
+	deployment.Spec.Template.Labels = selectorLabels(model)
+	deployment.Spec.Template.Annotations = podAnnotations(model)
+	desired := o.podSpec(model)
+	spec := &deployment.Spec.Template.Spec
+	spec.SchedulerName = desired.SchedulerName
+	spec.ServiceAccountName = desired.ServiceAccountName
+	spec.Volumes = desired.Volumes
+	spec.InitContainers = mergeContainers(spec.InitContainers, desired.InitContainers)
+	spec.Containers = mergeContainers(spec.Containers, desired.Containers)
+}
+
+// Replace the fields the operator sets on each container, keeping those defaulted by the API server
+// so an unchanged model does not update the Deployment
+func mergeContainers(existing, desired []v1.Container) []v1.Container {
+	if len(existing) != len(desired) {
+		return desired
+	}
+	for i := range desired {
+		if existing[i].Name != desired[i].Name {
+			return desired
+		}
+		existing[i].Image = desired[i].Image
+		existing[i].Command = desired[i].Command
+		existing[i].Args = desired[i].Args
+		existing[i].Env = desired[i].Env
+		existing[i].Ports = desired[i].Ports
+		existing[i].VolumeMounts = desired[i].VolumeMounts
+		existing[i].Resources = desired[i].Resources
+		if desired[i].ReadinessProbe != nil {
+			if existing[i].ReadinessProbe == nil {
+				existing[i].ReadinessProbe = desired[i].ReadinessProbe
+			}
+			existing[i].ReadinessProbe.Handler = desired[i].ReadinessProbe.Handler
+			existing[i].ReadinessProbe.PeriodSeconds = desired[i].ReadinessProbe.PeriodSeconds
+		}
+		if desired[i].LivenessProbe != nil {
+			if existing[i].LivenessProbe == nil {
+				existing[i].LivenessProbe = desired[i].LivenessProbe
+			}
+			existing[i].LivenessProbe.Handler = desired[i].LivenessProbe.Handler
+			existing[i].LivenessProbe.PeriodSeconds = desired[i].LivenessProbe.PeriodSeconds
+		}
+	}
+	return existing
+}
+
+// A Service in front of the proxies of the model's replicas
+func renderService(model *v1alpha1.TrtisModel, service *v1.Service) {
+	service.Labels = selectorLabels(model)
+	service.Spec.Selector = selectorLabels(model)
+	service.Spec.Ports = []v1.ServicePort{
+		{Name: "http", Protocol: v1.ProtocolTCP, Port: PROXY_HTTP_PORT, TargetPort: intstr.FromInt(PROXY_HTTP_PORT)},
+		{Name: "grpc", Protocol: v1.ProtocolTCP, Port: PROXY_GRPC_PORT, TargetPort: intstr.FromInt(PROXY_GRPC_PORT)},
+	}
+}
+
+// Limit how many replicas a node drain can take down at once
+func renderPodDisruptionBudget(model *v1alpha1.TrtisModel, pdb *policyv1beta1.PodDisruptionBudget) {
+	maxUnavailable := intstr.FromInt(1)
+	if model.Spec.MaxUnavailable != nil {
+		maxUnavailable = *model.Spec.MaxUnavailable
+	}
+	pdb.Labels = selectorLabels(model)
+	pdb.Spec.MinAvailable = nil
+	pdb.Spec.MaxUnavailable = &maxUnavailable
+	pdb.Spec.Selector = &metav1.LabelSelector{MatchLabels: selectorLabels(model)}
+}
@@ -0,0 +1,119 @@
+package validate
+
+import (
+	"fmt"
+	"github.com/seldonio/trtis-scheduler/controller/inject"
+	"github.com/seldonio/trtis-scheduler/controller/operator"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Models composing an ensemble with their GPU memory, e.g. "preprocess=512Mi,resnet=2Gi"
+	ANNOTATION_ENSEMBLE_MODELS = "seldon.io/trtis-ensemble-models"
+	// Version the pod adds to a model already on a node
+	ANNOTATION_MODEL_VERSION = "seldon.io/trtis-model-version"
+)
+
+var annotationsPath = field.NewPath("metadata", "annotations")
+
+// The largest GPU memory total advertised by the monitor on any node, and that node. Nodes
+// without TRTIS or with an unreadable total are skipped.
+func largestNode(nodes []v1.Node) (string, int64) {
+	var name string
+	var largest int64
+	for _, node := range nodes {
+		total, err := strconv.ParseInt(node.Annotations[operator.ANNOTATION_TRTIS_GPU_MEMORY_TOTAL], 0, 64)
+		if err == nil && total > largest {
+			name = node.Name
+			largest = total
+		}
+	}
+	return name, largest
+}
+
+func validQuantity(value string, path *field.Path, example string) (int64, *field.Error) {
+	quantity, err := resource.ParseQuantity(strings.TrimSpace(value))
+	if err != nil {
+		return 0, field.Invalid(path, value, fmt.Sprintf("must be a quantity of GPU memory, e.g. %s", example))
+	}
+	if quantity.Sign() <= 0 {
+		return 0, field.Invalid(path, value, "GPU memory must be greater than zero")
+	}
+	return quantity.Value(), nil
+}
+
+// Check a pod for the trtis-scheduler has what the scheduler needs to place it: a model ID, a valid
+// GPU memory limit and, counting the models of an ensemble, no more GPU memory than the largest
+// node has. Without these the pod would stay Pending.
+func ValidatePod(pod *v1.Pod, nodes []v1.Node) field.ErrorList {
+	var errs field.ErrorList
+	if pod.Annotations[operator.ANNOTATION_MODEL_ID] == "" {
+		errs = append(errs, field.Required(annotationsPath.Key(operator.ANNOTATION_MODEL_ID),
+			"the trtis-scheduler places one copy of each model on a node by its model ID, add the annotation with the model's ID, e.g. simple"))
+	}
+
+	var gpuMemory int64
+	hasLimit := false
+	for i, container := range pod.Spec.Containers {
+		limit, ok := container.Resources.Limits[operator.RESOURCE_TRTIS_GPU_MEMORY]
+		if !ok {
+			continue
+		}
+		hasLimit = true
+		path := field.NewPath("spec", "containers").Index(i).Child("resources", "limits").Key(operator.RESOURCE_TRTIS_GPU_MEMORY)
+		memory, err := validQuantity(limit.String(), path, "400Mi")
+		if err != nil {
+			errs = append(errs, err)
+		}
+		gpuMemory += memory
+	}
+	if !hasLimit {
+		errs = append(errs, field.Required(field.NewPath("spec", "containers").Key("resources").Child("limits").Key(operator.RESOURCE_TRTIS_GPU_MEMORY),
+			"add a limit with the GPU memory the model needs, e.g. 400Mi, to the proxy container"))
+	}
+	if value, ok := pod.Annotations[inject.ANNOTATION_GPU_MEMORY]; ok {
+		if _, err := validQuantity(value, annotationsPath.Key(inject.ANNOTATION_GPU_MEMORY), "400Mi"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if value, ok := pod.Annotations[ANNOTATION_MODEL_VERSION]; ok {
+		if version, err := strconv.ParseInt(value, 10, 64); err != nil || version <= 0 {
+			errs = append(errs, field.Invalid(annotationsPath.Key(ANNOTATION_MODEL_VERSION), value,
+				"must be the model version the loader installs with --model-version, a number greater than zero"))
+		}
+	}
+
+	if members, ok := pod.Annotations[ANNOTATION_ENSEMBLE_MODELS]; ok {
+		path := annotationsPath.Key(ANNOTATION_ENSEMBLE_MODELS)
+		for _, member := range strings.Split(members, ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			parts := strings.SplitN(member, "=", 2)
+			if parts[0] == "" {
+				errs = append(errs, field.Invalid(path, members, "each model must be given as <model id>=<GPU memory>, e.g. preprocess=512Mi"))
+				continue
+			}
+			if len(parts) == 2 {
+				memory, err := validQuantity(parts[1], path, parts[0]+"=512Mi")
+				if err != nil {
+					errs = append(errs, err)
+				}
+				gpuMemory += memory
+			}
+		}
+	}
+
+	if name, largest := largestNode(nodes); largest > 0 && gpuMemory > largest {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "containers").Key("resources").Child("limits").Key(operator.RESOURCE_TRTIS_GPU_MEMORY),
+			fmt.Sprintf("the pod needs %s of GPU memory but the largest TRTIS node %s has %s, reduce the limit or add a larger GPU node",
+				resource.NewQuantity(gpuMemory, resource.BinarySI), name, resource.NewQuantity(largest, resource.BinarySI))))
+	}
+	return errs
+}
@@ -0,0 +1,59 @@
+package validate
+
+import (
+	"github.com/onsi/gomega"
+	"github.com/seldonio/trtis-scheduler/controller/operator"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func schedulerPod(annotations map[string]string, gpuMemory string) *v1.Pod {
+	container := v1.Container{Name: "model"}
+	if gpuMemory != "" {
+		container.Resources.Limits = v1.ResourceList{operator.RESOURCE_TRTIS_GPU_MEMORY: resource.MustParse(gpuMemory)}
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "model", Annotations: annotations},
+		Spec:       v1.PodSpec{SchedulerName: "trtis-scheduler", Containers: []v1.Container{container}},
+	}
+}
+
+var nodes = []v1.Node{{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:        "gpu-node",
+		Annotations: map[string]string{operator.ANNOTATION_TRTIS_GPU_MEMORY_TOTAL: "17071734784"},
+	},
+}}
+
+func TestValidatePod(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	modelId := map[string]string{operator.ANNOTATION_MODEL_ID: "simple"}
+
+	g.Expect(ValidatePod(schedulerPod(modelId, "400Mi"), nodes)).Should(gomega.BeEmpty())
+
+	errs := ValidatePod(schedulerPod(nil, ""), nodes)
+	g.Expect(errs).Should(gomega.HaveLen(2))
+	g.Expect(errs.ToAggregate().Error()).Should(gomega.ContainSubstring(operator.ANNOTATION_MODEL_ID))
+
+	errs = ValidatePod(schedulerPod(modelId, "0"), nodes)
+	g.Expect(errs).Should(gomega.HaveLen(1))
+
+	errs = ValidatePod(schedulerPod(modelId, "20Gi"), nodes)
+	g.Expect(errs).Should(gomega.HaveLen(1))
+	g.Expect(errs[0].Detail).Should(gomega.ContainSubstring("gpu-node"))
+
+	ensemble := map[string]string{operator.ANNOTATION_MODEL_ID: "ensemble", ANNOTATION_ENSEMBLE_MODELS: "preprocess=lots"}
+	g.Expect(ValidatePod(schedulerPod(ensemble, "400Mi"), nodes)).Should(gomega.HaveLen(1))
+	ensemble[ANNOTATION_ENSEMBLE_MODELS] = "preprocess=512Mi,resnet=16Gi"
+	g.Expect(ValidatePod(schedulerPod(ensemble, "400Mi"), nodes)).Should(gomega.HaveLen(1))
+
+	version := map[string]string{operator.ANNOTATION_MODEL_ID: "simple", ANNOTATION_MODEL_VERSION: "2"}
+	g.Expect(ValidatePod(schedulerPod(version, "400Mi"), nodes)).Should(gomega.BeEmpty())
+	version[ANNOTATION_MODEL_VERSION] = "latest"
+	g.Expect(ValidatePod(schedulerPod(version, "400Mi"), nodes)).Should(gomega.HaveLen(1))
+
+	// Without a node advertising its GPU memory the total is not checked
+	g.Expect(ValidatePod(schedulerPod(modelId, "20Gi"), nil)).Should(gomega.BeEmpty())
+}
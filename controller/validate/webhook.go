@@ -0,0 +1,46 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"k8s.io/api/core/v1"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const WEBHOOK_PATH = "/validate-pod"
+
+// Validating admission webhook rejecting trtis-scheduler pods the scheduler could never place
+type PodValidator struct {
+	Client        client.Reader
+	SchedulerName string
+	Log           logr.Logger
+	decoder       *admission.Decoder
+}
+
+func (v *PodValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+func (v *PodValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &v1.Pod{}
+	if err := v.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if pod.Spec.SchedulerName != v.SchedulerName {
+		return admission.Allowed("not scheduled by " + v.SchedulerName)
+	}
+	nodes := &v1.NodeList{}
+	if err := v.Client.List(ctx, nodes); err != nil {
+		v.Log.Error(err, "Failed to list nodes, not checking GPU memory against nodes")
+	}
+	if errs := ValidatePod(pod, nodes.Items); len(errs) > 0 {
+		message := fmt.Sprintf("pod for %s is invalid: %s", v.SchedulerName, errs.ToAggregate().Error())
+		v.Log.Info("Rejecting pod", "namespace", req.Namespace, "name", pod.Name, "generateName", pod.GenerateName, "reason", message)
+		return admission.Denied(message)
+	}
+	return admission.Allowed("")
+}
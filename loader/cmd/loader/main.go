@@ -1,31 +1,238 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/otiai10/copy"
+	"github.com/seldonio/trtis-scheduler/common/cache"
+	"github.com/seldonio/trtis-scheduler/loader/config"
+	"github.com/seldonio/trtis-scheduler/loader/fetch"
 	http2 "github.com/seldonio/trtis-scheduler/loader/http"
+	"github.com/seldonio/trtis-scheduler/loader/k8s"
+	"github.com/seldonio/trtis-scheduler/loader/version"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"strings"
+	"time"
 )
 
 var (
-	trtisHost      = flag.String("trtis-host", "0.0.0.0", "TRTIS host")
-	trtisHttpPort  = flag.Int("trtis-http-port", 8000, "TRTIS http port")
-	modelSrc       = flag.String("model-src", "", "Src folder for model")
-	trtisModelRepo = flag.String("trtis-model-repo", "/mnt/trtis/models", "TRTIS Model Repository")
+	trtisHost       = flag.String("trtis-host", "0.0.0.0", "TRTIS host")
+	trtisHttpPort   = flag.Int("trtis-http-port", 8000, "TRTIS http port")
+	loadTimeout     = flag.Duration("load-timeout", 0, "Time to wait for TRTIS to load the model, 0 waits forever")
+	statusInterval  = flag.Duration("status-interval", 5*time.Second, "Minimum interval between progress updates on the pod")
+	modelSrc        = flag.String("model-src", "", "Src folder for model")
+	modelUri        = flag.String("model-uri", "", "Uri for model: gs://, s3://, https:// (tar or zip archive) or file://")
+	modelChecksum   = flag.String("model-checksum", "", "Optional checksum for model archives as <sha256|md5>:<hex digest>")
+	gcsEndpoint     = flag.String("gcs-endpoint", fetch.GCS_ENDPOINT, "Google Cloud Storage endpoint")
+	modelName       = flag.String("model-name", "", "Name of model on TRTIS server, defaults to last part of model-src")
+	uniqueModelName = flag.Bool("unique-model-name", false, "Prefix model name with pod namespace and deployment so it is unique on the TRTIS server")
+	stagingDir      = flag.String("staging-dir", "", "Folder to prepare model in before installing, defaults to a temporary folder")
+	trtisModelRepo  = flag.String("trtis-model-repo", "/mnt/trtis/models", "TRTIS Model Repository")
+	modelVersion    = flag.Int64("model-version", 0, "Install the model as this version, adding it to the model if it is already on the server")
+	modelCache      = flag.String("model-cache", "", "Optional node model cache folder. Models are installed as links into the cache.")
+	ensembleUris    = config.ModelUris{}
 )
 
+func init() {
+	flag.Var(ensembleUris, "ensemble-model-uri", "Uri for a model composing an ensemble as <model name>=<uri>, may be repeated. Composing models without a uri must already be on the server.")
+}
+
 // Copy model to dst folder
 // Assumes last pasrt of model is the model name and appends this to dst
-func copyModel(src, dst, modelName string, log logr.Logger) {
+func copyModel(src, dst, modelName string) error {
 	dstPath := path.Join(dst, modelName)
-	err := copy.Copy(src, dstPath)
+	return copy.Copy(src, dstPath)
+}
+
+func installFromCache(stagedModel, modelName string, log logr.Logger) error {
+	modelCache, err := cache.NewModelCache(*modelCache, log)
+	if err != nil {
+		return err
+	}
+	return modelCache.Install(stagedModel, *trtisModelRepo, modelName)
+}
+
+// Install a staged model into the model repository, through the cache if one is configured
+func installModel(stagedModel, modelName string, log logr.Logger) error {
+	if *modelCache != "" {
+		log.Info("Install model from cache", "cache", *modelCache, "dst", *trtisModelRepo, "model-name", modelName)
+		return installFromCache(stagedModel, modelName, log)
+	}
+	log.Info("Copy model from ", "src", stagedModel, "dst", *trtisModelRepo, "model-name", modelName)
+	return copyModel(stagedModel, *trtisModelRepo, modelName)
+}
+
+// Add a version to a model in the model repository. A model installed from a cache, this
+// loader's or the one recorded in the model folder, gets the version through the cache as its
+// folder is a link farm into trees other models may share.
+func installVersion(stagedModel, modelName string, log logr.Logger) error {
+	modelDir := path.Join(*trtisModelRepo, modelName)
+	cacheRoot := *modelCache
+	if ref, err := cache.ReadRef(modelDir); err == nil {
+		cacheRoot = ref.Cache
+	}
+	if cacheRoot == "" {
+		return version.InstallVersion(stagedModel, modelDir, *modelVersion)
+	}
+	modelCache, err := cache.NewModelCache(cacheRoot, log)
+	if err != nil {
+		return err
+	}
+	return modelCache.InstallVersion(stagedModel, *trtisModelRepo, modelName, *modelVersion)
+}
+
+// Fetch a model into the staging folder
+func stageModel(ctx context.Context, registry *fetch.Registry, uri *url.URL, stagedModel string, checksum *fetch.Checksum, reporter *k8s.StatusReporter) error {
+	if err := os.RemoveAll(stagedModel); err != nil {
+		return err
+	}
+	return registry.Fetch(ctx, &fetch.Request{
+		Uri:      uri,
+		Dst:      stagedModel,
+		Checksum: checksum,
+		Progress: reporter,
+	})
+}
+
+// Install the models composing an ensemble which are not yet on the server.
+// Returns the names of the models installed.
+func installEnsembleMembers(ctx context.Context, registry *fetch.Registry, members []string, staging string, reporter *k8s.StatusReporter, log logr.Logger) []string {
+	var installed []string
+	for _, member := range members {
+		if version.ModelInstalled(path.Join(*trtisModelRepo, member)) {
+			log.Info("Ensemble member already on server", "model-name", member)
+			continue
+		}
+		memberUri, ok := ensembleUris[member]
+		if !ok {
+			exitOnError(fmt.Errorf("model %s is not on the server and has no ensemble-model-uri", member), "Missing ensemble member", reporter, log)
+		}
+		uri, err := url.Parse(memberUri)
+		exitOnError(err, "Failed to parse ensemble member uri", reporter, log)
+
+		reporter.SetPhase(k8s.PHASE_FETCHING, "Fetching ensemble member "+uri.String())
+		stagedMember := path.Join(staging, member)
+		exitOnError(stageModel(ctx, registry, uri, stagedMember, nil, reporter), "Failed to fetch ensemble member "+member, reporter, log)
+
+		reporter.SetPhase(k8s.PHASE_VALIDATING, "Validating ensemble member "+member)
+		memberConfig, err := config.RewriteModelConfig(stagedMember, &config.Overrides{Name: member})
+		exitOnError(err, "Failed to rewrite ensemble member config", reporter, log)
+		exitOnError(config.ValidateModel(stagedMember, memberConfig), "Invalid ensemble member", reporter, log)
+
+		reporter.SetPhase(k8s.PHASE_INSTALLING, "Installing ensemble member "+member)
+		exitOnError(installModel(stagedMember, member, log), "Failed to install ensemble member", reporter, log)
+		if err := os.RemoveAll(stagedMember); err != nil {
+			log.Error(err, "Failed to remove staged model")
+		}
+		installed = append(installed, member)
+	}
+	return installed
+}
+
+// Mark an installed model as owned by this pod. Nothing is written when not running in a pod.
+func writeOwner(owner *cache.ModelOwner, modelName string) error {
+	if owner == nil {
+		return nil
+	}
+	return owner.Write(path.Join(*trtisModelRepo, modelName))
+}
+
+// Add models to a comma separated list of models, ignoring duplicates
+func appendModels(list string, models []string) string {
+	var all []string
+	seen := map[string]bool{}
+	for _, name := range append(strings.Split(list, ","), models...) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			all = append(all, name)
+		}
+	}
+	return strings.Join(all, ",")
+}
+
+// Log the error, report the failure onto the pod and exit
+func exitOnError(err error, message string, reporter *k8s.StatusReporter, log logr.Logger) {
+	if err == nil {
+		return
+	}
+	log.Error(err, message)
+	reporter.Failed(fmt.Errorf("%s: %v", message, err))
+	reporter.FlushEvents()
+	os.Exit(-1)
+}
+
+// Log an error recording something on the pod, which is best effort so loading carries on
+func logOnError(err error, message string, log logr.Logger) {
 	if err != nil {
-		log.Error(err, "failed to copy model")
+		log.Error(err, message)
+	}
+}
+
+func createFetchRegistry(ctx context.Context, log logr.Logger) *fetch.Registry {
+	registry := fetch.NewRegistry(log)
+	registry.Register("file", fetch.NewFileFetcher())
+	httpFetcher := fetch.NewHttpFetcher(nil)
+	registry.Register("http", httpFetcher)
+	registry.Register("https", httpFetcher)
+	registry.Register("gs", fetch.NewGcsFetcher(fetch.NewGcsHttpClient(ctx, log), *gcsEndpoint))
+	s3Fetcher, err := fetch.NewS3FetcherFromEnv()
+	if err != nil {
+		log.Error(err, "Failed to create S3 fetcher")
+	} else {
+		registry.Register("s3", s3Fetcher)
+	}
+	return registry
+}
+
+// Get the model uri from model-uri or the model-src folder
+func getModelUri(log logr.Logger) *url.URL {
+	if *modelUri != "" {
+		uri, err := url.Parse(*modelUri)
+		if err != nil {
+			log.Error(err, "Failed to parse model uri", "uri", *modelUri)
+			os.Exit(-1)
+		}
+		return uri
+	}
+	src, err := filepath.Abs(*modelSrc)
+	if err != nil {
+		log.Error(err, "Failed to get model src path", "src", *modelSrc)
 		os.Exit(-1)
 	}
+	return &url.URL{Scheme: "file", Path: src}
+}
+
+// Decide the name for the model on the TRTIS server and the name clients use for it
+func getModelName(srcName string, annotations map[string]string, k8sManager *k8s.K8sManager, log logr.Logger) (string, string) {
+	if *modelName != "" {
+		return *modelName, *modelName
+	}
+	if name := annotations[config.ANNOTATION_MODEL_NAME]; name != "" {
+		if clientName := annotations[config.ANNOTATION_CLIENT_MODEL_NAME]; clientName != "" {
+			return name, clientName
+		}
+		return name, name
+	}
+	if *uniqueModelName {
+		if k8sManager == nil {
+			log.Info("unique-model-name requires pod details from environment")
+			os.Exit(-1)
+		}
+		pod, err := k8sManager.GetPod()
+		if err != nil {
+			log.Error(err, "Failed to get pod")
+			os.Exit(-1)
+		}
+		return fmt.Sprintf("%s-%s-%s", pod.Namespace, k8s.GetDeploymentName(pod), srcName), srcName
+	}
+	return srcName, srcName
 }
 
 func main() {
@@ -34,22 +241,129 @@ func main() {
 	logf.SetLogger(logf.ZapLogger(false))
 	log := logf.Log.WithName("proxy")
 
-	if *modelSrc == "" {
-		log.Info("model-src must be provided")
+	if *modelSrc == "" && *modelUri == "" {
+		log.Info("model-src or model-uri must be provided")
 		os.Exit(-1)
 	}
+	var checksum *fetch.Checksum
+	if *modelChecksum != "" {
+		var err error
+		checksum, err = fetch.ParseChecksum(*modelChecksum)
+		if err != nil {
+			log.Error(err, "Invalid model checksum")
+			os.Exit(-1)
+		}
+	}
 
 	log.Info("Started")
 
-	_, modelName := path.Split(*modelSrc)
-	log.Info("Copy model from ", "src", *modelSrc, "dst", *trtisModelRepo, "model-name", modelName)
-	copyModel(*modelSrc, *trtisModelRepo, modelName, log)
-
-	//TODO wait for TRTIS to show model is loaded and change annotation on this pod to show allocated
-	// so memory will not be added to that shown in TRTIS by scheduler
-	modelStatus := http2.NewModelStatus(*trtisHost, *trtisHttpPort, modelName, log)
-	err := modelStatus.WaitForModelLoaded()
+	k8sManager, err := k8s.NewK8sManager(log)
 	if err != nil {
+		log.Error(err, "Failed to create k8s manager")
 		os.Exit(-1)
 	}
+	annotations := map[string]string{}
+	var owner *cache.ModelOwner
+	if k8sManager != nil {
+		// Without access to its pod the loader still loads the model, it just can not report on the pod
+		pod, err := k8sManager.GetPod()
+		if err != nil {
+			log.Error(err, "Failed to get pod, loading without pod annotations or status reporting")
+			k8sManager = nil
+		} else {
+			annotations = pod.Annotations
+			owner = k8s.NewModelOwner(pod)
+		}
+	}
+
+	reporter := k8s.NewStatusReporter(k8sManager, *statusInterval, log)
+
+	overrides, err := config.NewOverridesFromAnnotations(annotations)
+	exitOnError(err, "Failed to parse model config overrides", reporter, log)
+
+	uri := getModelUri(log)
+	var clientModelName string
+	overrides.Name, clientModelName = getModelName(fetch.ModelNameFromUri(uri), annotations, k8sManager, log)
+
+	staging := *stagingDir
+	if staging == "" {
+		staging, err = ioutil.TempDir("", "trtis-loader")
+		exitOnError(err, "Failed to create staging folder", reporter, log)
+	}
+	stagedModel := path.Join(staging, overrides.Name)
+
+	reporter.SetPhase(k8s.PHASE_FETCHING, "Fetching "+uri.String())
+	log.Info("Stage model", "uri", uri.String(), "staging", staging, "model-name", overrides.Name)
+	ctx := context.Background()
+	registry := createFetchRegistry(ctx, log)
+	err = stageModel(ctx, registry, uri, stagedModel, checksum, reporter)
+	exitOnError(err, "Failed to fetch model "+uri.String(), reporter, log)
+
+	reporter.SetPhase(k8s.PHASE_VALIDATING, fmt.Sprintf("Fetched %d bytes", reporter.Bytes()))
+	if *modelVersion > 0 {
+		overrides.AllVersions = true
+		err = version.RenumberStagedVersion(stagedModel, *modelVersion)
+		exitOnError(err, "Failed to prepare model version", reporter, log)
+	}
+	modelConfig, err := config.RewriteModelConfig(stagedModel, overrides)
+	exitOnError(err, "Failed to rewrite model config", reporter, log)
+	log.Info("Rewrote model config", "config", modelConfig.String())
+	exitOnError(config.ValidateModel(stagedModel, modelConfig), "Invalid model", reporter, log)
+
+	// The models an ensemble is composed of must be on the server before the ensemble is loaded
+	members := config.EnsembleMembers(modelConfig)
+	if len(members) > 0 {
+		log.Info("Model is an ensemble", "members", members)
+		installed := installEnsembleMembers(ctx, registry, members, staging, reporter, log)
+		for _, member := range installed {
+			exitOnError(writeOwner(owner, member), "Failed to record ensemble member owner", reporter, log)
+		}
+		if k8sManager != nil && len(installed) > 0 {
+			err = k8sManager.PatchPodAnnotations(map[string]string{
+				config.ANNOTATION_ENSEMBLE_MEMBERS: appendModels(annotations[config.ANNOTATION_ENSEMBLE_MEMBERS], installed),
+			})
+			logOnError(err, "Failed to record ensemble members", log)
+		}
+	}
+
+	reporter.SetPhase(k8s.PHASE_INSTALLING, "Installing into "+*trtisModelRepo)
+	modelDir := path.Join(*trtisModelRepo, overrides.Name)
+	if *modelVersion > 0 && version.ModelInstalled(modelDir) {
+		// Add the version alongside the versions already being served. The installed
+		// config serves all versions so TRTIS loads the new version without a reload.
+		log.Info("Add model version", "dst", modelDir, "version", *modelVersion)
+		err = installVersion(stagedModel, overrides.Name, log)
+	} else {
+		err = installModel(stagedModel, overrides.Name, log)
+	}
+	exitOnError(err, "Failed to install model", reporter, log)
+	exitOnError(writeOwner(owner, overrides.Name), "Failed to record model owner", reporter, log)
+	if err := os.RemoveAll(stagedModel); err != nil {
+		log.Error(err, "Failed to remove staged model")
+	}
+
+	// Record the model name so the proxy and scheduler can find the model on the server
+	if k8sManager != nil && (annotations[config.ANNOTATION_MODEL_NAME] != overrides.Name || annotations[config.ANNOTATION_CLIENT_MODEL_NAME] != clientModelName) {
+		err = k8sManager.PatchPodAnnotations(map[string]string{
+			config.ANNOTATION_MODEL_NAME:        overrides.Name,
+			config.ANNOTATION_CLIENT_MODEL_NAME: clientModelName,
+		})
+		logOnError(err, "Failed to record model name", log)
+	}
+
+	for _, member := range members {
+		reporter.SetPhase(k8s.PHASE_WAITING_FOR_READY, "Waiting for TRTIS to load ensemble member "+member)
+		memberStatus := http2.NewModelStatus(*trtisHost, *trtisHttpPort, member, *loadTimeout, log)
+		exitOnError(memberStatus.WaitForModelLoaded(), "Ensemble member failed to load", reporter, log)
+	}
+	reporter.SetPhase(k8s.PHASE_WAITING_FOR_READY, "Waiting for TRTIS to load "+overrides.Name)
+	modelStatus := http2.NewModelStatus(*trtisHost, *trtisHttpPort, overrides.Name, *loadTimeout, log)
+	if *modelVersion > 0 {
+		exitOnError(modelStatus.WaitForVersionLoaded(*modelVersion), "Model version failed to load", reporter, log)
+		reporter.Ready(fmt.Sprintf("Model %s version %d loaded", overrides.Name, *modelVersion))
+	} else {
+		exitOnError(modelStatus.WaitForModelLoaded(), "Model failed to load", reporter, log)
+		reporter.Ready(fmt.Sprintf("Model %s loaded", overrides.Name))
+	}
+	reporter.FlushEvents()
 }
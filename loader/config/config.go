@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	CONFIG_FILENAME = "config.pbtxt"
+
+	ANNOTATION_MODEL_NAME            = "seldon.io/trtis-model-name"
+	ANNOTATION_CLIENT_MODEL_NAME     = "seldon.io/trtis-client-model-name"
+	ANNOTATION_INSTANCE_GPUS         = "seldon.io/trtis-instance-gpus"
+	ANNOTATION_INSTANCE_COUNT        = "seldon.io/trtis-instance-count"
+	ANNOTATION_MAX_BATCH_SIZE        = "seldon.io/trtis-max-batch-size"
+	ANNOTATION_PREFERRED_BATCH_SIZES = "seldon.io/trtis-preferred-batch-sizes"
+	ANNOTATION_MAX_QUEUE_DELAY_US    = "seldon.io/trtis-max-queue-delay-us"
+)
+
+// Overrides to apply to a model config before it is installed on a TRTIS server.
+// Nil or empty fields leave the model config unchanged.
+type Overrides struct {
+	Name                      string
+	InstanceGpus              []int32
+	InstanceCount             *int32
+	MaxBatchSize              *int32
+	PreferredBatchSizes       []int32
+	MaxQueueDelayMicroseconds *uint64
+	// Serve all version folders so versions can be added and retired without changing the config
+	AllVersions bool
+}
+
+// Create overrides from pod annotations
+func NewOverridesFromAnnotations(annotations map[string]string) (*Overrides, error) {
+	o := &Overrides{
+		Name: annotations[ANNOTATION_MODEL_NAME],
+	}
+	var err error
+	if v, ok := annotations[ANNOTATION_INSTANCE_GPUS]; ok {
+		if o.InstanceGpus, err = parseInt32List(v); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", ANNOTATION_INSTANCE_GPUS, err)
+		}
+	}
+	if v, ok := annotations[ANNOTATION_INSTANCE_COUNT]; ok {
+		if o.InstanceCount, err = parseInt32(v); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", ANNOTATION_INSTANCE_COUNT, err)
+		}
+	}
+	if v, ok := annotations[ANNOTATION_MAX_BATCH_SIZE]; ok {
+		if o.MaxBatchSize, err = parseInt32(v); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", ANNOTATION_MAX_BATCH_SIZE, err)
+		}
+	}
+	if v, ok := annotations[ANNOTATION_PREFERRED_BATCH_SIZES]; ok {
+		if o.PreferredBatchSizes, err = parseInt32List(v); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", ANNOTATION_PREFERRED_BATCH_SIZES, err)
+		}
+	}
+	if v, ok := annotations[ANNOTATION_MAX_QUEUE_DELAY_US]; ok {
+		delay, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", ANNOTATION_MAX_QUEUE_DELAY_US, err)
+		}
+		o.MaxQueueDelayMicroseconds = &delay
+	}
+	return o, nil
+}
+
+func parseInt32(s string) (*int32, error) {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	i := int32(v)
+	return &i, nil
+}
+
+func parseInt32List(s string) ([]int32, error) {
+	var list []int32
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		v, err := parseInt32(part)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *v)
+	}
+	return list, nil
+}
+
+// Apply the overrides to the model config
+func (o *Overrides) Apply(config *trtis.ModelConfig) error {
+	if o.Name != "" {
+		config.Name = o.Name
+	}
+	if o.MaxBatchSize != nil {
+		config.MaxBatchSize = *o.MaxBatchSize
+	}
+	if o.AllVersions {
+		config.VersionPolicy = &trtis.ModelVersionPolicy{
+			PolicyChoice: &trtis.ModelVersionPolicy_All_{All: &trtis.ModelVersionPolicy_All{}},
+		}
+	}
+	if len(o.InstanceGpus) > 0 || o.InstanceCount != nil {
+		if len(config.InstanceGroup) == 0 {
+			config.InstanceGroup = []*trtis.ModelInstanceGroup{{Kind: trtis.ModelInstanceGroup_KIND_GPU, Count: 1}}
+		}
+		for _, group := range config.InstanceGroup {
+			if o.InstanceCount != nil {
+				group.Count = *o.InstanceCount
+			}
+			if len(o.InstanceGpus) > 0 {
+				if group.Kind == trtis.ModelInstanceGroup_KIND_CPU {
+					return fmt.Errorf("can not assign gpus to CPU instance group %s", group.Name)
+				}
+				group.Kind = trtis.ModelInstanceGroup_KIND_GPU
+				group.Gpus = o.InstanceGpus
+			}
+		}
+	}
+	if len(o.PreferredBatchSizes) > 0 || o.MaxQueueDelayMicroseconds != nil {
+		if config.GetSequenceBatching() != nil || config.GetEnsembleScheduling() != nil {
+			return fmt.Errorf("can not apply dynamic batching to model %s as it uses another scheduler", config.Name)
+		}
+		batching := config.GetDynamicBatching()
+		if batching == nil {
+			batching = &trtis.ModelDynamicBatching{}
+			config.SchedulingChoice = &trtis.ModelConfig_DynamicBatching{DynamicBatching: batching}
+		}
+		if len(o.PreferredBatchSizes) > 0 {
+			batching.PreferredBatchSize = o.PreferredBatchSizes
+		}
+		if o.MaxQueueDelayMicroseconds != nil {
+			batching.MaxQueueDelayMicroseconds = *o.MaxQueueDelayMicroseconds
+		}
+	}
+	return nil
+}
+
+func ReadModelConfig(modelDir string) (*trtis.ModelConfig, error) {
+	data, err := ioutil.ReadFile(path.Join(modelDir, CONFIG_FILENAME))
+	if err != nil {
+		return nil, err
+	}
+	config := &trtis.ModelConfig{}
+	if err := proto.UnmarshalText(string(data), config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func WriteModelConfig(modelDir string, config *trtis.ModelConfig) error {
+	return ioutil.WriteFile(path.Join(modelDir, CONFIG_FILENAME), []byte(proto.MarshalTextString(config)), 0644)
+}
+
+// Parse the model config in a model folder, apply overrides and write it back
+func RewriteModelConfig(modelDir string, overrides *Overrides) (*trtis.ModelConfig, error) {
+	config, err := ReadModelConfig(modelDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := overrides.Apply(config); err != nil {
+		return nil, err
+	}
+	if err := WriteModelConfig(modelDir, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+var versionDir = regexp.MustCompile(`^[0-9]+$`)
+
+// Check a model folder has a config matching its folder name and at least one numeric version folder
+func ValidateModel(modelDir string, config *trtis.ModelConfig) error {
+	if name := path.Base(modelDir); config.Name != name {
+		return fmt.Errorf("model config name %q does not match model folder %q", config.Name, name)
+	}
+	entries, err := ioutil.ReadDir(modelDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && versionDir.MatchString(entry.Name()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %s has no version folders", config.Name)
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/onsi/gomega"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+const testConfig = `
+name: "simple"
+platform: "tensorflow_graphdef"
+max_batch_size: 8
+instance_group [
+  {
+    count: 2
+    kind: KIND_GPU
+  }
+]
+`
+
+func TestRewriteModelConfig(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	g.Expect(err).Should(gomega.BeNil())
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(path.Join(dir, CONFIG_FILENAME), []byte(testConfig), 0644)
+	g.Expect(err).Should(gomega.BeNil())
+
+	overrides, err := NewOverridesFromAnnotations(map[string]string{
+		ANNOTATION_INSTANCE_GPUS:         "1",
+		ANNOTATION_INSTANCE_COUNT:        "1",
+		ANNOTATION_MAX_BATCH_SIZE:        "16",
+		ANNOTATION_PREFERRED_BATCH_SIZES: "4, 8",
+		ANNOTATION_MAX_QUEUE_DELAY_US:    "100",
+	})
+	g.Expect(err).Should(gomega.BeNil())
+	overrides.Name = "default-model-simple"
+
+	_, err = RewriteModelConfig(dir, overrides)
+	g.Expect(err).Should(gomega.BeNil())
+
+	config, err := ReadModelConfig(dir)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(config.Name).Should(gomega.Equal("default-model-simple"))
+	g.Expect(config.Platform).Should(gomega.Equal("tensorflow_graphdef"))
+	g.Expect(config.MaxBatchSize).Should(gomega.Equal(int32(16)))
+	g.Expect(config.InstanceGroup).Should(gomega.HaveLen(1))
+	g.Expect(config.InstanceGroup[0].Count).Should(gomega.Equal(int32(1)))
+	g.Expect(config.InstanceGroup[0].Gpus).Should(gomega.Equal([]int32{1}))
+	g.Expect(config.GetDynamicBatching().PreferredBatchSize).Should(gomega.Equal([]int32{4, 8}))
+	g.Expect(config.GetDynamicBatching().MaxQueueDelayMicroseconds).Should(gomega.Equal(uint64(100)))
+}
+
+func TestDynamicBatchingNotAppliedToEnsemble(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	config := &trtis.ModelConfig{
+		Name:             "ensemble",
+		SchedulingChoice: &trtis.ModelConfig_EnsembleScheduling{EnsembleScheduling: &trtis.ModelEnsembling{}},
+	}
+	overrides := &Overrides{PreferredBatchSizes: []int32{4}}
+	g.Expect(overrides.Apply(config)).ShouldNot(gomega.BeNil())
+}
+
+func TestInvalidAnnotation(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	_, err := NewOverridesFromAnnotations(map[string]string{ANNOTATION_INSTANCE_COUNT: "two"})
+	g.Expect(err).ShouldNot(gomega.BeNil())
+}
+
+func TestEnsembleMembers(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	modelConfig := &trtis.ModelConfig{}
+	err := proto.UnmarshalText(`
+name: "ensemble"
+platform: "ensemble"
+ensemble_scheduling {
+  step [
+    { model_name: "preprocess" model_version: -1 },
+    { model_name: "resnet" model_version: -1 },
+    { model_name: "preprocess" model_version: -1 }
+  ]
+}`, modelConfig)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(EnsembleMembers(modelConfig)).Should(gomega.Equal([]string{"preprocess", "resnet"}))
+	g.Expect(EnsembleMembers(&trtis.ModelConfig{Name: "simple"})).Should(gomega.BeEmpty())
+
+	uris := ModelUris{}
+	g.Expect(uris.Set("resnet=gs://models/resnet")).Should(gomega.BeNil())
+	g.Expect(uris.Set("resnet")).ShouldNot(gomega.BeNil())
+	g.Expect(uris["resnet"]).Should(gomega.Equal("gs://models/resnet"))
+}
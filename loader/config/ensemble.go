@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"sort"
+	"strings"
+)
+
+// Composing models installed by the loader for an ensemble, removed by the proxy with the ensemble
+const ANNOTATION_ENSEMBLE_MEMBERS = "seldon.io/trtis-ensemble-members"
+
+// Get the names of the models an ensemble is composed of, or nil if the model is not an ensemble
+func EnsembleMembers(config *trtis.ModelConfig) []string {
+	seen := map[string]bool{}
+	var members []string
+	for _, step := range config.GetEnsembleScheduling().GetStep() {
+		if name := step.GetModelName(); name != "" && !seen[name] {
+			seen[name] = true
+			members = append(members, name)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Model uris keyed by model name, set from repeated name=uri flags
+type ModelUris map[string]string
+
+func (m ModelUris) String() string {
+	var parts []string
+	for name, uri := range m {
+		parts = append(parts, name+"="+uri)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (m ModelUris) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected <model name>=<uri> but got %q", value)
+	}
+	m[parts[0]] = parts[1]
+	return nil
+}
@@ -0,0 +1,208 @@
+package fetch
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"github.com/seldonio/trtis-scheduler/loader/config"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ARCHIVE_TAR    = ".tar"
+	ARCHIVE_TAR_GZ = ".tar.gz"
+	ARCHIVE_TGZ    = ".tgz"
+	ARCHIVE_ZIP    = ".zip"
+)
+
+// Get the archive extension for a file name or "" if it is not an archive
+func archiveExtension(name string) string {
+	for _, ext := range []string{ARCHIVE_TAR_GZ, ARCHIVE_TGZ, ARCHIVE_TAR, ARCHIVE_ZIP} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// Get the archive extension for a content type or "" if it is not an archive
+func archiveExtensionFromContentType(contentType string) string {
+	switch strings.TrimSpace(strings.Split(contentType, ";")[0]) {
+	case "application/zip", "application/x-zip-compressed":
+		return ARCHIVE_ZIP
+	case "application/x-tar":
+		return ARCHIVE_TAR
+	case "application/gzip", "application/x-gzip", "application/x-compressed-tar":
+		return ARCHIVE_TAR_GZ
+	}
+	return ""
+}
+
+// Stream an archive into the destination folder verifying the optional checksum
+func extractArchive(r io.Reader, ext string, dst string, checksum *Checksum) error {
+	var h hash.Hash
+	if checksum != nil {
+		h = checksum.NewHash()
+		r = io.TeeReader(r, h)
+	}
+
+	var err error
+	switch ext {
+	case ARCHIVE_TAR:
+		err = extractTar(r, dst)
+	case ARCHIVE_TAR_GZ, ARCHIVE_TGZ:
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(r)
+		if err == nil {
+			err = extractTar(gz, dst)
+			gz.Close()
+		}
+	case ARCHIVE_ZIP:
+		err = extractZip(r, dst)
+	default:
+		err = fmt.Errorf("unsupported archive type %q", ext)
+	}
+	if err != nil {
+		return err
+	}
+
+	if checksum != nil {
+		// Include any trailing bytes not read by the archive reader
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			return err
+		}
+		if err := checksum.Verify(h); err != nil {
+			return err
+		}
+	}
+	return flattenSingleFolder(dst)
+}
+
+func extractTar(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := safeJoin(dst, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if _, err := writeFile(target, tr, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Zip archives can not be streamed so they are first saved to a temporary file
+func extractZip(r io.Reader, dst string) error {
+	tmp, err := ioutil.TempFile("", "trtis-model-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		target, err := safeJoin(dst, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		_, err = writeFile(target, rc, f.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Join name onto dst ensuring the result does not escape dst
+func safeJoin(dst, name string) (string, error) {
+	root := filepath.Clean(dst)
+	target := filepath.Join(root, name)
+	if target != root && !strings.HasPrefix(target, root+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal file path %q", name)
+	}
+	return target, nil
+}
+
+func writeFile(target string, r io.Reader, mode os.FileMode) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	if mode&os.ModePerm == 0 {
+		mode = 0644
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode&os.ModePerm)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// Archives often wrap the model in a single top level folder. Move its contents up into dst.
+func flattenSingleFolder(dst string) error {
+	if _, err := os.Stat(filepath.Join(dst, config.CONFIG_FILENAME)); err == nil {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(dst)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return nil
+	}
+	tmp := filepath.Join(dst, ".flatten-"+entries[0].Name())
+	if err := os.Rename(filepath.Join(dst, entries[0].Name()), tmp); err != nil {
+		return err
+	}
+	children, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := os.Rename(filepath.Join(tmp, child.Name()), filepath.Join(dst, child.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(tmp)
+}
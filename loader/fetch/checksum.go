@@ -0,0 +1,57 @@
+package fetch
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+const (
+	CHECKSUM_SHA256 = "sha256"
+	CHECKSUM_MD5    = "md5"
+)
+
+type Checksum struct {
+	Algorithm string
+	Value     []byte
+}
+
+// Parse a checksum in the form <algorithm>:<hex digest>. A digest without an algorithm is treated as sha256.
+func ParseChecksum(s string) (*Checksum, error) {
+	algorithm := CHECKSUM_SHA256
+	digest := s
+	if i := strings.Index(s, ":"); i >= 0 {
+		algorithm = strings.ToLower(s[:i])
+		digest = s[i+1:]
+	}
+	if algorithm != CHECKSUM_SHA256 && algorithm != CHECKSUM_MD5 {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	value, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum %q: %v", s, err)
+	}
+	return &Checksum{Algorithm: algorithm, Value: value}, nil
+}
+
+func (c *Checksum) NewHash() hash.Hash {
+	if c.Algorithm == CHECKSUM_MD5 {
+		return md5.New()
+	}
+	return sha256.New()
+}
+
+func (c *Checksum) Verify(h hash.Hash) error {
+	sum := h.Sum(nil)
+	if hex.EncodeToString(sum) != hex.EncodeToString(c.Value) {
+		return fmt.Errorf("%s checksum mismatch: expected %x got %x", c.Algorithm, c.Value, sum)
+	}
+	return nil
+}
+
+func (c *Checksum) String() string {
+	return fmt.Sprintf("%s:%x", c.Algorithm, c.Value)
+}
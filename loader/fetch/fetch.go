@@ -0,0 +1,73 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Fetcher downloads a model into a local folder
+type Fetcher interface {
+	Fetch(ctx context.Context, req *Request) error
+}
+
+type Request struct {
+	Uri *url.URL
+	// Folder to place model files into
+	Dst string
+	// Optional checksum to verify archive downloads against
+	Checksum *Checksum
+	// Optional writer to report bytes fetched to
+	Progress io.Writer
+}
+
+// Wrap a source reader so bytes read are reported to the request progress writer
+func (r *Request) track(src io.Reader) io.Reader {
+	if r.Progress == nil {
+		return src
+	}
+	return io.TeeReader(src, r.Progress)
+}
+
+// Registry of fetchers for each supported uri scheme
+type Registry struct {
+	log      logr.Logger
+	fetchers map[string]Fetcher
+}
+
+func NewRegistry(log logr.Logger) *Registry {
+	return &Registry{
+		log:      log.WithName("Fetch"),
+		fetchers: make(map[string]Fetcher),
+	}
+}
+
+func (r *Registry) Register(scheme string, fetcher Fetcher) {
+	r.fetchers[scheme] = fetcher
+}
+
+func (r *Registry) Fetch(ctx context.Context, req *Request) error {
+	fetcher, ok := r.fetchers[req.Uri.Scheme]
+	if !ok {
+		return fmt.Errorf("no fetcher for uri scheme %q", req.Uri.Scheme)
+	}
+	r.log.Info("Fetching model", "uri", req.Uri.String(), "dst", req.Dst)
+	return fetcher.Fetch(ctx, req)
+}
+
+// Get a model name from the last part of the uri path with any archive extension removed
+func ModelNameFromUri(uri *url.URL) string {
+	p := uri.Path
+	if p == "" {
+		p = uri.Opaque
+	}
+	name := path.Base(strings.TrimSuffix(p, "/"))
+	if ext := archiveExtension(name); ext != "" {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
@@ -0,0 +1,257 @@
+package fetch
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testModel = map[string]string{
+	"config.pbtxt":     "name: \"simple\"",
+	"1/model.graphdef": "graph",
+}
+
+func tarGz(g *gomega.GomegaWithT, files map[string]string, prefix string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{Name: prefix + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		g.Expect(err).Should(gomega.BeNil())
+		_, err = tw.Write([]byte(content))
+		g.Expect(err).Should(gomega.BeNil())
+	}
+	g.Expect(tw.Close()).Should(gomega.BeNil())
+	g.Expect(gz.Close()).Should(gomega.BeNil())
+	return buf.Bytes()
+}
+
+func zipArchive(g *gomega.GomegaWithT, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		g.Expect(err).Should(gomega.BeNil())
+		_, err = w.Write([]byte(content))
+		g.Expect(err).Should(gomega.BeNil())
+	}
+	g.Expect(zw.Close()).Should(gomega.BeNil())
+	return buf.Bytes()
+}
+
+func expectModel(g *gomega.GomegaWithT, dst string) {
+	for name, content := range testModel {
+		data, err := ioutil.ReadFile(path.Join(dst, name))
+		g.Expect(err).Should(gomega.BeNil())
+		g.Expect(string(data)).Should(gomega.Equal(content))
+	}
+}
+
+func tempDir(g *gomega.GomegaWithT) string {
+	dir, err := ioutil.TempDir("", "fetch")
+	g.Expect(err).Should(gomega.BeNil())
+	return dir
+}
+
+func TestHttpFetchTarGz(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	archive := tarGz(g, testModel, "simple/")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	dst := tempDir(g)
+	defer os.RemoveAll(dst)
+
+	sum := sha256.Sum256(archive)
+	checksum, err := ParseChecksum("sha256:" + hex.EncodeToString(sum[:]))
+	g.Expect(err).Should(gomega.BeNil())
+	uri, _ := url.Parse(server.URL + "/models/simple.tar.gz")
+	g.Expect(ModelNameFromUri(uri)).Should(gomega.Equal("simple"))
+
+	err = NewHttpFetcher(server.Client()).Fetch(context.Background(), &Request{Uri: uri, Dst: dst, Checksum: checksum})
+	g.Expect(err).Should(gomega.BeNil())
+	expectModel(g, dst)
+}
+
+func TestHttpFetchChecksumMismatch(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	archive := zipArchive(g, testModel)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	dst := tempDir(g)
+	defer os.RemoveAll(dst)
+
+	checksum, err := ParseChecksum(strings.Repeat("0", 64))
+	g.Expect(err).Should(gomega.BeNil())
+	uri, _ := url.Parse(server.URL + "/download")
+	err = NewHttpFetcher(server.Client()).Fetch(context.Background(), &Request{Uri: uri, Dst: dst, Checksum: checksum})
+	g.Expect(err).ShouldNot(gomega.BeNil())
+	g.Expect(err.Error()).Should(gomega.ContainSubstring("checksum mismatch"))
+}
+
+func TestArchivePathTraversal(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	dst := tempDir(g)
+	defer os.RemoveAll(dst)
+
+	archive := tarGz(g, map[string]string{"../escape": "x"}, "")
+	err := extractArchive(bytes.NewReader(archive), ARCHIVE_TAR_GZ, dst, nil)
+	g.Expect(err).ShouldNot(gomega.BeNil())
+}
+
+func TestFileFetch(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	src := tempDir(g)
+	defer os.RemoveAll(src)
+	for name, content := range testModel {
+		_, err := writeFile(path.Join(src, name), strings.NewReader(content), 0644)
+		g.Expect(err).Should(gomega.BeNil())
+	}
+	dst := tempDir(g)
+	defer os.RemoveAll(dst)
+
+	registry := NewRegistry(logf.Log)
+	registry.Register("file", NewFileFetcher())
+	err := registry.Fetch(context.Background(), &Request{Uri: &url.URL{Scheme: "file", Path: src}, Dst: path.Join(dst, "simple")})
+	g.Expect(err).Should(gomega.BeNil())
+	expectModel(g, path.Join(dst, "simple"))
+}
+
+// Fake GCS JSON API serving objects from a single bucket
+func fakeGcs(bucket string, objects map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := "/storage/v1/b/" + bucket + "/o"
+		if r.URL.Path == base {
+			list := gcsObjectList{}
+			for name, content := range objects {
+				if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+					sum := md5.Sum([]byte(content))
+					list.Items = append(list.Items, gcsObject{Name: name, Md5Hash: base64.StdEncoding.EncodeToString(sum[:])})
+				}
+			}
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+		if content, ok := objects[strings.TrimPrefix(r.URL.Path, base+"/")]; ok && r.URL.Query().Get("alt") == "media" {
+			w.Write([]byte(content))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func TestGcsFetch(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	objects := map[string]string{"other/config.pbtxt": "other"}
+	for name, content := range testModel {
+		objects["models/simple/"+name] = content
+	}
+	server := fakeGcs("bucket", objects)
+	defer server.Close()
+
+	dst := tempDir(g)
+	defer os.RemoveAll(dst)
+
+	uri, _ := url.Parse("gs://bucket/models/simple")
+	err := NewGcsFetcher(server.Client(), server.URL).Fetch(context.Background(), &Request{Uri: uri, Dst: dst})
+	g.Expect(err).Should(gomega.BeNil())
+	expectModel(g, dst)
+	_, err = os.Stat(path.Join(dst, "config.pbtxt"))
+	g.Expect(err).Should(gomega.BeNil())
+}
+
+// Minimal MinIO-like fake supporting path style ListObjectsV2 and GetObject
+func fakeS3(bucket string, objects map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/"+bucket+"/" || r.URL.Path == "/"+bucket {
+			prefix := r.URL.Query().Get("prefix")
+			var keys []string
+			for key := range objects {
+				if strings.HasPrefix(key, prefix) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>%s</Name><Prefix>%s</Prefix><KeyCount>%d</KeyCount><MaxKeys>1000</MaxKeys><IsTruncated>false</IsTruncated>`, bucket, prefix, len(keys))
+			for _, key := range keys {
+				sum := md5.Sum([]byte(objects[key]))
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><LastModified>2020-01-01T00:00:00.000Z</LastModified><ETag>"%x"</ETag><Size>%d</Size><StorageClass>STANDARD</StorageClass></Contents>`, key, sum, len(objects[key]))
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+		if content, ok := objects[strings.TrimPrefix(r.URL.Path, "/"+bucket+"/")]; ok {
+			sum := md5.Sum([]byte(content))
+			w.Header().Set("ETag", fmt.Sprintf("\"%x\"", sum))
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+			w.Write([]byte(content))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+	}))
+}
+
+func TestS3Fetch(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	objects := map[string]string{}
+	for name, content := range testModel {
+		objects["models/simple/"+name] = content
+	}
+	server := fakeS3("bucket", objects)
+	defer server.Close()
+
+	dst := tempDir(g)
+	defer os.RemoveAll(dst)
+
+	fetcher, err := NewS3Fetcher(strings.TrimPrefix(server.URL, "http://"), "key", "secret", false, "")
+	g.Expect(err).Should(gomega.BeNil())
+	uri, _ := url.Parse("s3://bucket/models/simple")
+	err = fetcher.Fetch(context.Background(), &Request{Uri: uri, Dst: dst})
+	g.Expect(err).Should(gomega.BeNil())
+	expectModel(g, dst)
+}
+
+func TestS3FetchArchive(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	server := fakeS3("bucket", map[string]string{"simple.tar.gz": string(tarGz(g, testModel, ""))})
+	defer server.Close()
+
+	dst := tempDir(g)
+	defer os.RemoveAll(dst)
+
+	fetcher, err := NewS3Fetcher(strings.TrimPrefix(server.URL, "http://"), "key", "secret", false, "")
+	g.Expect(err).Should(gomega.BeNil())
+	uri, _ := url.Parse("s3://bucket/simple.tar.gz")
+	err = fetcher.Fetch(context.Background(), &Request{Uri: uri, Dst: dst})
+	g.Expect(err).Should(gomega.BeNil())
+	expectModel(g, dst)
+}
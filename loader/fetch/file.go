@@ -0,0 +1,49 @@
+package fetch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Fetch models from a local folder or archive
+type FileFetcher struct{}
+
+func NewFileFetcher() *FileFetcher {
+	return &FileFetcher{}
+}
+
+func (f *FileFetcher) Fetch(ctx context.Context, req *Request) error {
+	src := req.Uri.Path
+	if ext := archiveExtension(src); ext != "" {
+		file, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return extractArchive(req.track(file), ext, req.Dst, req.Checksum)
+	}
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(req.Dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = writeFile(target, req.track(file), info.Mode())
+		return err
+	})
+}
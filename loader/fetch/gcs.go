@@ -0,0 +1,166 @@
+package fetch
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	GCS_ENDPOINT     = "https://storage.googleapis.com"
+	gcsReadOnlyScope = "https://www.googleapis.com/auth/devstorage.read_only"
+)
+
+// Fetch models from Google Cloud Storage using the JSON API
+type GcsFetcher struct {
+	client   *http.Client
+	endpoint string
+}
+
+type gcsObject struct {
+	Name    string `json:"name"`
+	Md5Hash string `json:"md5Hash"`
+}
+
+type gcsObjectList struct {
+	Items         []gcsObject `json:"items"`
+	NextPageToken string      `json:"nextPageToken"`
+}
+
+func NewGcsFetcher(client *http.Client, endpoint string) *GcsFetcher {
+	if endpoint == "" {
+		endpoint = GCS_ENDPOINT
+	}
+	return &GcsFetcher{
+		client:   client,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+	}
+}
+
+// Create an http client using the default Google credentials or an anonymous client if there are none
+func NewGcsHttpClient(ctx context.Context, log logr.Logger) *http.Client {
+	creds, err := google.FindDefaultCredentials(ctx, gcsReadOnlyScope)
+	if err != nil {
+		log.Info("No Google credentials found, using anonymous access to GCS")
+		return http.DefaultClient
+	}
+	return oauth2.NewClient(ctx, creds.TokenSource)
+}
+
+func (g *GcsFetcher) Fetch(ctx context.Context, req *Request) error {
+	bucket := req.Uri.Host
+	prefix := strings.TrimPrefix(req.Uri.Path, "/")
+
+	if ext := archiveExtension(prefix); ext != "" {
+		body, err := g.getObject(ctx, bucket, prefix)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		return extractArchive(req.track(body), ext, req.Dst, req.Checksum)
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+	objects, err := g.listObjects(ctx, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no objects found at %s", req.Uri.String())
+	}
+	for _, object := range objects {
+		if strings.HasSuffix(object.Name, "/") {
+			continue
+		}
+		if err := g.fetchObject(ctx, bucket, prefix, object, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GcsFetcher) fetchObject(ctx context.Context, bucket, prefix string, object gcsObject, req *Request) error {
+	target, err := safeJoin(req.Dst, strings.TrimPrefix(object.Name, prefix))
+	if err != nil {
+		return err
+	}
+	body, err := g.getObject(ctx, bucket, object.Name)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	r := req.track(body)
+	h := md5.New()
+	if object.Md5Hash != "" {
+		r = io.TeeReader(r, h)
+	}
+	if _, err := writeFile(target, r, 0644); err != nil {
+		return err
+	}
+	if object.Md5Hash != "" {
+		if sum := base64.StdEncoding.EncodeToString(h.Sum(nil)); sum != object.Md5Hash {
+			return fmt.Errorf("md5 mismatch for gs://%s/%s: expected %s got %s", bucket, object.Name, object.Md5Hash, sum)
+		}
+	}
+	return nil
+}
+
+func (g *GcsFetcher) listObjects(ctx context.Context, bucket, prefix string) ([]gcsObject, error) {
+	var objects []gcsObject
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("prefix", prefix)
+		query.Set("fields", "items(name,md5Hash),nextPageToken")
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		body, err := g.get(ctx, fmt.Sprintf("%s/storage/v1/b/%s/o?%s", g.endpoint, url.PathEscape(bucket), query.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		list := gcsObjectList{}
+		err = json.NewDecoder(body).Decode(&list)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, list.Items...)
+		if list.NextPageToken == "" {
+			return objects, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+func (g *GcsFetcher) getObject(ctx context.Context, bucket, name string) (io.ReadCloser, error) {
+	return g.get(ctx, fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", g.endpoint, url.PathEscape(bucket), url.PathEscape(name)))
+}
+
+func (g *GcsFetcher) get(ctx context.Context, u string) (io.ReadCloser, error) {
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := g.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("GCS request %s failed: %s", u, response.Status)
+	}
+	return response.Body, nil
+}
@@ -0,0 +1,45 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Fetch model archives (tar, tar.gz or zip) over http(s)
+type HttpFetcher struct {
+	client *http.Client
+}
+
+func NewHttpFetcher(client *http.Client) *HttpFetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HttpFetcher{
+		client: client,
+	}
+}
+
+func (h *HttpFetcher) Fetch(ctx context.Context, req *Request) error {
+	request, err := http.NewRequest("GET", req.Uri.String(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := h.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", req.Uri.String(), response.Status)
+	}
+
+	ext := archiveExtension(req.Uri.Path)
+	if ext == "" {
+		ext = archiveExtensionFromContentType(response.Header.Get("Content-Type"))
+	}
+	if ext == "" {
+		return fmt.Errorf("%s is not a tar or zip archive", req.Uri.String())
+	}
+	return extractArchive(req.track(response.Body), ext, req.Dst, req.Checksum)
+}
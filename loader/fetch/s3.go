@@ -0,0 +1,121 @@
+package fetch
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/minio/minio-go"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	S3_ENDPOINT        = "s3.amazonaws.com"
+	S3_REGION          = "us-east-1"
+	ENV_S3_ENDPOINT    = "S3_ENDPOINT"
+	ENV_S3_USE_HTTPS   = "S3_USE_HTTPS"
+	ENV_AWS_REGION     = "AWS_REGION"
+	ENV_AWS_ACCESS_KEY = "AWS_ACCESS_KEY_ID"
+	ENV_AWS_SECRET_KEY = "AWS_SECRET_ACCESS_KEY"
+)
+
+// Fetch models from S3 compatible object storage
+type S3Fetcher struct {
+	client *minio.Client
+}
+
+func NewS3Fetcher(endpoint string, accessKey, secretKey string, secure bool, region string) (*S3Fetcher, error) {
+	if endpoint == "" {
+		endpoint = S3_ENDPOINT
+	}
+	if region == "" {
+		region = S3_REGION
+	}
+	client, err := minio.NewWithRegion(endpoint, accessKey, secretKey, secure, region)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Fetcher{
+		client: client,
+	}, nil
+}
+
+// Create an S3 fetcher configured from the same environment variables as the KFServing storage initializer
+func NewS3FetcherFromEnv() (*S3Fetcher, error) {
+	endpoint := os.Getenv(ENV_S3_ENDPOINT)
+	secure := os.Getenv(ENV_S3_USE_HTTPS) != "0"
+	if strings.HasPrefix(endpoint, "http://") {
+		secure = false
+	}
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "https://"), "http://")
+	return NewS3Fetcher(endpoint, os.Getenv(ENV_AWS_ACCESS_KEY), os.Getenv(ENV_AWS_SECRET_KEY), secure, os.Getenv(ENV_AWS_REGION))
+}
+
+func (s *S3Fetcher) Fetch(ctx context.Context, req *Request) error {
+	bucket := req.Uri.Host
+	prefix := strings.TrimPrefix(req.Uri.Path, "/")
+
+	if ext := archiveExtension(prefix); ext != "" {
+		object, err := s.client.GetObjectWithContext(ctx, bucket, prefix, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		defer object.Close()
+		return extractArchive(req.track(object), ext, req.Dst, req.Checksum)
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+	done := make(chan struct{})
+	defer close(done)
+	found := false
+	for info := range s.client.ListObjectsV2(bucket, prefix, true, done) {
+		if info.Err != nil {
+			return info.Err
+		}
+		if strings.HasSuffix(info.Key, "/") {
+			continue
+		}
+		found = true
+		if err := s.fetchObject(ctx, bucket, prefix, info, req); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("no objects found at %s", req.Uri.String())
+	}
+	return nil
+}
+
+func (s *S3Fetcher) fetchObject(ctx context.Context, bucket, prefix string, info minio.ObjectInfo, req *Request) error {
+	target, err := safeJoin(req.Dst, strings.TrimPrefix(info.Key, prefix))
+	if err != nil {
+		return err
+	}
+	object, err := s.client.GetObjectWithContext(ctx, bucket, info.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	// The ETag is the md5 of the object unless it was a multipart upload
+	etag := strings.Trim(info.ETag, "\"")
+	verify := len(etag) == 32 && !strings.Contains(etag, "-")
+	r := req.track(object)
+	h := md5.New()
+	if verify {
+		r = io.TeeReader(r, h)
+	}
+	if _, err := writeFile(target, r, 0644); err != nil {
+		return err
+	}
+	if verify {
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != etag {
+			return fmt.Errorf("md5 mismatch for s3://%s/%s: expected %s got %s", bucket, info.Key, etag, sum)
+		}
+	}
+	return nil
+}
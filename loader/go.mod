@@ -3,7 +3,18 @@ module github.com/seldonio/trtis-scheduler/loader
 go 1.12
 
 require (
+	github.com/go-ini/ini v1.67.0 // indirect
 	github.com/go-logr/logr v0.1.0
+	github.com/golang/protobuf v1.3.2
+	github.com/minio/minio-go v6.0.14+incompatible
+	github.com/onsi/gomega v1.7.0
 	github.com/otiai10/copy v1.0.2
+	github.com/seldonio/trtis-scheduler/common v0.0.0
+	golang.org/x/oauth2 v0.0.0-20191202225959-858c2ad4c8b6
+	k8s.io/api v0.17.0
+	k8s.io/apimachinery v0.17.0
+	k8s.io/client-go v0.17.0
 	sigs.k8s.io/controller-runtime v0.4.0
 )
+
+replace github.com/seldonio/trtis-scheduler/common => ../common
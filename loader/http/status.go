@@ -3,53 +3,122 @@ package http
 import (
 	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/golang/protobuf/proto"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"io/ioutil"
 	"net/http"
 	"time"
 )
 
 type ModelStatus struct {
-	log logr.Logger
-	url string
+	log       logr.Logger
+	url       string
+	modelName string
+	timeout   time.Duration
 }
 
-func NewModelStatus(host string, port int, modelName string, log logr.Logger) *ModelStatus {
+// Error returned when TRTIS reports the model failed to load
+type ModelLoadError struct {
+	ModelName string
+	Reason    string
+}
+
+func (e *ModelLoadError) Error() string {
+	return fmt.Sprintf("model %s failed to load: %s", e.ModelName, e.Reason)
+}
+
+// Create a model status checker. A zero timeout waits forever for the model to load.
+func NewModelStatus(host string, port int, modelName string, timeout time.Duration, log logr.Logger) *ModelStatus {
 	url := fmt.Sprintf("http://%s:%d/api/status/%s", host, port, modelName)
 	return &ModelStatus{
-		log: log,
-		url: url,
+		log:       log,
+		url:       url,
+		modelName: modelName,
+		timeout:   timeout,
 	}
 }
 
-func (m *ModelStatus) isModelLoaded() (bool, error) {
+// Get the status of the model from the server. Returns nil if the server does not know the model yet.
+func (m *ModelStatus) GetModelStatus() (*trtis.ModelStatus, error) {
 	request, err := http.NewRequest("GET", m.url, nil)
 	if err != nil {
 		m.log.Error(err, "Failed to create request")
-		return false, err
+		return nil, err
 	}
 	response, err := http.DefaultClient.Do(request)
 	if err != nil {
 		m.log.Error(err, "Status call failed")
-		return false, err
+		return nil, err
 	}
-	if response.StatusCode == http.StatusOK {
-		return true, nil
-	} else {
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
 		m.log.Info("Model not loaded", "status", response.StatusCode)
-		return false, nil
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	serverStatus := &trtis.ServerStatus{}
+	if err := proto.UnmarshalText(string(body), serverStatus); err != nil {
+		return nil, err
+	}
+	return serverStatus.ModelStatus[m.modelName], nil
+}
+
+// Check whether a version of the model is ready, or any version if version is negative.
+// Returns a ModelLoadError if the version, or every version, has failed to load.
+func (m *ModelStatus) isModelLoaded(version int64) (bool, error) {
+	status, err := m.GetModelStatus()
+	if err != nil || status == nil {
+		return false, err
+	}
+	failed := ""
+	pending := false
+	for v, versionStatus := range status.VersionStatus {
+		if version >= 0 && v != version {
+			continue
+		}
+		switch versionStatus.ReadyState {
+		case trtis.ModelReadyState_MODEL_READY:
+			return true, nil
+		case trtis.ModelReadyState_MODEL_UNAVAILABLE:
+			if reason := versionStatus.GetReadyStateReason().GetMessage(); reason != "" {
+				failed = fmt.Sprintf("version %d: %s", v, reason)
+			}
+		default:
+			pending = true
+		}
+	}
+	if failed != "" && !pending {
+		return false, &ModelLoadError{ModelName: m.modelName, Reason: failed}
 	}
+	m.log.Info("Model not loaded", "versions", len(status.VersionStatus))
+	return false, nil
 }
 
 func (m *ModelStatus) WaitForModelLoaded() error {
+	return m.WaitForVersionLoaded(-1)
+}
+
+// Wait for a version of the model to be ready, or any version if version is negative
+func (m *ModelStatus) WaitForVersionLoaded(version int64) error {
+	start := time.Now()
 	ok := false
 	var err error
 	for !ok {
-		ok, err = m.isModelLoaded()
+		ok, err = m.isModelLoaded(version)
 		if err != nil {
 			m.log.Error(err, "Failed to get model status")
 			return err
 		}
-		time.Sleep(time.Second * 2)
+		if !ok {
+			if m.timeout > 0 && time.Since(start) > m.timeout {
+				return fmt.Errorf("timed out after %s waiting for model %s to load", m.timeout, m.modelName)
+			}
+			time.Sleep(time.Second * 2)
+		}
 	}
-	m.log.Info("Model loaded")
+	m.log.Info("Model loaded", "version", version)
 	return nil
 }
@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"encoding/json"
+	"github.com/go-logr/logr"
+	"github.com/seldonio/trtis-scheduler/common/events"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"os"
+	"strings"
+)
+
+const (
+	POD_NAME_ENV      = "POD_NAME"
+	POD_NAMESPACE_ENV = "POD_NAMESPACE"
+	NODE_NAME_ENV     = "NODE_NAME"
+)
+
+type K8sManager struct {
+	log          logr.Logger
+	client       *kubernetes.Clientset
+	podName      string
+	podNamespace string
+	recorder     *events.Recorder
+}
+
+func NewK8sManager(log logr.Logger) (*K8sManager, error) {
+	podName := os.Getenv(POD_NAME_ENV)
+	if podName == "" {
+		log.Info("Failed to find pod name from environment", "env name", POD_NAME_ENV)
+		return nil, nil
+	}
+	podNamespace := os.Getenv(POD_NAMESPACE_ENV)
+	if podNamespace == "" {
+		log.Info("Failed to find pod namespace from environment", "env name", POD_NAMESPACE_ENV)
+		return nil, nil
+	}
+	client, err := getK8sClient(log)
+	if client == nil || err != nil {
+		return nil, err
+	} else {
+		return &K8sManager{
+			log:          log,
+			client:       client,
+			podName:      podName,
+			podNamespace: podNamespace,
+			recorder:     newEventRecorder(client),
+		}, nil
+	}
+}
+
+func getK8sClient(log logr.Logger) (*kubernetes.Clientset, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.Error(err, "failed to get in cluster config")
+		return nil, nil
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Error(err, "Failed to get k8s clientset")
+		return nil, err
+	}
+
+	return clientset, nil
+}
+
+func (k *K8sManager) GetPod() (*v1.Pod, error) {
+	return k.client.CoreV1().Pods(k.podNamespace).Get(k.podName, metav1.GetOptions{})
+}
+
+// Merge the given annotations into those on this pod
+func (k *K8sManager) PatchPodAnnotations(annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k.client.CoreV1().Pods(k.podNamespace).Patch(k.podName, types.MergePatchType, patch)
+	if err != nil {
+		k.log.Error(err, "Failed to patch pod annotations", "pod", k.podName, "namespace", k.podNamespace)
+	}
+	return err
+}
+
+// Get the name of the Deployment owning a pod from its ReplicaSet owner reference.
+// Falls back to the ReplicaSet name or the pod name if the pod is not owned by a Deployment.
+func GetDeploymentName(pod *v1.Pod) string {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "ReplicaSet" {
+			if hash := pod.Labels["pod-template-hash"]; hash != "" {
+				return strings.TrimSuffix(owner.Name, "-"+hash)
+			}
+			return owner.Name
+		}
+	}
+	return pod.Name
+}
@@ -0,0 +1,33 @@
+package k8s
+
+import (
+	"github.com/seldonio/trtis-scheduler/common/events"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"os"
+	"time"
+)
+
+const (
+	EVENT_SOURCE        = "trtis-loader"
+	EVENT_FLUSH_TIMEOUT = 5 * time.Second // Longest wait for the last events to be written before exiting
+)
+
+func newEventRecorder(client kubernetes.Interface) *events.Recorder {
+	return events.NewEventRecorder(client.CoreV1().Events(""), v1.EventSource{Component: EVENT_SOURCE, Host: os.Getenv(NODE_NAME_ENV)})
+}
+
+// Record an event on this pod
+func (k *K8sManager) EmitEvent(eventType, reason, message string) error {
+	pod, err := k.GetPod()
+	if err != nil {
+		return err
+	}
+	k.recorder.Event(pod, eventType, reason, message)
+	return nil
+}
+
+// Wait for the pod's events to be written, the loader exits once the model is loaded
+func (k *K8sManager) FlushEvents() {
+	k.recorder.Flush(EVENT_FLUSH_TIMEOUT)
+}
@@ -0,0 +1,15 @@
+package k8s
+
+import (
+	"github.com/seldonio/trtis-scheduler/common/cache"
+	"k8s.io/api/core/v1"
+)
+
+// The ownership marker recording the pod as the owner of the models it installs
+func NewModelOwner(pod *v1.Pod) *cache.ModelOwner {
+	return &cache.ModelOwner{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		UID:       string(pod.UID),
+	}
+}
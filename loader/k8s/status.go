@@ -0,0 +1,148 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sync"
+	"time"
+)
+
+const (
+	ANNOTATION_LOADER_PHASE   = "seldon.io/trtis-loader-phase"
+	ANNOTATION_LOADER_BYTES   = "seldon.io/trtis-loader-bytes"
+	ANNOTATION_LOADER_MESSAGE = "seldon.io/trtis-loader-message"
+	ANNOTATION_LOADER_UPDATED = "seldon.io/trtis-loader-updated"
+
+	CONDITION_MODEL_LOADED v1.PodConditionType = "seldon.io/trtis-model-loaded"
+
+	PHASE_FETCHING          = "fetching"
+	PHASE_VALIDATING        = "validating"
+	PHASE_INSTALLING        = "installing"
+	PHASE_WAITING_FOR_READY = "waiting-for-ready"
+	PHASE_READY             = "ready"
+	PHASE_FAILED            = "failed"
+)
+
+// Reports loader progress onto the pod annotations and a pod condition.
+// Byte counts are written through the reporter and patched at most once per interval.
+type StatusReporter struct {
+	manager    *K8sManager
+	log        logr.Logger
+	interval   time.Duration
+	mu         sync.Mutex
+	phase      string
+	bytes      int64
+	lastReport time.Time
+}
+
+// Create a status reporter. If manager is nil progress is only logged.
+func NewStatusReporter(manager *K8sManager, interval time.Duration, log logr.Logger) *StatusReporter {
+	return &StatusReporter{
+		manager:  manager,
+		log:      log.WithName("StatusReporter"),
+		interval: interval,
+	}
+}
+
+// Count bytes copied, implementing io.Writer so it can be used as a progress sink
+func (s *StatusReporter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes += int64(len(p))
+	if time.Since(s.lastReport) >= s.interval {
+		s.report(s.phase, fmt.Sprintf("%d bytes copied", s.bytes))
+	}
+	return len(p), nil
+}
+
+func (s *StatusReporter) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+func (s *StatusReporter) SetPhase(phase, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phase = phase
+	s.report(phase, message)
+}
+
+// Mark the model as loaded on the TRTIS server
+func (s *StatusReporter) Ready(message string) {
+	s.SetPhase(PHASE_READY, message)
+	s.setCondition(v1.ConditionTrue, "ModelLoaded", message)
+	s.emitEvent(v1.EventTypeNormal, "ModelLoaded", message)
+}
+
+// Mark the model as failed to load
+func (s *StatusReporter) Failed(err error) {
+	s.SetPhase(PHASE_FAILED, err.Error())
+	s.setCondition(v1.ConditionFalse, "ModelLoadFailed", err.Error())
+	s.emitEvent(v1.EventTypeWarning, "ModelLoadFailed", err.Error())
+}
+
+// Record the outcome of the load as a pod event
+func (s *StatusReporter) emitEvent(eventType, reason, message string) {
+	if s.manager == nil {
+		return
+	}
+	if err := s.manager.EmitEvent(eventType, reason, message); err != nil {
+		s.log.Error(err, "Failed to emit event", "reason", reason)
+	}
+}
+
+// Write the events recorded so far, called once as the loader exits
+func (s *StatusReporter) FlushEvents() {
+	if s.manager != nil {
+		s.manager.FlushEvents()
+	}
+}
+
+// Patch the pod annotations. Must be called with the lock held.
+func (s *StatusReporter) report(phase, message string) {
+	s.lastReport = time.Now()
+	s.log.Info("Loader status", "phase", phase, "bytes", s.bytes, "message", message)
+	if s.manager == nil {
+		return
+	}
+	_ = s.manager.PatchPodAnnotations(map[string]string{
+		ANNOTATION_LOADER_PHASE:   phase,
+		ANNOTATION_LOADER_BYTES:   fmt.Sprintf("%d", s.bytes),
+		ANNOTATION_LOADER_MESSAGE: message,
+		ANNOTATION_LOADER_UPDATED: s.lastReport.UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *StatusReporter) setCondition(status v1.ConditionStatus, reason, message string) {
+	if s.manager == nil {
+		return
+	}
+	if err := s.manager.PatchPodCondition(v1.PodCondition{
+		Type:               CONDITION_MODEL_LOADED,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	}); err != nil {
+		s.log.Error(err, "Failed to set pod condition", "type", CONDITION_MODEL_LOADED)
+	}
+}
+
+// Add or replace a condition in the pod status
+func (k *K8sManager) PatchPodCondition(condition v1.PodCondition) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []v1.PodCondition{condition},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k.client.CoreV1().Pods(k.podNamespace).Patch(k.podName, types.StrategicMergePatchType, patch, "status")
+	return err
+}
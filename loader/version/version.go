@@ -0,0 +1,83 @@
+package version
+
+import (
+	"fmt"
+	"github.com/otiai10/copy"
+	"github.com/seldonio/trtis-scheduler/loader/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Get the numeric version folders of a model
+func ListVersions(modelDir string) ([]int64, error) {
+	entries, err := ioutil.ReadDir(modelDir)
+	if err != nil {
+		return nil, err
+	}
+	var versions []int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if v, err := strconv.ParseInt(entry.Name(), 10, 64); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// Keep only the newest version folder of a staged model and rename it to the given version
+func RenumberStagedVersion(stagedModel string, version int64) error {
+	versions, err := ListVersions(stagedModel)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("staged model %s has no version folders", stagedModel)
+	}
+	newest := versions[0]
+	for _, v := range versions {
+		if v > newest {
+			newest = v
+		}
+	}
+	for _, v := range versions {
+		if v != newest {
+			if err := os.RemoveAll(filepath.Join(stagedModel, strconv.FormatInt(v, 10))); err != nil {
+				return err
+			}
+		}
+	}
+	if newest == version {
+		return nil
+	}
+	return os.Rename(filepath.Join(stagedModel, strconv.FormatInt(newest, 10)), filepath.Join(stagedModel, strconv.FormatInt(version, 10)))
+}
+
+// Check whether the model is already installed in the model repository
+func ModelInstalled(modelDir string) bool {
+	_, err := os.Stat(filepath.Join(modelDir, config.CONFIG_FILENAME))
+	return err == nil
+}
+
+// Add a version folder from a staged model to a model already in the repository which was not
+// installed from a model cache. The folder is copied under a non numeric name which TRTIS ignores and then renamed
+// so TRTIS only loads the version once it is complete.
+func InstallVersion(stagedModel, modelDir string, version int64) error {
+	name := strconv.FormatInt(version, 10)
+	dst := filepath.Join(modelDir, name)
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("version %d of model %s already exists", version, filepath.Base(modelDir))
+	}
+	tmp := filepath.Join(modelDir, ".tmp-"+name)
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := copy.Copy(filepath.Join(stagedModel, name), tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"github.com/go-logr/logr"
+	"github.com/seldonio/trtis-scheduler/common/events"
+	"github.com/seldonio/trtis-scheduler/monitor/gc"
 	"github.com/seldonio/trtis-scheduler/monitor/k8s"
 	"github.com/seldonio/trtis-scheduler/monitor/metric"
 	"os"
@@ -16,8 +18,33 @@ var (
 	nodeName           = flag.String("node-name", "", "The node name")
 	trtisHost        = flag.String("trtis-host", "0.0.0.0", "TRTIS host")
 	trtisMetricsPort = flag.Int("trtis-http-port", 8002, "TRTIS http port")
+	trtisModelRepo   = flag.String("trtis-model-repo", "", "TRTIS model repository of the node to remove orphaned models from, empty to not remove them")
+	trtisApiPort     = flag.Int("trtis-api-port", 8000, "TRTIS http API port used to find and unload orphaned models")
+	gcInterval       = flag.Duration("gc-interval", time.Minute, "Interval between checks for orphaned models")
+	gcGracePeriod    = flag.Duration("gc-grace-period", 5*time.Minute, "Time a model must be orphaned before it is removed")
 )
 
+// Remove models left in the repository by pods which exited without cleaning up. Returns the
+// recorder of the collector's node events, nil if it is not started.
+func startCollector(stop <-chan struct{}, log logr.Logger) *events.Recorder {
+	if *trtisModelRepo == "" {
+		return nil
+	}
+	client, err := k8s.NewClient(log)
+	if err != nil || client == nil {
+		log.Info("Unable to create k8s client, orphaned models will not be removed")
+		return nil
+	}
+	recorder := k8s.NewEventRecorder(client, *nodeName)
+	node := k8s.NodeReference(*nodeName)
+	record := func(eventType, reason, message string) {
+		recorder.Event(node, eventType, reason, message)
+	}
+	trtisClient := gc.NewTrtisHttpClient(*trtisHost, *trtisApiPort, log)
+	go gc.NewCollector(client, trtisClient, *trtisModelRepo, *gcGracePeriod, record, log).Run(*gcInterval, stop)
+	return recorder
+}
+
 func getTrtisHost(envVar, host string, log logr.Logger) string {
 	envHost := os.Getenv(envVar)
 	if envHost == "" {
@@ -51,6 +78,9 @@ func main() {
 		nodeAnnotator.PatchNodeAnnotation(trtisMetrics.GpuMetrics)
 	}
 
+	stop := make(chan struct{})
+	recorder := startCollector(stop, log)
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
 
@@ -60,7 +90,11 @@ func main() {
 		select {
 		case _ = <-sigs:
 			log.Info("Stopping")
+			close(stop)
 			ticker.Stop()
+			if recorder != nil {
+				recorder.Flush(k8s.EVENT_FLUSH_TIMEOUT)
+			}
 			return
 		case <-ticker.C:
 			err = trtisMetrics.UpdateMetrics()
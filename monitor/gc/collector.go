@@ -0,0 +1,194 @@
+package gc
+
+import (
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/seldonio/trtis-scheduler/common/cache"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"io/ioutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Records events about models removed from the node
+type EventRecorder func(eventType, reason, message string)
+
+// A model folder in the repository
+type model struct {
+	name   string
+	dir    string
+	owner  *cache.ModelOwner
+	loaded bool
+}
+
+// Removes models from a node's TRTIS model repository and TRTIS whose pod no longer exists,
+// as the proxy only removes its model when it exits cleanly. Models are mapped to pods by the
+// ownership marker the loader writes into the model folder. Folders without a marker and models
+// TRTIS has loaded from elsewhere are never removed, as nothing shows they were left behind.
+// A model is only removed once it has been orphaned for the grace period.
+type Collector struct {
+	client      kubernetes.Interface
+	trtis       TrtisClient
+	modelRepo   string
+	gracePeriod time.Duration
+	record      EventRecorder
+	log         logr.Logger
+	orphaned    map[string]time.Time
+}
+
+func NewCollector(client kubernetes.Interface, trtis TrtisClient, modelRepo string, gracePeriod time.Duration, record EventRecorder, log logr.Logger) *Collector {
+	return &Collector{
+		client:      client,
+		trtis:       trtis,
+		modelRepo:   modelRepo,
+		gracePeriod: gracePeriod,
+		record:      record,
+		log:         log.WithName("Collector"),
+		orphaned:    map[string]time.Time{},
+	}
+}
+
+// Check whether the pod owning a model has gone. A pod recreated with the same name has a new UID
+// and a finished pod will not remove its model.
+func (c *Collector) ownerGone(owner *cache.ModelOwner) (bool, error) {
+	pod, err := c.client.CoreV1().Pods(owner.Namespace).Get(owner.Pod, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if string(pod.UID) != owner.UID {
+		return true, nil
+	}
+	return podFinished(pod), nil
+}
+
+func podFinished(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
+
+// List the model folders in the repository, marking those TRTIS has loaded or is loading
+func (c *Collector) listModels() (map[string]*model, error) {
+	entries, err := ioutil.ReadDir(c.modelRepo)
+	if err != nil {
+		return nil, err
+	}
+	models := map[string]*model{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		m := &model{name: entry.Name(), dir: filepath.Join(c.modelRepo, entry.Name())}
+		owner, err := cache.ReadOwner(m.dir)
+		if err != nil && !os.IsNotExist(err) {
+			c.log.Error(err, "Failed to read model owner", "model", m.name)
+			continue
+		}
+		m.owner = owner
+		models[m.name] = m
+	}
+
+	status, err := c.trtis.ServerStatus()
+	if err != nil {
+		c.log.Error(err, "Failed to get TRTIS server status, only checking the model repository")
+		return models, nil
+	}
+	for name, modelStatus := range status.GetModelStatus() {
+		for _, versionStatus := range modelStatus.GetVersionStatus() {
+			if versionStatus.ReadyState == trtis.ModelReadyState_MODEL_READY || versionStatus.ReadyState == trtis.ModelReadyState_MODEL_LOADING {
+				if m, ok := models[name]; ok {
+					m.loaded = true
+				}
+				break
+			}
+		}
+	}
+	return models, nil
+}
+
+// Only a folder whose owner marker names a pod which has gone is orphaned
+func (c *Collector) isOrphan(m *model) (bool, error) {
+	if m.owner == nil {
+		return false, nil
+	}
+	return c.ownerGone(m.owner)
+}
+
+// Find orphaned models and remove those orphaned for longer than the grace period
+func (c *Collector) Collect() error {
+	models, err := c.listModels()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for name, m := range models {
+		orphan, err := c.isOrphan(m)
+		if err != nil {
+			c.log.Error(err, "Failed to get model owner", "model", name)
+			continue
+		}
+		if !orphan {
+			delete(c.orphaned, name)
+			continue
+		}
+		since, ok := c.orphaned[name]
+		if !ok {
+			c.log.Info("Found orphaned model", "model", name, "gracePeriod", c.gracePeriod)
+			c.orphaned[name] = now
+			since = now
+		}
+		if now.Sub(since) < c.gracePeriod {
+			continue
+		}
+		c.remove(m)
+		delete(c.orphaned, name)
+	}
+	// Forget models which have gone by themselves
+	for name := range c.orphaned {
+		if _, ok := models[name]; !ok {
+			delete(c.orphaned, name)
+		}
+	}
+	return nil
+}
+
+// Unload an orphaned model from TRTIS and remove its folder
+func (c *Collector) remove(m *model) {
+	owner := fmt.Sprintf("pod %s/%s which no longer exists", m.owner.Namespace, m.owner.Pod)
+	c.log.Info("Removing orphaned model", "model", m.name, "owner", owner)
+	if m.loaded {
+		// TRTIS polling its repository rejects unloads and unloads the model once its folder is removed
+		if err := c.trtis.UnloadModel(m.name); err != nil {
+			c.log.Error(err, "Failed to unload orphaned model", "model", m.name)
+		}
+	}
+	if err := cache.RemoveModel(m.dir, c.log); err != nil {
+		c.log.Error(err, "Failed to remove orphaned model", "model", m.name)
+		c.record(v1.EventTypeWarning, "OrphanedModelRemoveFailed", fmt.Sprintf("Failed to remove model %s owned by %s: %s", m.name, owner, err))
+		return
+	}
+	c.record(v1.EventTypeNormal, "OrphanedModelRemoved", fmt.Sprintf("Removed model %s owned by %s", m.name, owner))
+}
+
+// Collect every interval until stop is closed
+func (c *Collector) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Collect(); err != nil {
+			c.log.Error(err, "Failed to collect orphaned models", "repo", c.modelRepo)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gc
+
+import (
+	"encoding/json"
+	"github.com/onsi/gomega"
+	"github.com/seldonio/trtis-scheduler/common/cache"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"io/ioutil"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"os"
+	"path/filepath"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"testing"
+	"time"
+)
+
+type fakeTrtis struct {
+	loaded   []string
+	unloaded []string
+}
+
+func (f *fakeTrtis) ServerStatus() (*trtis.ServerStatus, error) {
+	status := &trtis.ServerStatus{ModelStatus: map[string]*trtis.ModelStatus{}}
+	for _, name := range f.loaded {
+		status.ModelStatus[name] = &trtis.ModelStatus{
+			VersionStatus: map[int64]*trtis.ModelVersionStatus{1: {ReadyState: trtis.ModelReadyState_MODEL_READY}},
+		}
+	}
+	return status, nil
+}
+
+func (f *fakeTrtis) UnloadModel(modelName string) error {
+	f.unloaded = append(f.unloaded, modelName)
+	return nil
+}
+
+func installModel(g *gomega.GomegaWithT, repo, modelName string, owner *cache.ModelOwner) {
+	modelDir := filepath.Join(repo, modelName)
+	g.Expect(os.MkdirAll(filepath.Join(modelDir, "1"), 0755)).Should(gomega.BeNil())
+	if owner != nil {
+		data, err := json.Marshal(owner)
+		g.Expect(err).Should(gomega.BeNil())
+		g.Expect(ioutil.WriteFile(filepath.Join(modelDir, cache.OWNER_FILENAME), data, 0644)).Should(gomega.BeNil())
+	}
+}
+
+func repoModels(g *gomega.GomegaWithT, repo string) []string {
+	entries, err := ioutil.ReadDir(repo)
+	g.Expect(err).Should(gomega.BeNil())
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestCollectRemovesOrphanedModels(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	repo, err := ioutil.TempDir("", "repo")
+	g.Expect(err).Should(gomega.BeNil())
+	defer os.RemoveAll(repo)
+
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "live", Namespace: "default", UID: "uid-live"},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "recreated", Namespace: "default", UID: "uid-new"},
+	})
+	installModel(g, repo, "live", &cache.ModelOwner{Namespace: "default", Pod: "live", UID: "uid-live"})
+	installModel(g, repo, "deleted", &cache.ModelOwner{Namespace: "default", Pod: "deleted", UID: "uid-deleted"})
+	installModel(g, repo, "recreated", &cache.ModelOwner{Namespace: "default", Pod: "recreated", UID: "uid-old"})
+	installModel(g, repo, "unowned", nil)
+	trtisClient := &fakeTrtis{loaded: []string{"live", "deleted", "elsewhere"}}
+	var reasons []string
+	record := func(eventType, reason, message string) {
+		reasons = append(reasons, reason)
+	}
+
+	collector := NewCollector(client, trtisClient, repo, time.Hour, record, logf.Log)
+	g.Expect(collector.Collect()).Should(gomega.BeNil())
+	// Orphans are kept for the grace period
+	g.Expect(repoModels(g, repo)).Should(gomega.HaveLen(4))
+	g.Expect(reasons).Should(gomega.BeEmpty())
+
+	// Folders without an owner and models TRTIS loaded from elsewhere are left alone
+	collector.gracePeriod = 0
+	g.Expect(collector.Collect()).Should(gomega.BeNil())
+	g.Expect(repoModels(g, repo)).Should(gomega.ConsistOf("live", "unowned"))
+	g.Expect(trtisClient.unloaded).Should(gomega.ConsistOf("deleted"))
+	g.Expect(reasons).Should(gomega.Equal([]string{"OrphanedModelRemoved", "OrphanedModelRemoved"}))
+}
+
+func TestCollectKeepsModelsOfPodsWithoutAnnotation(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	repo, err := ioutil.TempDir("", "repo")
+	g.Expect(err).Should(gomega.BeNil())
+	defer os.RemoveAll(repo)
+
+	// A running model pod which has not recorded its model, e.g. installed by an older loader
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "model", Namespace: "default", UID: "uid-model"},
+		Spec:       v1.PodSpec{NodeName: "node"},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	})
+	installModel(g, repo, "simple", nil)
+	trtisClient := &fakeTrtis{loaded: []string{"simple"}}
+	var reasons []string
+	record := func(eventType, reason, message string) {
+		reasons = append(reasons, reason)
+	}
+
+	collector := NewCollector(client, trtisClient, repo, 0, record, logf.Log)
+	g.Expect(collector.Collect()).Should(gomega.BeNil())
+	g.Expect(collector.Collect()).Should(gomega.BeNil())
+	g.Expect(repoModels(g, repo)).Should(gomega.ConsistOf("simple"))
+	g.Expect(trtisClient.unloaded).Should(gomega.BeEmpty())
+	g.Expect(reasons).Should(gomega.BeEmpty())
+}
@@ -0,0 +1,80 @@
+package gc
+
+import (
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/golang/protobuf/proto"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const HEADER_STATUS = "NV-Status"
+
+// The TRTIS calls needed to find and unload orphaned models
+type TrtisClient interface {
+	ServerStatus() (*trtis.ServerStatus, error)
+	UnloadModel(modelName string) error
+}
+
+// Client for the TRTIS http API
+type TrtisHttpClient struct {
+	log    logr.Logger
+	url    string
+	client *http.Client
+}
+
+func NewTrtisHttpClient(host string, port int, log logr.Logger) *TrtisHttpClient {
+	return &TrtisHttpClient{
+		log:    log.WithName("TrtisHttpClient"),
+		url:    fmt.Sprintf("http://%s:%d", host, port),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Check the request status TRTIS returns in the NV-Status header
+func checkStatus(response *http.Response) error {
+	requestStatus := &trtis.RequestStatus{}
+	if header := response.Header.Get(HEADER_STATUS); header != "" {
+		if err := proto.UnmarshalText(header, requestStatus); err != nil {
+			return err
+		}
+		if requestStatus.Code != trtis.RequestStatusCode_SUCCESS {
+			return fmt.Errorf("%s: %s", requestStatus.Code, requestStatus.Msg)
+		}
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status %d", response.StatusCode)
+	}
+	return nil
+}
+
+func (t *TrtisHttpClient) ServerStatus() (*trtis.ServerStatus, error) {
+	response, err := t.client.Get(t.url + "/api/status")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if err := checkStatus(response); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	serverStatus := &trtis.ServerStatus{}
+	if err := proto.UnmarshalText(string(body), serverStatus); err != nil {
+		return nil, err
+	}
+	return serverStatus, nil
+}
+
+func (t *TrtisHttpClient) UnloadModel(modelName string) error {
+	response, err := t.client.Post(t.url+"/api/modelcontrol/unload/"+modelName, "", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return checkStatus(response)
+}
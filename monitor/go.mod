@@ -4,11 +4,16 @@ go 1.12
 
 require (
 	github.com/go-logr/logr v0.1.0
+	github.com/golang/protobuf v1.3.2
+	github.com/onsi/gomega v1.7.0
 	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.9.1
+	github.com/seldonio/trtis-scheduler/common v0.0.0
 	k8s.io/api v0.17.0
 	k8s.io/apimachinery v0.17.0
 	k8s.io/client-go v0.17.0
 	kmodules.xyz/client-go v0.0.0-20200201171629-70cdbdd3321b
 	sigs.k8s.io/controller-runtime v0.4.0
 )
+
+replace github.com/seldonio/trtis-scheduler/common => ../common
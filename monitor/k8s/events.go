@@ -0,0 +1,24 @@
+package k8s
+
+import (
+	"github.com/seldonio/trtis-scheduler/common/events"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+const (
+	EVENT_SOURCE        = "trtis-monitor"
+	EVENT_FLUSH_TIMEOUT = 5 * time.Second // Longest wait for the last events to be written before exiting
+)
+
+func NewEventRecorder(client kubernetes.Interface, nodeName string) *events.Recorder {
+	return events.NewEventRecorder(client.CoreV1().Events(""), v1.EventSource{Component: EVENT_SOURCE, Host: nodeName})
+}
+
+// Reference to record events on a node against. Node events use the node name as the UID like the
+// kubelet's, which is what kubectl describe node looks for.
+func NodeReference(nodeName string) *v1.ObjectReference {
+	return &v1.ObjectReference{Kind: "Node", Name: nodeName, UID: types.UID(nodeName)}
+}
@@ -37,6 +37,11 @@ func NewNodeAnnotator(nodeName string, log logr.Logger) (*NodeAnnotator, error)
 	}, nil
 }
 
+// Create a client for the cluster the monitor runs in. Returns nil outside a cluster.
+func NewClient(log logr.Logger) (*kubernetes.Clientset, error) {
+	return getK8sClient(log)
+}
+
 func getK8sClient(log logr.Logger) (*kubernetes.Clientset, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
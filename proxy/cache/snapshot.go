@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/otiai10/copy"
+	"github.com/seldonio/trtis-scheduler/common/cache"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNotCached = cache.ErrNotCached
+
+// What is needed to put a model folder back: its config and either the cached tree it links to,
+// if the loader installed it from the model cache, or a copy of its files.
+type ModelSnapshot struct {
+	modelDir    string
+	snapshotDir string
+	config      []byte
+	owner       []byte
+	ref         *cache.CacheRef
+	// Files in the snapshot copy with their sizes and modification times
+	files string
+	log   logr.Logger
+}
+
+// Record the installed model folder so it can be restored if it goes missing. Models not
+// installed from the cache are copied to the snapshot folder, hard linking files if it is on
+// the same file system as the model repository.
+func NewModelSnapshot(modelDir, snapshotDir string, log logr.Logger) (*ModelSnapshot, error) {
+	s := &ModelSnapshot{modelDir: modelDir, snapshotDir: snapshotDir, log: log.WithName("ModelSnapshot")}
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Record the model folder again, as new versions may have been installed since the last snapshot.
+// The copy of a model not installed from the cache is only remade when its files have changed.
+func (s *ModelSnapshot) Refresh() error {
+	config, err := ioutil.ReadFile(filepath.Join(s.modelDir, cache.CONFIG_FILENAME))
+	if err != nil {
+		return err
+	}
+	owner, err := ioutil.ReadFile(filepath.Join(s.modelDir, cache.OWNER_FILENAME))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ref, err := cache.ReadRef(s.modelDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if ref == nil {
+		files, err := listFiles(s.modelDir)
+		if err != nil {
+			return err
+		}
+		if files != s.files {
+			s.log.Info("Copying model files", "modelDir", s.modelDir, "snapshotDir", s.snapshotDir)
+			if err := replaceWithCopy(s.modelDir, s.snapshotDir); err != nil {
+				return err
+			}
+			s.files = files
+		}
+	}
+	s.config = config
+	s.owner = owner
+	s.ref = ref
+	return nil
+}
+
+// Check the model folder still has its config
+func (s *ModelSnapshot) Installed() bool {
+	_, err := os.Stat(filepath.Join(s.modelDir, cache.CONFIG_FILENAME))
+	return err == nil
+}
+
+// Reinstall a missing model folder from the cached tree or the copy of its files. Returns
+// ErrNotCached if the cached tree has been removed.
+func (s *ModelSnapshot) Restore() error {
+	if s.ref != nil {
+		modelCache, err := cache.NewModelCache(s.ref.Cache, s.log)
+		if err != nil {
+			return err
+		}
+		if err := modelCache.Restore(s.ref, s.modelDir); err != nil {
+			return err
+		}
+	} else {
+		if s.files == "" {
+			return fmt.Errorf("no copy of model folder %s", s.modelDir)
+		}
+		if err := replaceWithCopy(s.snapshotDir, s.modelDir); err != nil {
+			return err
+		}
+	}
+	if s.owner != nil {
+		if err := ioutil.WriteFile(filepath.Join(s.modelDir, cache.OWNER_FILENAME), s.owner, 0644); err != nil {
+			return err
+		}
+	}
+	// The config goes in last so TRTIS only sees a complete model
+	return ioutil.WriteFile(filepath.Join(s.modelDir, cache.CONFIG_FILENAME), s.config, 0644)
+}
+
+// List the files under a folder with their sizes and modification times
+func listFiles(dir string) (string, error) {
+	var files strings.Builder
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&files, "%s %d %d\n", rel, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return files.String(), err
+}
+
+// Replace dst with a copy of src, hard linking files where possible, except the model config
+// which is written separately. The copy is made beside dst and renamed into place.
+func replaceWithCopy(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	err = filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(tmp, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case rel == cache.CONFIG_FILENAME:
+			return nil
+		case os.Link(p, target) == nil:
+			return nil
+		}
+		return copy.Copy(p, target)
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
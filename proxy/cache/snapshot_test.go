@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"github.com/onsi/gomega"
+	"github.com/seldonio/trtis-scheduler/common/cache"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"testing"
+)
+
+func TestRestoreModelNotInstalledFromCache(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "snapshot")
+	g.Expect(err).Should(gomega.BeNil())
+	defer os.RemoveAll(dir)
+	modelDir := filepath.Join(dir, "repo", "simple")
+	g.Expect(os.MkdirAll(filepath.Join(modelDir, "1"), 0755)).Should(gomega.BeNil())
+	g.Expect(ioutil.WriteFile(filepath.Join(modelDir, cache.CONFIG_FILENAME), []byte("name: \"simple\""), 0644)).Should(gomega.BeNil())
+	g.Expect(ioutil.WriteFile(filepath.Join(modelDir, "1", "model.graphdef"), []byte("v1"), 0644)).Should(gomega.BeNil())
+
+	snapshot, err := NewModelSnapshot(modelDir, filepath.Join(dir, "snapshot"), logf.Log)
+	g.Expect(err).Should(gomega.BeNil())
+
+	// A version installed later is part of the next snapshot
+	g.Expect(os.MkdirAll(filepath.Join(modelDir, "2"), 0755)).Should(gomega.BeNil())
+	g.Expect(ioutil.WriteFile(filepath.Join(modelDir, "2", "model.graphdef"), []byte("v2"), 0644)).Should(gomega.BeNil())
+	g.Expect(snapshot.Refresh()).Should(gomega.BeNil())
+
+	g.Expect(os.RemoveAll(modelDir)).Should(gomega.BeNil())
+	g.Expect(snapshot.Installed()).Should(gomega.BeFalse())
+	g.Expect(snapshot.Restore()).Should(gomega.BeNil())
+	g.Expect(snapshot.Installed()).Should(gomega.BeTrue())
+	for version, content := range map[string]string{"1": "v1", "2": "v2"} {
+		data, err := ioutil.ReadFile(filepath.Join(modelDir, version, "model.graphdef"))
+		g.Expect(err).Should(gomega.BeNil())
+		g.Expect(string(data)).Should(gomega.Equal(content))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"github.com/seldonio/trtis-scheduler/proxy/fairshare"
+	"github.com/seldonio/trtis-scheduler/proxy/grpc"
+	proxyhttp "github.com/seldonio/trtis-scheduler/proxy/http"
+	"github.com/seldonio/trtis-scheduler/proxy/k8s"
+	"github.com/seldonio/trtis-scheduler/proxy/model"
+	grpc2 "google.golang.org/grpc"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"syscall"
+	"time"
+)
+
+var (
+	grpcPort         = flag.Int("grpc-port", 8101, "grpc port")
+	httpPort         = flag.Int("http-port", 8100, "http port")
+	metricsPort      = flag.Int("metrics-port", 8102, "Port for prometheus metrics")
+	trtisHost        = flag.String("trtis-host", "0.0.0.0", "TRTIS host")
+	trtisGrpcPort    = flag.Int("trtis-grpc-port", 8001, "TRTIS grpc port")
+	trtisHttpPort    = flag.Int("trtis-http-port", 8000, "TRTIS http port")
+	nodeName         = flag.String("node-name", os.Getenv("NODE_NAME"), "Node to watch model pods on for their models and fair share weights")
+	maxInFlight      = flag.Int("max-in-flight", 8, "Maximum inference requests sent to TRTIS at once")
+	quantum          = flag.Duration("quantum", 10*time.Millisecond, "GPU time given to a model of weight 1 each round")
+	targetQueueDelay = flag.Duration("target-queue-delay", 5*time.Millisecond, "Average TRTIS queue time above which fewer requests are sent at once, 0 to always send max-in-flight")
+	statusInterval   = flag.Duration("status-interval", 2*time.Second, "Interval between TRTIS statistics polls")
+)
+
+func startMetricsServer(log logr.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	address := fmt.Sprintf("0.0.0.0:%d", *metricsPort)
+	log.Info("Metrics Listening", "Address", address)
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.Error(err, "Metrics server error")
+		}
+	}()
+}
+
+func startHttpProxy(scheduler *fairshare.FairScheduler, models *model.AllowList, log logr.Logger) {
+	handler, err := proxyhttp.NewTrtisHttpProxy(*trtisHost, *trtisHttpPort, nil, models, model.NewNameMapper("", ""), nil, log)
+	if err != nil {
+		log.Error(err, "Failed to create http proxy", "trtisHost", *trtisHost)
+		os.Exit(-1)
+	}
+	address := fmt.Sprintf("0.0.0.0:%d", *httpPort)
+	log.Info("Http Listening", "Address", address)
+	srv := &http.Server{
+		Handler: proxyhttp.InferenceOnly(scheduler.Handler(handler)),
+		Addr:    address,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			log.Error(err, "Server error")
+		}
+	}()
+}
+
+func main() {
+	flag.Parse()
+
+	logf.SetLogger(logf.ZapLogger(false))
+	log := logf.Log.WithName("dispatcher")
+
+	log.Info("Started")
+
+	client, err := grpc.NewTrtisClient(*trtisHost, *trtisGrpcPort)
+	if err != nil {
+		log.Error(err, "Failed to create TRTIS client")
+		os.Exit(-1)
+	}
+
+	scheduler, err := fairshare.NewFairScheduler(*maxInFlight, *quantum)
+	if err != nil {
+		log.Error(err, "Invalid fair share settings")
+		os.Exit(-1)
+	}
+	// The dispatcher is reachable from the node so only serves inference for the models on the node
+	stop := make(chan struct{})
+	models := model.NewAllowAll()
+	if *nodeName != "" {
+		models = model.NewAllowList(nil)
+		if err := k8s.WatchNodeModels(*nodeName, models.Set, stop, log); err != nil {
+			log.Error(err, "Failed to watch node models")
+			os.Exit(-1)
+		}
+		if err := k8s.WatchModelWeights(*nodeName, scheduler.SetWeight, scheduler.RemoveWeight, stop, log); err != nil {
+			log.Error(err, "Failed to watch model weights")
+			os.Exit(-1)
+		}
+	} else {
+		log.Info("No node name so all models are served with the same weight")
+	}
+
+	// Request costs and the requests sent at once follow the statistics TRTIS reports
+	poller := model.NewStatusPoller(client, "", *statusInterval, log)
+	poller.AddHandler(fairshare.NewStatsFeedback(scheduler, *targetQueueDelay, *maxInFlight, log))
+	go poller.Run(stop)
+
+	startMetricsServer(log)
+	startHttpProxy(scheduler, models, log)
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+	if err != nil {
+		log.Error(err, "Failed to listen")
+		os.Exit(-1)
+	}
+	server := grpc.CreateGrpcServer(
+		grpc2.ChainUnaryInterceptor(grpc.InferenceOnlyUnaryServerInterceptor(), scheduler.UnaryServerInterceptor()),
+		grpc2.ChainStreamInterceptor(grpc.InferenceOnlyStreamServerInterceptor(), scheduler.StreamServerInterceptor()),
+	)
+	trtis.RegisterGRPCServiceServer(server, grpc.NewTrtisProxy(client, nil, models, model.NewNameMapper("", ""), nil))
+
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+		<-sigs
+		log.Info("Received signal")
+		server.GracefulStop()
+	}()
+
+	log.Info("grpc listening on ", "grpcPort", *grpcPort)
+	if err := server.Serve(lis); err != nil {
+		log.Error(err, "grpc server error")
+	}
+	close(stop)
+	log.Info("Stopping")
+}
@@ -1,73 +1,88 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	commoncache "github.com/seldonio/trtis-scheduler/common/cache"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"github.com/seldonio/trtis-scheduler/proxy/cache"
 	"github.com/seldonio/trtis-scheduler/proxy/grpc"
-	trtis "github.com/seldonio/trtis-scheduler/proxy/proto/trtis"
+	proxyhttp "github.com/seldonio/trtis-scheduler/proxy/http"
+	"github.com/seldonio/trtis-scheduler/proxy/k8s"
+	"github.com/seldonio/trtis-scheduler/proxy/limit"
+	"github.com/seldonio/trtis-scheduler/proxy/metrics"
+	"github.com/seldonio/trtis-scheduler/proxy/model"
+	"github.com/seldonio/trtis-scheduler/proxy/tracing"
+	grpc2 "google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/api/core/v1"
 	"net"
 	"net/http"
-	"net/http/httputil"
-	url2 "net/url"
 	"os"
 	"os/signal"
 	"path"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"strings"
 	"syscall"
 	"time"
 )
 
 var (
-	grpcPort       = flag.Int("grpcPort", 9001, "grpc port")
-	httpPort       = flag.Int("httpPort", 9000, "http port")
-	trtisHost      = flag.String("trtis-host", "0.0.0.0", "TRTIS host")
-	trtisGrpcPort  = flag.Int("trtis-grpc-port", 8001, "TRTIS grpc port")
-	trtisHttpPort  = flag.Int("trtis-http-port", 8000, "TRTIS http port")
-	modelName       = flag.String("model-name", "", "Model name")
-	trtisModelRepo = flag.String("trtis-model-repo", "/mnt/trtis/models", "TRTIS Model Repository")
+	grpcPort            = flag.Int("grpcPort", 9001, "grpc port")
+	httpPort            = flag.Int("httpPort", 9000, "http port")
+	trtisHost           = flag.String("trtis-host", "0.0.0.0", "TRTIS host")
+	trtisGrpcPort       = flag.Int("trtis-grpc-port", 8001, "TRTIS grpc port")
+	trtisHttpPort       = flag.Int("trtis-http-port", 8000, "TRTIS http port")
+	dispatcherGrpcPort  = flag.Int("dispatcher-grpc-port", 0, "Fair share dispatcher grpc port on the TRTIS host to send inference requests through, 0 to send them straight to TRTIS")
+	dispatcherHttpPort  = flag.Int("dispatcher-http-port", 0, "Fair share dispatcher http port on the TRTIS host to send inference requests through, 0 to send them straight to TRTIS")
+	modelName           = flag.String("model-name", "", "Model name, defaults to the name recorded on the pod by the loader")
+	clientModelName     = flag.String("client-model-name", "", "Model name clients use, defaults to the name recorded on the pod by the loader or model-name")
+	trtisModelRepo      = flag.String("trtis-model-repo", "/mnt/trtis/models", "TRTIS Model Repository")
+	modelSnapshotDir    = flag.String("model-snapshot-dir", "/tmp/trtis-model-snapshot", "Where to keep a copy of a model not installed from the model cache, to restore it if TRTIS restarts. Files are hard linked if it is on the same file system as the model repository.")
+	statusInterval      = flag.Duration("status-interval", 5*time.Second, "Interval between TRTIS model status polls")
+	allowedModels       = flag.String("allowed-models", "", "Comma separated models requests may be sent for, defaults to model-name")
+	metricsPort         = flag.Int("metrics-port", 9002, "Port for prometheus metrics and the /ready and /live health checks")
+	rateLimit           = flag.Float64("rate-limit", 0, "Inference requests per second allowed, 0 for no limit. Overridden by the seldon.io/trtis-rate-limit pod annotation.")
+	rateBurst           = flag.Int("rate-burst", 0, "Inference requests allowed above the rate limit in a burst, defaults to one second of requests")
+	maxInFlight         = flag.Int("max-in-flight", 0, "Inference requests processed at once, 0 for no limit. Overridden by the seldon.io/trtis-max-in-flight pod annotation.")
+	accessLogSampleRate = flag.Float64("access-log-sample-rate", 0, "Fraction of requests to write to the access log, 0 for no access log")
+	traceExporter       = flag.String("trace-exporter", tracing.EXPORTER_NONE, "Where to send trace spans, none, log or zipkin")
+	zipkinUrl           = flag.String("zipkin-url", "http://zipkin:9411/api/v2/spans", "Zipkin span collector for the zipkin trace exporter")
+	traceSampleRate     = flag.Float64("trace-sample-rate", 0.1, "Fraction of traces started by the proxy to record, traces started by clients keep their sampling decision")
+	modelLoadTimeout    = flag.Duration("model-load-timeout", 5*time.Minute, "Time to wait for TRTIS to load the model when reloading it after a TRTIS restart")
+	drainPeriod         = flag.Duration("drain-period", 5*time.Second, "Time between failing readiness and stopping the servers on shutdown, for traffic to move away")
+	shutdownTimeout     = flag.Duration("shutdown-timeout", 10*time.Second, "Time to wait for in flight requests to finish on shutdown")
+	unloadTimeout       = flag.Duration("unload-timeout", 10*time.Second, "Time to wait for TRTIS to unload each model on shutdown")
+	retireDelay         = flag.Duration("version-retire-delay", 30*time.Second, "Time to keep older model versions after traffic switches to a new version, negative to never retire them")
 )
 
-func startGrpcServer(log logr.Logger) {
-	client, err := grpc.NewTrtisClient(*trtisHost, *trtisGrpcPort)
-	if err != nil {
-		log.Error(err, "Failed to create TRTIS client")
-		os.Exit(-1)
-	}
+const (
+	// GRPC health service name for the proxied TRTIS API
+	HEALTH_SERVICE = "nvidia.inferenceserver.GRPCService"
+
+	unloadPollInterval = 500 * time.Millisecond
+)
 
+func startGrpcServer(server *grpc2.Server, log logr.Logger) {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
 	if err != nil {
 		log.Error(err, "Failed to listen")
 		os.Exit(-1)
 	}
-	server := grpc.CreateGrpcServer()
-	proxy := grpc.NewTrtisProxy(client)
-	trtis.RegisterGRPCServiceServer(server, proxy)
 
+	log.Info("grpc listening on ", "grpcPort", *grpcPort)
 	go func() {
-		sigs := make(chan os.Signal, 1)
-		signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
-		_ = <-sigs
-		log.Info("Received signal")
-		server.GracefulStop()
+		if err := server.Serve(lis); err != nil {
+			log.Error(err, "grpc server error")
+		}
 	}()
-
-	log.Info("grpc listening on ", "grpcPort", *grpcPort)
-	err = server.Serve(lis)
-	if err != nil {
-		log.Error(err, "grpc server error")
-	}
-
-	log.Info("Stopping")
 }
 
-func startHttpProxy(log logr.Logger) {
-	url, err := url2.Parse(fmt.Sprintf("http://%s:%d", *trtisHost, *trtisHttpPort))
-	if err != nil {
-		log.Error(err, "Failed to parse urr from ", "trtisHost", *trtisHost)
-	}
-	handler := httputil.NewSingleHostReverseProxy(url)
-
+func startHttpProxy(handler http.Handler, log logr.Logger) *http.Server {
 	address := fmt.Sprintf("0.0.0.0:%d", *httpPort)
 	log.Info("Http Listening", "Address", address)
 
@@ -80,20 +95,135 @@ func startHttpProxy(log logr.Logger) {
 	}
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Error(err, "Server error")
 		}
 	}()
+	return srv
+}
+
+// Stop taking requests and wait for those in flight to finish, up to the shutdown timeout
+func stopServers(httpServer *http.Server, grpcServer *grpc2.Server, log logr.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Error(err, "Failed to stop http server gracefully")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Info("Timed out waiting for grpc requests to finish")
+		grpcServer.Stop()
+	}
+}
+
+func startMetricsServer(readiness proxyhttp.ReadinessChecker, log logr.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	healthHandler := proxyhttp.HealthHandler(readiness)
+	mux.Handle("/ready", healthHandler)
+	mux.Handle("/live", healthHandler)
+	address := fmt.Sprintf("0.0.0.0:%d", *metricsPort)
+	log.Info("Metrics Listening", "Address", address)
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.Error(err, "Metrics server error")
+		}
+	}()
 }
 
 func removeModel(modelRepo, modelName string, log logr.Logger) {
 	dstPath := path.Join(modelRepo, modelName)
-	err := os.RemoveAll(dstPath)
+	err := commoncache.RemoveModel(dstPath, log)
 	if err != nil {
 		log.Error(err, "Failed to remove model")
 	}
 }
 
+// Unload a model from TRTIS and once TRTIS confirms it is unloaded remove its files.
+// Models whose folder is now owned by another pod, which has rolled out a new version, are left alone.
+func unloadModel(client *grpc.TrtisClient, modelName, podUID string, record model.EventRecorder, log logr.Logger) {
+	modelDir := path.Join(*trtisModelRepo, modelName)
+	if owner, err := commoncache.ReadOwner(modelDir); err == nil && podUID != "" && owner.UID != podUID {
+		log.Info("Model owned by another pod, leaving it loaded", "modelName", modelName, "owner", owner.Pod)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *unloadTimeout)
+	defer cancel()
+
+	log.Info("Unloading model", "modelName", modelName)
+	if err := model.RequestUnload(ctx, client, modelName); err != nil {
+		// TRTIS polling its repository does not allow explicit unloads but unloads models whose files are removed
+		log.Error(err, "Failed to unload model, removing its files for TRTIS to unload it", "modelName", modelName)
+		removeModel(*trtisModelRepo, modelName, log)
+		if err := model.WaitForUnload(ctx, client, modelName, unloadPollInterval); err != nil {
+			log.Error(err, "TRTIS did not confirm the model was unloaded", "modelName", modelName)
+			record(v1.EventTypeWarning, "ModelUnloadFailed", fmt.Sprintf("TRTIS did not confirm model %s was unloaded: %s", modelName, err))
+			return
+		}
+		record(v1.EventTypeNormal, "ModelUnloaded", fmt.Sprintf("Unloaded model %s", modelName))
+		return
+	}
+	if err := model.WaitForUnload(ctx, client, modelName, unloadPollInterval); err != nil {
+		log.Error(err, "TRTIS did not confirm the model was unloaded", "modelName", modelName)
+		record(v1.EventTypeWarning, "ModelUnloadFailed", fmt.Sprintf("TRTIS did not confirm model %s was unloaded: %s", modelName, err))
+	} else {
+		record(v1.EventTypeNormal, "ModelUnloaded", fmt.Sprintf("Unloaded model %s", modelName))
+	}
+	log.Info("Cleaning model from ", "dst", *trtisModelRepo, "modelName", modelName)
+	removeModel(*trtisModelRepo, modelName, log)
+}
+
+// Get the pod with the model details recorded by the loader
+func getPod(k8sManager *k8s.K8sManager, log logr.Logger) *v1.Pod {
+	if k8sManager == nil {
+		log.Info("Unable to get model name from pod")
+		return &v1.Pod{}
+	}
+	pod, err := k8sManager.GetPod()
+	if err != nil {
+		log.Error(err, "Failed to get pod")
+		return &v1.Pod{}
+	}
+	return pod
+}
+
+// Record events on the proxy's pod, or only log them outside a cluster
+func newEventRecorder(k8sManager *k8s.K8sManager, log logr.Logger) model.EventRecorder {
+	return func(eventType, reason, message string) {
+		if k8sManager == nil {
+			log.Info("Event", "type", eventType, "reason", reason, "message", message)
+			return
+		}
+		if err := k8sManager.EmitEvent(eventType, reason, message); err != nil {
+			log.Error(err, "Failed to emit event", "reason", reason)
+		}
+	}
+}
+
+// Shared memory regions registered through the proxy are named after its pod so tenants on the
+// same TRTIS server can not see or remove each other's regions
+func regionPrefix(pod *v1.Pod) string {
+	if pod.Name == "" {
+		return *modelName + "."
+	}
+	return pod.Namespace + "." + pod.Name + "."
+}
+
+// Reload the model if TRTIS restarts, recording what happened as pod events
+func newRestartRecovery(client *grpc.TrtisClient, record model.EventRecorder, log logr.Logger) *model.RestartRecovery {
+	snapshot, err := cache.NewModelSnapshot(path.Join(*trtisModelRepo, *modelName), *modelSnapshotDir, log)
+	if err != nil {
+		log.Error(err, "Failed to record model files, the model will not be reloaded if TRTIS restarts")
+		return nil
+	}
+	return model.NewRestartRecovery(client, *modelName, snapshot, record, *modelLoadTimeout, log)
+}
 
 func main() {
 	flag.Parse()
@@ -103,11 +233,163 @@ func main() {
 
 	log.Info("Started")
 
-	startHttpProxy(log)
-	startGrpcServer(log)
+	k8sManager, err := k8s.NewK8sManager(log)
+	if err != nil {
+		log.Error(err, "Failed to create k8s client")
+	}
+	pod := getPod(k8sManager, log)
+	record := newEventRecorder(k8sManager, log)
+	annotations := pod.Annotations
+	if *modelName == "" {
+		*modelName = annotations[k8s.ANNOTATION_MODEL_NAME]
+	}
+	if *clientModelName == "" {
+		*clientModelName = annotations[k8s.ANNOTATION_CLIENT_MODEL_NAME]
+	}
+	var ensembleMembers []string
+	if members := annotations[k8s.ANNOTATION_ENSEMBLE_MEMBERS]; members != "" {
+		ensembleMembers = strings.Split(members, ",")
+	}
+
+	// Continue client traces through the proxy to TRTIS
+	stopExporter, err := tracing.RegisterExporter(*traceExporter, *zipkinUrl, log)
+	if err != nil {
+		log.Error(err, "Failed to create trace exporter")
+		os.Exit(-1)
+	}
+	tracer := tracing.NewTracer(*traceSampleRate)
+
+	dialOpts := []grpc2.DialOption{
+		grpc2.WithChainUnaryInterceptor(tracer.UnaryClientInterceptor(), metrics.UnaryClientInterceptor()),
+		grpc2.WithChainStreamInterceptor(tracer.StreamClientInterceptor(), metrics.StreamClientInterceptor()),
+	}
+	client, err := grpc.NewTrtisClient(*trtisHost, *trtisGrpcPort, dialOpts...)
+	if err != nil {
+		log.Error(err, "Failed to create TRTIS client")
+		os.Exit(-1)
+	}
+	// The dispatcher only serves inference, so everything else goes straight to TRTIS
+	inferClient := client
+	if *dispatcherGrpcPort != 0 {
+		inferClient, err = grpc.NewTrtisClient(*trtisHost, *dispatcherGrpcPort, dialOpts...)
+		if err != nil {
+			log.Error(err, "Failed to create dispatcher client")
+			os.Exit(-1)
+		}
+	}
+
+	// Route requests without a version to the newest ready version while versions are rolled
+	// and only report the proxy ready while TRTIS has the model ready
+	var versions grpc.VersionRouter
+	var readiness proxyhttp.ReadinessChecker
+	var modelReadiness *model.Readiness
+	healthServer := health.NewServer()
+	stop := make(chan struct{})
+	if *modelName != "" {
+		versionManager := model.NewVersionManager(*trtisModelRepo, *modelName, *retireDelay, log)
+		modelReadiness = model.NewReadiness(*modelName, log)
+		modelReadiness.AddListener(func(ready bool) {
+			status := healthpb.HealthCheckResponse_NOT_SERVING
+			if ready {
+				status = healthpb.HealthCheckResponse_SERVING
+			}
+			healthServer.SetServingStatus("", status)
+			healthServer.SetServingStatus(HEALTH_SERVICE, status)
+		})
+		poller := model.NewStatusPoller(client, *modelName, *statusInterval, log)
+		poller.AddHandler(versionManager)
+		poller.AddHandler(modelReadiness)
+		if recovery := newRestartRecovery(client, record, log); recovery != nil {
+			poller.AddHandler(recovery)
+		}
+		go poller.Run(stop)
+		versions = versionManager
+		readiness = modelReadiness
+	}
+
+	// Only allow requests for the tenant's own models
+	allowed := []string{*modelName}
+	if *allowedModels != "" {
+		allowed = strings.Split(*allowedModels, ",")
+	}
+	models := model.NewAllowList(allowed)
+	if *modelName == "" && *allowedModels == "" {
+		log.Info("No model name so all model requests will be rejected")
+	}
+
+	// Clients use their own model name which is mapped to the unique name on the server
+	names := model.NewNameMapper(*clientModelName, *modelName)
+	regions := model.NewRegionNames(regionPrefix(pod))
+
+	// Limit the share of the TRTIS server this tenant can take
+	limits, err := limit.Limits{Rate: *rateLimit, Burst: *rateBurst, MaxInFlight: *maxInFlight}.WithAnnotations(annotations)
+	if err != nil {
+		log.Error(err, "Failed to parse request limits")
+		os.Exit(-1)
+	}
+	log.Info("Request limits", "rate", limits.Rate, "burst", limits.Burst, "maxInFlight", limits.MaxInFlight)
+	limiter := limit.NewLimiter(limits, *modelName)
+
+	// Metrics and access log for requests to the tenant's models
+	recorder := metrics.NewRecorder(func(name string) string {
+		if models.Allowed(names.ToServer(name)) {
+			return name
+		}
+		return metrics.OTHER_MODEL
+	}, *accessLogSampleRate, log)
+
+	httpProxy, err := proxyhttp.NewTrtisHttpProxy(*trtisHost, *trtisHttpPort, versions, models, names, regions, log)
+	if err != nil {
+		log.Error(err, "Failed to create http proxy", "trtisHost", *trtisHost)
+		os.Exit(-1)
+	}
+	if *dispatcherHttpPort != 0 {
+		if err := httpProxy.SetInferTarget(*trtisHost, *dispatcherHttpPort); err != nil {
+			log.Error(err, "Failed to send http inference to the dispatcher", "trtisHost", *trtisHost)
+			os.Exit(-1)
+		}
+	}
+	httpProxy.WrapTransport(metrics.Transport)
+	httpProxy.WrapTransport(tracer.Transport)
+
+	server := grpc.CreateGrpcServer(
+		grpc2.ChainUnaryInterceptor(tracer.UnaryServerInterceptor(), recorder.UnaryServerInterceptor(), limiter.UnaryServerInterceptor()),
+		grpc2.ChainStreamInterceptor(tracer.StreamServerInterceptor(), recorder.StreamServerInterceptor(), limiter.StreamServerInterceptor()),
+	)
+	trtisProxy := grpc.NewTrtisProxy(client, versions, models, names, regions)
+	trtisProxy.SetInferClient(inferClient)
+	trtis.RegisterGRPCServiceServer(server, trtisProxy)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	startMetricsServer(readiness, log)
+	httpServer := startHttpProxy(tracer.Handler(recorder.Handler(limiter.Handler(httpProxy))), log)
+	startGrpcServer(server, log)
 
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	<-sigs
+	log.Info("Received signal")
+
+	// Fail readiness so Services stop routing to the pod, then let in flight requests finish
+	if modelReadiness != nil {
+		modelReadiness.SetDraining()
+	}
+	healthServer.Shutdown()
+	log.Info("Draining", "period", *drainPeriod)
+	time.Sleep(*drainPeriod)
+	stopServers(httpServer, server, log)
+	stopExporter()
+	close(stop)
+	log.Info("Stopping")
+
+	// Unload the ensemble before the models it is composed of
 	if *modelName != "" {
-		log.Info("Cleaning model from ", "dst", *trtisModelRepo, "modelName", modelName)
-		removeModel(*trtisModelRepo, *modelName, log)
+		unloadModel(client, *modelName, string(pod.UID), record, log)
+	}
+	for _, member := range ensembleMembers {
+		unloadModel(client, member, string(pod.UID), record, log)
+	}
+	if k8sManager != nil {
+		k8sManager.FlushEvents()
 	}
 }
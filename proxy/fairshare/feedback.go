@@ -0,0 +1,96 @@
+package fairshare
+
+import (
+	"github.com/go-logr/logr"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"time"
+)
+
+type statTotals struct {
+	computeCount uint64
+	computeNs    uint64
+	queueCount   uint64
+	queueNs      uint64
+}
+
+// Feeds the compute and queue durations TRTIS reports for each model back into the scheduler.
+// The average compute time of a model's requests since the last status is used as their cost.
+// When requests queue inside TRTIS for longer than the target delay fewer requests are dispatched
+// at once, so requests wait in the fair scheduler instead, and more when the queues are short.
+type StatsFeedback struct {
+	log              logr.Logger
+	scheduler        *FairScheduler
+	targetQueueDelay time.Duration
+	maxInFlight      int
+	last             map[string]statTotals
+}
+
+func NewStatsFeedback(scheduler *FairScheduler, targetQueueDelay time.Duration, maxInFlight int, log logr.Logger) *StatsFeedback {
+	return &StatsFeedback{
+		log:              log.WithName("StatsFeedback"),
+		scheduler:        scheduler,
+		targetQueueDelay: targetQueueDelay,
+		maxInFlight:      maxInFlight,
+		last:             map[string]statTotals{},
+	}
+}
+
+func totals(status *trtis.ModelStatus) statTotals {
+	var t statTotals
+	for _, versionStatus := range status.GetVersionStatus() {
+		for _, stats := range versionStatus.GetInferStats() {
+			t.computeCount += stats.GetCompute().GetCount()
+			t.computeNs += stats.GetCompute().GetTotalTimeNs()
+			t.queueCount += stats.GetQueue().GetCount()
+			t.queueNs += stats.GetQueue().GetTotalTimeNs()
+		}
+	}
+	return t
+}
+
+func (f *StatsFeedback) HandleStatus(status *trtis.ServerStatus, err error) {
+	if err != nil {
+		return
+	}
+	var modelNames []string
+	for modelName := range status.GetModelStatus() {
+		modelNames = append(modelNames, modelName)
+	}
+	f.scheduler.SetModels(modelNames)
+	for modelName := range f.last {
+		if _, ok := status.GetModelStatus()[modelName]; !ok {
+			delete(f.last, modelName)
+		}
+	}
+
+	var queueCount, queueNs uint64
+	for modelName, modelStatus := range status.GetModelStatus() {
+		current := totals(modelStatus)
+		last, ok := f.last[modelName]
+		f.last[modelName] = current
+		// Counters go back to zero when a model is reloaded
+		if !ok || current.computeCount < last.computeCount || current.queueCount < last.queueCount {
+			continue
+		}
+		if count := current.computeCount - last.computeCount; count > 0 {
+			cost := time.Duration((current.computeNs - last.computeNs) / count)
+			f.scheduler.SetCost(modelName, cost)
+		}
+		queueCount += current.queueCount - last.queueCount
+		queueNs += current.queueNs - last.queueNs
+	}
+	if queueCount == 0 || f.targetQueueDelay <= 0 {
+		return
+	}
+	queueDelay := time.Duration(queueNs / queueCount)
+	maxInFlight := f.scheduler.MaxInFlight()
+	if queueDelay > f.targetQueueDelay && maxInFlight > 1 {
+		maxInFlight--
+	} else if queueDelay < f.targetQueueDelay/2 && maxInFlight < f.maxInFlight {
+		maxInFlight++
+	} else {
+		return
+	}
+	f.log.Info("Adjusting requests in flight", "queueDelay", queueDelay, "maxInFlight", maxInFlight)
+	f.scheduler.SetMaxInFlight(maxInFlight)
+}
@@ -0,0 +1,81 @@
+package fairshare
+
+import (
+	"context"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+// Queue Infer calls in the fair scheduler before they are forwarded to TRTIS
+func (s *FairScheduler) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		inferRequest, ok := req.(*trtis.InferRequest)
+		if !ok {
+			return handler(ctx, req)
+		}
+		release, err := s.Submit(ctx, inferRequest.ModelName)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// Queue each request of a StreamInfer call. TRTIS answers stream requests in order
+// so a request's slot is released when the next response is sent.
+func (s *FairScheduler) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !info.IsClientStream {
+			return handler(srv, stream)
+		}
+		scheduled := &scheduledStream{ServerStream: stream, scheduler: s}
+		defer scheduled.releaseAll()
+		return handler(srv, scheduled)
+	}
+}
+
+type scheduledStream struct {
+	grpc.ServerStream
+	scheduler *FairScheduler
+	mu        sync.Mutex
+	releases  []func()
+}
+
+func (s *scheduledStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	inferRequest, ok := m.(*trtis.InferRequest)
+	if !ok {
+		return nil
+	}
+	release, err := s.scheduler.Submit(s.Context(), inferRequest.ModelName)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.releases = append(s.releases, release)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *scheduledStream) SendMsg(m interface{}) error {
+	s.mu.Lock()
+	if len(s.releases) > 0 {
+		s.releases[0]()
+		s.releases = s.releases[1:]
+	}
+	s.mu.Unlock()
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *scheduledStream) releaseAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, release := range s.releases {
+		release()
+	}
+	s.releases = nil
+}
@@ -0,0 +1,26 @@
+package fairshare
+
+import (
+	"net/http"
+	"strings"
+)
+
+const API_INFER_PREFIX = "/api/infer/"
+
+// Queue http infer requests, /api/infer/<model>, in the fair scheduler
+func (s *FairScheduler) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, API_INFER_PREFIX) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		modelName := strings.Split(strings.TrimPrefix(req.URL.Path, API_INFER_PREFIX), "/")[0]
+		release, err := s.Submit(req.Context(), modelName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, req)
+	})
+}
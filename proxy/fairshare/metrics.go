@@ -0,0 +1,24 @@
+package fairshare
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queuedRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "trtis_dispatcher_queued_requests",
+		Help: "Inference requests waiting to be dispatched to TRTIS",
+	}, []string{"model"})
+	dispatchedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "trtis_dispatcher_dispatched_requests_total",
+		Help: "Inference requests dispatched to TRTIS",
+	}, []string{"model"})
+	requestCost = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "trtis_dispatcher_request_cost_seconds",
+		Help: "Average TRTIS compute time of a model's requests",
+	}, []string{"model"})
+)
+
+func init() {
+	prometheus.MustRegister(queuedRequests, dispatchedRequests, requestCost)
+}
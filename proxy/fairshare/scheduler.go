@@ -0,0 +1,268 @@
+package fairshare
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// Queue shared by requests for models the scheduler does not know
+	OTHER_MODEL    = "other"
+	DEFAULT_WEIGHT = 1.0
+	// Cost assumed for a model's requests until TRTIS statistics are available
+	DEFAULT_COST = time.Millisecond
+)
+
+type waiter struct {
+	ready      chan struct{}
+	dispatched bool
+}
+
+type modelQueue struct {
+	name    string
+	weight  float64
+	cost    time.Duration
+	deficit float64
+	visited bool
+	waiters []*waiter
+}
+
+// Deficit round robin scheduler for inference requests from the models sharing a TRTIS server.
+// Each round a model's deficit grows by the quantum times its weight and requests are dispatched
+// while the deficit covers their cost, the GPU time a request of the model takes. Models so get
+// GPU time in proportion to their weights however expensive their requests are.
+type FairScheduler struct {
+	mu          sync.Mutex
+	quantum     time.Duration
+	maxInFlight int
+	inFlight    int
+	models      map[string]*modelQueue
+	// Models TRTIS serves and models with a weight from their pod get their own queue
+	served  map[string]bool
+	weights map[string]float64
+	active  []*modelQueue
+	next    int
+}
+
+// Create a scheduler. The quantum must be positive or a model's deficit would never cover a request
+// and dispatching would never end.
+func NewFairScheduler(maxInFlight int, quantum time.Duration) (*FairScheduler, error) {
+	if maxInFlight < 1 {
+		return nil, fmt.Errorf("max in flight must be at least 1, got %d", maxInFlight)
+	}
+	if quantum <= 0 {
+		return nil, fmt.Errorf("quantum must be positive, got %v", quantum)
+	}
+	return &FairScheduler{
+		quantum:     quantum,
+		maxInFlight: maxInFlight,
+		models:      map[string]*modelQueue{},
+		served:      map[string]bool{},
+		weights:     map[string]float64{},
+	}, nil
+}
+
+func (s *FairScheduler) known(modelName string) bool {
+	_, weighted := s.weights[modelName]
+	return s.served[modelName] || weighted
+}
+
+// Get the queue for a model. Requests for models which are neither served nor weighted share
+// one queue so clients can not create queues and metrics with arbitrary model names.
+// Must be called with the lock held.
+func (s *FairScheduler) queue(modelName string) *modelQueue {
+	if !s.known(modelName) {
+		modelName = OTHER_MODEL
+	}
+	q, ok := s.models[modelName]
+	if !ok {
+		weight, ok := s.weights[modelName]
+		if !ok {
+			weight = DEFAULT_WEIGHT
+		}
+		q = &modelQueue{name: modelName, weight: weight, cost: DEFAULT_COST}
+		s.models[modelName] = q
+	}
+	return q
+}
+
+// Remove the queues and metrics of models which are no longer known once their requests have
+// been dispatched. Must be called with the lock held.
+func (s *FairScheduler) evict() {
+	for modelName, q := range s.models {
+		if modelName == OTHER_MODEL || s.known(modelName) || len(q.waiters) > 0 {
+			continue
+		}
+		delete(s.models, modelName)
+		queuedRequests.DeleteLabelValues(modelName)
+		dispatchedRequests.DeleteLabelValues(modelName)
+		requestCost.DeleteLabelValues(modelName)
+	}
+}
+
+// Set the models TRTIS serves, evicting the queues of models which have gone
+func (s *FairScheduler) SetModels(modelNames []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.served = map[string]bool{}
+	for _, modelName := range modelNames {
+		s.served[modelName] = true
+	}
+	s.evict()
+}
+
+func (s *FairScheduler) SetWeight(modelName string, weight float64) {
+	if weight <= 0 {
+		weight = DEFAULT_WEIGHT
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.weights[modelName] = weight
+	s.queue(modelName).weight = weight
+}
+
+// Forget the weight of a model whose pod has gone
+func (s *FairScheduler) RemoveWeight(modelName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.weights, modelName)
+	if q, ok := s.models[modelName]; ok {
+		q.weight = DEFAULT_WEIGHT
+	}
+	s.evict()
+}
+
+// Set the GPU time a request of the model is expected to take
+func (s *FairScheduler) SetCost(modelName string, cost time.Duration) {
+	if cost <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.known(modelName) {
+		s.queue(modelName).cost = cost
+		requestCost.WithLabelValues(modelName).Set(cost.Seconds())
+	}
+}
+
+// Set how many requests may be running on the server at once
+func (s *FairScheduler) SetMaxInFlight(maxInFlight int) {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxInFlight = maxInFlight
+	s.dispatch()
+}
+
+func (s *FairScheduler) MaxInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInFlight
+}
+
+// Wait for a request of the model to be dispatched. The release function must be
+// called once the server has processed the request.
+func (s *FairScheduler) Submit(ctx context.Context, modelName string) (func(), error) {
+	w := &waiter{ready: make(chan struct{})}
+	s.mu.Lock()
+	q := s.queue(modelName)
+	q.waiters = append(q.waiters, w)
+	if len(q.waiters) == 1 {
+		s.active = append(s.active, q)
+	}
+	queuedRequests.WithLabelValues(q.name).Inc()
+	s.dispatch()
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaser(), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if w.dispatched {
+			// Dispatched as the request was cancelled so give back its slot
+			s.inFlight--
+			s.dispatch()
+		} else {
+			s.remove(q, w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *FairScheduler) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.inFlight--
+			s.dispatch()
+		})
+	}
+}
+
+// Remove a cancelled waiter. Must be called with the lock held.
+func (s *FairScheduler) remove(q *modelQueue, w *waiter) {
+	for i, queued := range q.waiters {
+		if queued == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			queuedRequests.WithLabelValues(q.name).Dec()
+			break
+		}
+	}
+	if len(q.waiters) == 0 {
+		s.deactivate(q)
+	}
+}
+
+// Remove a model with no waiting requests from the round. Must be called with the lock held.
+func (s *FairScheduler) deactivate(q *modelQueue) {
+	q.deficit = 0
+	q.visited = false
+	for i, active := range s.active {
+		if active == q {
+			s.active = append(s.active[:i], s.active[i+1:]...)
+			if i < s.next {
+				s.next--
+			}
+			break
+		}
+	}
+	if s.next >= len(s.active) {
+		s.next = 0
+	}
+}
+
+// Dispatch waiting requests while there are free slots. Must be called with the lock held.
+func (s *FairScheduler) dispatch() {
+	for s.inFlight < s.maxInFlight && len(s.active) > 0 {
+		q := s.active[s.next]
+		if !q.visited {
+			q.deficit += float64(s.quantum) * q.weight
+			q.visited = true
+		}
+		if q.deficit < float64(q.cost) {
+			// Wait for the next round
+			q.visited = false
+			s.next = (s.next + 1) % len(s.active)
+			continue
+		}
+		w := q.waiters[0]
+		q.waiters = q.waiters[1:]
+		q.deficit -= float64(q.cost)
+		w.dispatched = true
+		close(w.ready)
+		s.inFlight++
+		queuedRequests.WithLabelValues(q.name).Dec()
+		dispatchedRequests.WithLabelValues(q.name).Inc()
+		if len(q.waiters) == 0 {
+			s.deactivate(q)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package fairshare
+
+import (
+	"context"
+	"github.com/onsi/gomega"
+	"testing"
+	"time"
+)
+
+// Queue requests for two models behind a blocking request and record the order they are dispatched in
+func dispatchOrder(g *gomega.GomegaWithT, s *FairScheduler, perModel int) []string {
+	block, err := s.Submit(context.Background(), "blocker")
+	g.Expect(err).Should(gomega.BeNil())
+
+	dispatched := make(chan string, 2*perModel)
+	errs := make(chan error, 2*perModel)
+	for _, modelName := range []string{"light", "heavy"} {
+		for i := 0; i < perModel; i++ {
+			go func(modelName string) {
+				release, err := s.Submit(context.Background(), modelName)
+				if err != nil {
+					errs <- err
+					return
+				}
+				dispatched <- modelName
+				release()
+			}(modelName)
+		}
+	}
+	g.Eventually(func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.models["light"].waiters) + len(s.models["heavy"].waiters)
+	}).Should(gomega.Equal(2 * perModel))
+	block()
+
+	var order []string
+	for len(order) < 2*perModel {
+		select {
+		case modelName := <-dispatched:
+			order = append(order, modelName)
+		case err := <-errs:
+			g.Expect(err).Should(gomega.BeNil())
+		}
+	}
+	return order
+}
+
+func count(order []string, modelName string) int {
+	n := 0
+	for _, m := range order {
+		if m == modelName {
+			n++
+		}
+	}
+	return n
+}
+
+func TestExpensiveModelDoesNotStarveCheapModel(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	s, err := NewFairScheduler(1, time.Millisecond)
+	g.Expect(err).Should(gomega.BeNil())
+	s.SetModels([]string{"light", "heavy"})
+	s.SetCost("light", time.Millisecond)
+	s.SetCost("heavy", 4*time.Millisecond)
+	order := dispatchOrder(g, s, 10)
+	// Equal weights get equal GPU time so four light requests run for each heavy one
+	g.Expect(count(order[:10], "light")).Should(gomega.BeNumerically(">=", 7))
+	g.Expect(count(order[:10], "heavy")).Should(gomega.BeNumerically(">=", 1))
+	g.Expect(order).Should(gomega.HaveLen(20))
+}
+
+func TestWeights(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	s, err := NewFairScheduler(1, time.Millisecond)
+	g.Expect(err).Should(gomega.BeNil())
+	s.SetWeight("light", 1)
+	s.SetWeight("heavy", 3)
+	order := dispatchOrder(g, s, 8)
+	g.Expect(count(order[:8], "heavy")).Should(gomega.Equal(6))
+}
+
+func TestCancelledRequestLeavesQueue(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	s, err := NewFairScheduler(1, time.Millisecond)
+	g.Expect(err).Should(gomega.BeNil())
+	release, err := s.Submit(context.Background(), "model")
+	g.Expect(err).Should(gomega.BeNil())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.Submit(ctx, "model")
+	g.Expect(err).Should(gomega.Equal(context.DeadlineExceeded))
+	release()
+	release, err = s.Submit(context.Background(), "model")
+	g.Expect(err).Should(gomega.BeNil())
+	release()
+}
+
+func TestQueuesOnlyForKnownModels(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	s, err := NewFairScheduler(1, time.Millisecond)
+	g.Expect(err).Should(gomega.BeNil())
+	s.SetModels([]string{"served"})
+	s.SetWeight("weighted", 2)
+	for _, modelName := range []string{"served", "weighted", "unknown-1", "unknown-2"} {
+		release, err := s.Submit(context.Background(), modelName)
+		g.Expect(err).Should(gomega.BeNil())
+		release()
+	}
+	g.Expect(s.models).Should(gomega.HaveLen(3))
+	g.Expect(s.models).Should(gomega.HaveKey(OTHER_MODEL))
+
+	// Queues of models which are no longer served or weighted are evicted
+	s.SetModels(nil)
+	s.RemoveWeight("weighted")
+	g.Expect(s.models).Should(gomega.HaveLen(1))
+	g.Expect(s.models).Should(gomega.HaveKey(OTHER_MODEL))
+}
+
+func TestRejectsQuantumOrMaxInFlightWhichNeverDispatch(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	_, err := NewFairScheduler(1, 0)
+	g.Expect(err).ShouldNot(gomega.BeNil())
+	_, err = NewFairScheduler(1, -time.Millisecond)
+	g.Expect(err).ShouldNot(gomega.BeNil())
+	_, err = NewFairScheduler(0, time.Millisecond)
+	g.Expect(err).ShouldNot(gomega.BeNil())
+}
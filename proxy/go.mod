@@ -3,12 +3,22 @@ module github.com/seldonio/trtis-scheduler/proxy
 go 1.12
 
 require (
+	contrib.go.opencensus.io/exporter/zipkin v0.1.2
 	github.com/go-logr/logr v0.1.0
-	github.com/golang/protobuf v1.3.2
+	github.com/golang/protobuf v1.4.3
+	github.com/onsi/gomega v1.7.0
+	github.com/openzipkin/zipkin-go v0.2.2
 	github.com/otiai10/copy v1.0.2
-	golang.org/x/lint v0.0.0-20190313153728-d0100b6bd8b3 // indirect
-	google.golang.org/grpc v1.26.0
-	honnef.co/go/tools v0.0.0-20190523083050-ea95bdfd59fc // indirect
-	k8s.io/client-go v0.17.0 // indirect
+	github.com/prometheus/client_golang v1.2.1
+	github.com/prometheus/client_model v0.0.0-20190812154241-14fe0d1b01d4
+	github.com/seldonio/trtis-scheduler/common v0.0.0
+	go.opencensus.io v0.23.0
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	google.golang.org/grpc v1.33.2
+	k8s.io/api v0.17.0
+	k8s.io/apimachinery v0.17.0
+	k8s.io/client-go v0.17.0
 	sigs.k8s.io/controller-runtime v0.4.0
 )
+
+replace github.com/seldonio/trtis-scheduler/common => ../common
@@ -3,28 +3,96 @@ package grpc
 import (
 	"context"
 	"github.com/go-logr/logr"
-	trtis "github.com/seldonio/trtis-scheduler/proxy/proto/trtis"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
 	"math"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 )
 
-func CreateGrpcServer() *grpc.Server {
+var inferenceMethods = map[string]bool{
+	"/nvidia.inferenceserver.GRPCService/Infer":       true,
+	"/nvidia.inferenceserver.GRPCService/StreamInfer": true,
+}
+
+// Reject calls other than inference, for servers in front of TRTIS which must not let clients
+// read or change the models, shared memory or repository of the server
+func InferenceOnlyUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !inferenceMethods[info.FullMethod] {
+			return nil, status.Errorf(codes.PermissionDenied, "%s is not served", info.FullMethod)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func InferenceOnlyStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !inferenceMethods[info.FullMethod] {
+			return status.Errorf(codes.PermissionDenied, "%s is not served", info.FullMethod)
+		}
+		return handler(srv, ss)
+	}
+}
+
+func CreateGrpcServer(serverOpts ...grpc.ServerOption) *grpc.Server {
 	opts := []grpc.ServerOption{
 		grpc.MaxRecvMsgSize(math.MaxInt32),
 		grpc.MaxSendMsgSize(math.MaxInt32),
 	}
+	opts = append(opts, serverOpts...)
 	grpcServer := grpc.NewServer(opts...)
 	return grpcServer
 }
 
+// Chooses the model version requests for the latest version are sent to
+type VersionRouter interface {
+	// The version to use or a negative value to leave the choice to TRTIS
+	ActiveVersion() int64
+}
+
+// Restricts the models tenants can reach through the proxy
+type ModelFilter interface {
+	Allowed(modelName string) bool
+	// Remove models which are not allowed from a server wide status
+	FilterStatus(status *trtis.ServerStatus)
+}
+
+// Maps client facing model names to the model names on the TRTIS server
+type ModelNames interface {
+	ToServer(modelName string) string
+	ToClient(modelName string) string
+	// Rename models in a server status to their client names
+	StatusToClient(status *trtis.ServerStatus)
+}
+
+// Maps the shared memory regions of a tenant to regions on the TRTIS server
+type SharedMemoryRegions interface {
+	ToServer(name string) string
+	// Whether the region was registered through the proxy
+	Registered(name string) bool
+	Add(name string)
+	Remove(name string)
+	Names() []string
+	// Keep the tenant's regions in a server wide status, renamed to their client names
+	StatusToClient(regions []*trtis.SharedMemoryRegion) []*trtis.SharedMemoryRegion
+}
+
 type TrtisProxy struct {
 	Log         logr.Logger
 	client      *TrtisClient
+	inferClient *TrtisClient
 	callOptions []grpc.CallOption
+	versions    VersionRouter
+	models      ModelFilter
+	names       ModelNames
+	regions     SharedMemoryRegions
 }
 
-func NewTrtisProxy(client *TrtisClient) *TrtisProxy {
+// Create a proxy to TRTIS. Without regions shared memory requests are forwarded unchanged.
+func NewTrtisProxy(client *TrtisClient, versions VersionRouter, models ModelFilter, names ModelNames, regions SharedMemoryRegions) *TrtisProxy {
 	opts := []grpc.CallOption{
 		grpc.MaxCallSendMsgSize(math.MaxInt32),
 		grpc.MaxCallRecvMsgSize(math.MaxInt32),
@@ -32,35 +100,279 @@ func NewTrtisProxy(client *TrtisClient) *TrtisProxy {
 	return &TrtisProxy{
 		Log:         logf.Log.WithName("TrtisServer"),
 		client:      client,
+		inferClient: client,
 		callOptions: opts,
+		versions:    versions,
+		models:      models,
+		names:       names,
+		regions:     regions,
+	}
+}
+
+// Send infer requests through a different client, e.g. to a fair share dispatcher in front of TRTIS
+func (t *TrtisProxy) SetInferClient(client *TrtisClient) {
+	t.inferClient = client
+}
+
+func (t *TrtisProxy) checkModel(modelName string) error {
+	if !t.models.Allowed(modelName) {
+		t.Log.Info("Rejected request for model", "model", modelName)
+		return status.Errorf(codes.PermissionDenied, "model %q is not available through this proxy", modelName)
+	}
+	return nil
+}
+
+// Send requests for the latest version to the active version
+func (t *TrtisProxy) routeVersion(req *trtis.InferRequest) {
+	if req.ModelVersion < 0 && t.versions != nil {
+		if version := t.versions.ActiveVersion(); version >= 0 {
+			req.ModelVersion = version
+		}
+	}
+}
+
+func (t *TrtisProxy) inferResponseToClient(res *trtis.InferResponse) {
+	if res.GetMetaData() != nil {
+		res.MetaData.ModelName = t.names.ToClient(res.MetaData.ModelName)
+	}
+}
+
+// Rename the shared memory regions inputs are read from and outputs written to, rejecting
+// requests using regions the tenant did not register
+func (t *TrtisProxy) regionsToServer(ctx context.Context, req *trtis.InferRequest) error {
+	if t.regions == nil {
+		return nil
+	}
+	var regions []*trtis.InferSharedMemory
+	for _, input := range req.GetMetaData().GetInput() {
+		if input.GetSharedMemory() != nil {
+			regions = append(regions, input.SharedMemory)
+		}
+	}
+	for _, output := range req.GetMetaData().GetOutput() {
+		if output.GetSharedMemory() != nil {
+			regions = append(regions, output.SharedMemory)
+		}
+	}
+	for _, region := range regions {
+		if err := t.checkRegion(ctx, region.Name); err != nil {
+			return err
+		}
+		region.Name = t.regions.ToServer(region.Name)
 	}
+	return nil
 }
+
+// Check the tenant registered a shared memory region. Regions registered before the proxy
+// restarted are only known to TRTIS so its status is checked for regions not seen yet.
+func (t *TrtisProxy) checkRegion(ctx context.Context, name string) error {
+	if !t.regions.Registered(name) {
+		if _, err := t.sharedMemoryStatus(ctx); err != nil {
+			return err
+		}
+	}
+	if !t.regions.Registered(name) {
+		t.Log.Info("Rejected request for shared memory region", "region", name)
+		return status.Errorf(codes.PermissionDenied, "shared memory region %q was not registered through this proxy", name)
+	}
+	return nil
+}
+
+func (t *TrtisProxy) sharedMemoryStatus(ctx context.Context) (*trtis.SharedMemoryControlResponse, error) {
+	res, err := t.client.SharedMemoryControl(ctx, &trtis.SharedMemoryControlRequest{
+		SharedMemoryControl: &trtis.SharedMemoryControlRequest_Status_{Status: &trtis.SharedMemoryControlRequest_Status{}},
+	}, t.callOptions...)
+	return t.regionsToClient(res, err)
+}
+
+// Remove the regions of other tenants from a shared memory response
+func (t *TrtisProxy) regionsToClient(res *trtis.SharedMemoryControlResponse, err error) (*trtis.SharedMemoryControlResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+	if status := res.GetSharedMemoryStatus(); status != nil {
+		status.SharedMemoryRegion = t.regions.StatusToClient(status.SharedMemoryRegion)
+	}
+	return res, nil
+}
+
 func (t *TrtisProxy) Infer(ctx context.Context, req *trtis.InferRequest) (*trtis.InferResponse, error) {
-	t.Log.Info("Infer called")
-	return t.client.Infer(ctx, req, t.callOptions...)
+	req.ModelName = t.names.ToServer(req.ModelName)
+	if err := t.checkModel(req.ModelName); err != nil {
+		return nil, err
+	}
+	if err := t.regionsToServer(ctx, req); err != nil {
+		return nil, err
+	}
+	t.routeVersion(req)
+	res, err := t.inferClient.Infer(ctx, req, t.callOptions...)
+	if err != nil {
+		return nil, err
+	}
+	t.inferResponseToClient(res)
+	return res, nil
 }
 
 func (t *TrtisProxy) Status(ctx context.Context, req *trtis.StatusRequest) (*trtis.StatusResponse, error) {
-	t.Log.Info("Status called")
-	return t.client.Status(ctx, req, t.callOptions...)
+	if req.ModelName != "" {
+		req.ModelName = t.names.ToServer(req.ModelName)
+		if err := t.checkModel(req.ModelName); err != nil {
+			return nil, err
+		}
+	}
+	res, err := t.client.Status(ctx, req, t.callOptions...)
+	if err != nil {
+		return nil, err
+	}
+	t.models.FilterStatus(res.ServerStatus)
+	t.names.StatusToClient(res.ServerStatus)
+	return res, nil
 }
 
-func (t *TrtisProxy) Health(context.Context, *trtis.HealthRequest) (*trtis.HealthResponse, error) {
-	panic("implement me")
+func (t *TrtisProxy) Health(ctx context.Context, req *trtis.HealthRequest) (*trtis.HealthResponse, error) {
+	return t.client.Health(ctx, req, t.callOptions...)
 }
 
-func (t *TrtisProxy) StreamInfer(trtis.GRPCService_StreamInferServer) error {
-	panic("implement me")
+// Forward a stream of infer requests to TRTIS and its responses back to the client.
+// Each message is forwarded before the next is received so flow control on either
+// side holds back the other, and cancelling either stream cancels the other.
+func (t *TrtisProxy) StreamInfer(stream trtis.GRPCService_StreamInferServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	upstream, err := t.inferClient.StreamInfer(ctx, t.callOptions...)
+	if err != nil {
+		return err
+	}
+
+	requestErrs := make(chan error, 1)
+	go func() {
+		err := t.forwardStreamRequests(stream, upstream)
+		requestErrs <- err
+		if err != nil {
+			cancel()
+		}
+	}()
+
+	for {
+		res, err := upstream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Report why the requests stopped if that is what ended the upstream stream
+			select {
+			case requestErr := <-requestErrs:
+				if requestErr != nil {
+					return requestErr
+				}
+			default:
+			}
+			return err
+		}
+		t.inferResponseToClient(res)
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *TrtisProxy) forwardStreamRequests(stream trtis.GRPCService_StreamInferServer, upstream trtis.GRPCService_StreamInferClient) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return upstream.CloseSend()
+		}
+		if err != nil {
+			return err
+		}
+		req.ModelName = t.names.ToServer(req.ModelName)
+		if err := t.checkModel(req.ModelName); err != nil {
+			return err
+		}
+		if err := t.regionsToServer(stream.Context(), req); err != nil {
+			return err
+		}
+		t.routeVersion(req)
+		if err := upstream.Send(req); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *TrtisProxy) ModelControl(ctx context.Context, req *trtis.ModelControlRequest) (*trtis.ModelControlResponse, error) {
+	t.Log.Info("ModelControl called", "model", req.ModelName, "type", req.Type.String())
+	req.ModelName = t.names.ToServer(req.ModelName)
+	if err := t.checkModel(req.ModelName); err != nil {
+		return nil, err
+	}
+	return t.client.ModelControl(ctx, req, t.callOptions...)
 }
 
-func (t *TrtisProxy) ModelControl(context.Context, *trtis.ModelControlRequest) (*trtis.ModelControlResponse, error) {
-	panic("implement me")
+// Shared memory regions are registered server wide, so each tenant registers its regions under
+// prefixed names, only sees its own regions and may only unregister the regions it registered
+func (t *TrtisProxy) SharedMemoryControl(ctx context.Context, req *trtis.SharedMemoryControlRequest) (*trtis.SharedMemoryControlResponse, error) {
+	if t.regions == nil {
+		return t.client.SharedMemoryControl(ctx, req, t.callOptions...)
+	}
+	switch {
+	case req.GetRegister() != nil:
+		name := req.GetRegister().Name
+		req.GetRegister().Name = t.regions.ToServer(name)
+		res, err := t.client.SharedMemoryControl(ctx, req, t.callOptions...)
+		if err == nil {
+			t.regions.Add(name)
+		}
+		return t.regionsToClient(res, err)
+	case req.GetUnregister() != nil:
+		return t.unregisterRegion(ctx, req.GetUnregister().Name)
+	case req.GetUnregisterAll() != nil:
+		// Only the tenant's own regions are unregistered
+		if _, err := t.sharedMemoryStatus(ctx); err != nil {
+			return nil, err
+		}
+		res := &trtis.SharedMemoryControlResponse{}
+		for _, name := range t.regions.Names() {
+			var err error
+			if res, err = t.unregisterRegion(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case req.GetStatus() != nil:
+		return t.sharedMemoryStatus(ctx)
+	}
+	return nil, status.Error(codes.InvalidArgument, "unknown shared memory control request")
 }
 
-func (t *TrtisProxy) SharedMemoryControl(context.Context, *trtis.SharedMemoryControlRequest) (*trtis.SharedMemoryControlResponse, error) {
-	panic("implement me")
+func (t *TrtisProxy) unregisterRegion(ctx context.Context, name string) (*trtis.SharedMemoryControlResponse, error) {
+	if err := t.checkRegion(ctx, name); err != nil {
+		return nil, err
+	}
+	res, err := t.client.SharedMemoryControl(ctx, &trtis.SharedMemoryControlRequest{
+		SharedMemoryControl: &trtis.SharedMemoryControlRequest_Unregister_{
+			Unregister: &trtis.SharedMemoryControlRequest_Unregister{Name: t.regions.ToServer(name)},
+		},
+	}, t.callOptions...)
+	if err == nil {
+		t.regions.Remove(name)
+	}
+	return t.regionsToClient(res, err)
 }
 
-func (t *TrtisProxy) Repository(context.Context, *trtis.RepositoryRequest) (*trtis.RepositoryResponse, error) {
-	panic("implement me")
+func (t *TrtisProxy) Repository(ctx context.Context, req *trtis.RepositoryRequest) (*trtis.RepositoryResponse, error) {
+	res, err := t.client.Repository(ctx, req, t.callOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if index := res.GetIndex(); index != nil {
+		var models []*trtis.ModelRepositoryIndex_ModelEntry
+		for _, entry := range index.Models {
+			if t.models.Allowed(entry.Name) {
+				entry.Name = t.names.ToClient(entry.Name)
+				models = append(models, entry)
+			}
+		}
+		index.Models = models
+	}
+	return res, nil
 }
@@ -0,0 +1,310 @@
+package grpc
+
+import (
+	"context"
+	"github.com/onsi/gomega"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"github.com/seldonio/trtis-scheduler/proxy/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// Fake TRTIS server which echos the model name and version of requests
+type fakeTrtis struct {
+	trtis.UnimplementedGRPCServiceServer
+	mu      sync.Mutex
+	regions map[string]bool
+}
+
+// Registered shared memory regions are server wide
+func (f *fakeTrtis) SharedMemoryControl(ctx context.Context, req *trtis.SharedMemoryControlRequest) (*trtis.SharedMemoryControlResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.regions == nil {
+		f.regions = map[string]bool{}
+	}
+	switch {
+	case req.GetRegister() != nil:
+		f.regions[req.GetRegister().Name] = true
+	case req.GetUnregister() != nil:
+		delete(f.regions, req.GetUnregister().Name)
+	case req.GetUnregisterAll() != nil:
+		f.regions = map[string]bool{}
+	}
+	status := &trtis.SharedMemoryControlResponse_Status{}
+	for name := range f.regions {
+		status.SharedMemoryRegion = append(status.SharedMemoryRegion, &trtis.SharedMemoryRegion{Name: name})
+	}
+	return &trtis.SharedMemoryControlResponse{
+		SharedMemoryControl: &trtis.SharedMemoryControlResponse_SharedMemoryStatus{SharedMemoryStatus: status},
+	}, nil
+}
+
+func (f *fakeTrtis) Health(ctx context.Context, req *trtis.HealthRequest) (*trtis.HealthResponse, error) {
+	return &trtis.HealthResponse{Health: req.Mode == "live"}, nil
+}
+
+func (f *fakeTrtis) Infer(ctx context.Context, req *trtis.InferRequest) (*trtis.InferResponse, error) {
+	return &trtis.InferResponse{
+		RequestStatus: &trtis.RequestStatus{ServerId: req.ModelName, RequestId: uint64(req.ModelVersion)},
+	}, nil
+}
+
+func (f *fakeTrtis) StreamInfer(stream trtis.GRPCService_StreamInferServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		res, _ := f.Infer(stream.Context(), req)
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *fakeTrtis) ModelControl(ctx context.Context, req *trtis.ModelControlRequest) (*trtis.ModelControlResponse, error) {
+	return &trtis.ModelControlResponse{RequestStatus: &trtis.RequestStatus{ServerId: req.ModelName}}, nil
+}
+
+func (f *fakeTrtis) Repository(ctx context.Context, req *trtis.RepositoryRequest) (*trtis.RepositoryResponse, error) {
+	return &trtis.RepositoryResponse{
+		ResponseType: &trtis.RepositoryResponse_Index{Index: &trtis.ModelRepositoryIndex{
+			Models: []*trtis.ModelRepositoryIndex_ModelEntry{{Name: "mine"}, {Name: "theirs"}},
+		}},
+	}, nil
+}
+
+type fixedVersion int64
+
+func (v fixedVersion) ActiveVersion() int64 {
+	return int64(v)
+}
+
+// Serve a GRPC service over an in memory listener and return a connection to it
+func serve(g *gomega.GomegaWithT, register func(*grpc.Server), opts ...grpc.ServerOption) (*grpc.ClientConn, func()) {
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(opts...)
+	register(server)
+	go server.Serve(lis)
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	g.Expect(err).Should(gomega.BeNil())
+	return conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func startProxy(g *gomega.GomegaWithT) (trtis.GRPCServiceClient, func()) {
+	return startProxyFor(g, &fakeTrtis{}, "pod.")
+}
+
+func startProxyFor(g *gomega.GomegaWithT, server *fakeTrtis, regionPrefix string) (trtis.GRPCServiceClient, func()) {
+	trtisConn, stopTrtis := serve(g, func(s *grpc.Server) {
+		trtis.RegisterGRPCServiceServer(s, server)
+	})
+	proxy := NewTrtisProxy(NewTrtisClientFromConn(trtisConn), fixedVersion(2), model.NewAllowList([]string{"mine"}), model.NewNameMapper("", "mine"), model.NewRegionNames(regionPrefix))
+	proxyConn, stopProxy := serve(g, func(s *grpc.Server) {
+		trtis.RegisterGRPCServiceServer(s, proxy)
+	})
+	return trtis.NewGRPCServiceClient(proxyConn), func() {
+		stopProxy()
+		stopTrtis()
+	}
+}
+
+func TestProxyUnaryCalls(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	client, stop := startProxy(g)
+	defer stop()
+	ctx := context.Background()
+
+	health, err := client.Health(ctx, &trtis.HealthRequest{Mode: "live"})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(health.Health).Should(gomega.BeTrue())
+
+	res, err := client.Infer(ctx, &trtis.InferRequest{ModelName: "mine", ModelVersion: -1})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(res.RequestStatus.RequestId).Should(gomega.Equal(uint64(2)))
+
+	_, err = client.Infer(ctx, &trtis.InferRequest{ModelName: "theirs"})
+	g.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+
+	_, err = client.ModelControl(ctx, &trtis.ModelControlRequest{ModelName: "mine", Type: trtis.ModelControlRequest_UNLOAD})
+	g.Expect(err).Should(gomega.BeNil())
+	_, err = client.ModelControl(ctx, &trtis.ModelControlRequest{ModelName: "theirs", Type: trtis.ModelControlRequest_UNLOAD})
+	g.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+
+	repo, err := client.Repository(ctx, &trtis.RepositoryRequest{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(repo.GetIndex().Models).Should(gomega.HaveLen(1))
+	g.Expect(repo.GetIndex().Models[0].Name).Should(gomega.Equal("mine"))
+}
+
+func registerRegion(name string) *trtis.SharedMemoryControlRequest {
+	return &trtis.SharedMemoryControlRequest{
+		SharedMemoryControl: &trtis.SharedMemoryControlRequest_Register_{Register: &trtis.SharedMemoryControlRequest_Register{Name: name}},
+	}
+}
+
+func unregisterRegion(name string) *trtis.SharedMemoryControlRequest {
+	return &trtis.SharedMemoryControlRequest{
+		SharedMemoryControl: &trtis.SharedMemoryControlRequest_Unregister_{Unregister: &trtis.SharedMemoryControlRequest_Unregister{Name: name}},
+	}
+}
+
+func regionNames(res *trtis.SharedMemoryControlResponse) []string {
+	var names []string
+	for _, region := range res.GetSharedMemoryStatus().GetSharedMemoryRegion() {
+		names = append(names, region.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestProxySharedMemoryRegionsPerTenant(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	server := &fakeTrtis{}
+	mine, stopMine := startProxyFor(g, server, "mine.")
+	defer stopMine()
+	theirs, stopTheirs := startProxyFor(g, server, "theirs.")
+	defer stopTheirs()
+	ctx := context.Background()
+
+	_, err := mine.SharedMemoryControl(ctx, registerRegion("input"))
+	g.Expect(err).Should(gomega.BeNil())
+	res, err := theirs.SharedMemoryControl(ctx, registerRegion("input"))
+	g.Expect(err).Should(gomega.BeNil())
+	// Both tenants may use the same name and only see their own regions
+	g.Expect(regionNames(res)).Should(gomega.Equal([]string{"input"}))
+	g.Expect(server.regions).Should(gomega.HaveLen(2))
+	g.Expect(server.regions).Should(gomega.HaveKey("mine.input"))
+
+	// Regions registered by another tenant can not be used or removed
+	_, err = mine.SharedMemoryControl(ctx, registerRegion("output"))
+	g.Expect(err).Should(gomega.BeNil())
+	_, err = theirs.SharedMemoryControl(ctx, unregisterRegion("output"))
+	g.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+	_, err = theirs.Infer(ctx, &trtis.InferRequest{ModelName: "mine", MetaData: &trtis.InferRequestHeader{
+		Output: []*trtis.InferRequestHeader_Output{{Name: "OUTPUT0", SharedMemory: &trtis.InferSharedMemory{Name: "output"}}},
+	}})
+	g.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+	_, err = mine.Infer(ctx, &trtis.InferRequest{ModelName: "mine", MetaData: &trtis.InferRequestHeader{
+		Output: []*trtis.InferRequestHeader_Output{{Name: "OUTPUT0", SharedMemory: &trtis.InferSharedMemory{Name: "output"}}},
+	}})
+	g.Expect(err).Should(gomega.BeNil())
+
+	// Unregistering all only removes the tenant's own regions
+	res, err = theirs.SharedMemoryControl(ctx, &trtis.SharedMemoryControlRequest{
+		SharedMemoryControl: &trtis.SharedMemoryControlRequest_UnregisterAll_{UnregisterAll: &trtis.SharedMemoryControlRequest_UnregisterAll{}},
+	})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(regionNames(res)).Should(gomega.BeEmpty())
+	res, err = mine.SharedMemoryControl(ctx, &trtis.SharedMemoryControlRequest{
+		SharedMemoryControl: &trtis.SharedMemoryControlRequest_Status_{Status: &trtis.SharedMemoryControlRequest_Status{}},
+	})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(regionNames(res)).Should(gomega.Equal([]string{"input", "output"}))
+}
+
+func TestProxyStreamInfer(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	client, stop := startProxy(g)
+	defer stop()
+
+	stream, err := client.StreamInfer(context.Background())
+	g.Expect(err).Should(gomega.BeNil())
+	for i := 0; i < 3; i++ {
+		g.Expect(stream.Send(&trtis.InferRequest{ModelName: "mine", ModelVersion: -1})).Should(gomega.BeNil())
+		res, err := stream.Recv()
+		g.Expect(err).Should(gomega.BeNil())
+		g.Expect(res.RequestStatus.ServerId).Should(gomega.Equal("mine"))
+		g.Expect(res.RequestStatus.RequestId).Should(gomega.Equal(uint64(2)))
+	}
+	g.Expect(stream.CloseSend()).Should(gomega.BeNil())
+	_, err = stream.Recv()
+	g.Expect(err).Should(gomega.Equal(io.EOF))
+
+	stream, err = client.StreamInfer(context.Background())
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(stream.Send(&trtis.InferRequest{ModelName: "theirs"})).Should(gomega.BeNil())
+	_, err = stream.Recv()
+	g.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+}
+
+func TestProxyStreamInferCancel(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	client, stop := startProxy(g)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.StreamInfer(ctx)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(stream.Send(&trtis.InferRequest{ModelName: "mine"})).Should(gomega.BeNil())
+	_, err = stream.Recv()
+	g.Expect(err).Should(gomega.BeNil())
+	cancel()
+	_, err = stream.Recv()
+	g.Expect(status.Code(err)).Should(gomega.Equal(codes.Canceled))
+}
+
+func TestProxySendsOnlyInferenceThroughDispatcher(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	trtisConn, stopTrtis := serve(g, func(s *grpc.Server) {
+		trtis.RegisterGRPCServiceServer(s, &fakeTrtis{})
+	})
+	defer stopTrtis()
+	trtisClient := NewTrtisClientFromConn(trtisConn)
+	dispatcher := NewTrtisProxy(trtisClient, nil, model.NewAllowList([]string{"mine"}), model.NewNameMapper("", ""), nil)
+	dispatcherConn, stopDispatcher := serve(g, func(s *grpc.Server) {
+		trtis.RegisterGRPCServiceServer(s, dispatcher)
+	},
+		grpc.ChainUnaryInterceptor(InferenceOnlyUnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(InferenceOnlyStreamServerInterceptor()),
+	)
+	defer stopDispatcher()
+	ctx := context.Background()
+
+	// The dispatcher serves inference for the models it allows and nothing else
+	direct := trtis.NewGRPCServiceClient(dispatcherConn)
+	_, err := direct.Infer(ctx, &trtis.InferRequest{ModelName: "mine"})
+	g.Expect(err).Should(gomega.BeNil())
+	_, err = direct.Infer(ctx, &trtis.InferRequest{ModelName: "theirs"})
+	g.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+	_, err = direct.Status(ctx, &trtis.StatusRequest{})
+	g.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+	_, err = direct.SharedMemoryControl(ctx, registerRegion("theirs"))
+	g.Expect(status.Code(err)).Should(gomega.Equal(codes.PermissionDenied))
+
+	// A proxy sends its inference through the dispatcher and its other calls straight to TRTIS
+	proxy := NewTrtisProxy(trtisClient, nil, model.NewAllowList([]string{"mine"}), model.NewNameMapper("", "mine"), model.NewRegionNames("pod."))
+	proxy.SetInferClient(NewTrtisClientFromConn(dispatcherConn))
+	proxyConn, stopProxy := serve(g, func(s *grpc.Server) {
+		trtis.RegisterGRPCServiceServer(s, proxy)
+	})
+	defer stopProxy()
+	client := trtis.NewGRPCServiceClient(proxyConn)
+	res, err := client.Infer(ctx, &trtis.InferRequest{ModelName: "mine"})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(res.RequestStatus.ServerId).Should(gomega.Equal("mine"))
+	stream, err := client.StreamInfer(ctx)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(stream.Send(&trtis.InferRequest{ModelName: "mine"})).Should(gomega.Succeed())
+	_, err = stream.Recv()
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(stream.CloseSend()).Should(gomega.Succeed())
+	_, err = client.SharedMemoryControl(ctx, registerRegion("input"))
+	g.Expect(err).Should(gomega.BeNil())
+}
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"net/http"
+)
+
+// Reports whether the proxy can serve requests for its model
+type ReadinessChecker interface {
+	Ready() bool
+	Reason() string
+}
+
+// Serve /ready, which fails while the model is not ready in TRTIS so Services stop
+// routing to the pod, and /live, which succeeds while the proxy is running
+func HealthHandler(readiness ReadinessChecker) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if readiness != nil && !readiness.Ready() {
+			http.Error(w, readiness.Reason(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/live", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	return mux
+}
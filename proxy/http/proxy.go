@@ -0,0 +1,272 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"github.com/seldonio/trtis-scheduler/proxy/grpc"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	API_INFER_PREFIX         = "/api/infer/"
+	API_STATUS_PATH          = "/api/status"
+	API_HEALTH_PREFIX        = "/api/health/"
+	API_MODEL_CONTROL_PREFIX = "/api/modelcontrol/"
+)
+
+const (
+	HEADER_INFER_REQUEST  = "NV-InferRequest"
+	HEADER_INFER_RESPONSE = "NV-InferResponse"
+)
+
+// Reverse proxy to the TRTIS http API
+type TrtisHttpProxy struct {
+	log      logr.Logger
+	proxy    *httputil.ReverseProxy
+	versions grpc.VersionRouter
+	models   grpc.ModelFilter
+	names    grpc.ModelNames
+	regions  grpc.SharedMemoryRegions
+}
+
+func NewTrtisHttpProxy(host string, port int, versions grpc.VersionRouter, models grpc.ModelFilter, names grpc.ModelNames, regions grpc.SharedMemoryRegions, log logr.Logger) (*TrtisHttpProxy, error) {
+	target, err := url.Parse(fmt.Sprintf("http://%s:%d", host, port))
+	if err != nil {
+		return nil, err
+	}
+	p := &TrtisHttpProxy{
+		log:      log.WithName("TrtisHttpProxy"),
+		proxy:    httputil.NewSingleHostReverseProxy(target),
+		versions: versions,
+		models:   models,
+		names:    names,
+		regions:  regions,
+	}
+	p.proxy.ModifyResponse = p.modifyResponse
+	return p, nil
+}
+
+// Send infer requests to a different server, e.g. a fair share dispatcher in front of TRTIS
+func (p *TrtisHttpProxy) SetInferTarget(host string, port int) error {
+	target, err := url.Parse(fmt.Sprintf("http://%s:%d", host, port))
+	if err != nil {
+		return err
+	}
+	director := p.proxy.Director
+	inferDirector := httputil.NewSingleHostReverseProxy(target).Director
+	p.proxy.Director = func(req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, API_INFER_PREFIX) {
+			inferDirector(req)
+		} else {
+			director(req)
+		}
+	}
+	return nil
+}
+
+// Wrap the transport used to send requests to TRTIS
+func (p *TrtisHttpProxy) WrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	transport := p.proxy.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	p.proxy.Transport = wrap(transport)
+}
+
+func (p *TrtisHttpProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !p.rewritePath(req) {
+		p.log.Info("Rejected request", "path", req.URL.Path)
+		http.Error(w, "model is not available through this proxy", http.StatusForbidden)
+		return
+	}
+	if !p.rewriteRegions(req) {
+		p.log.Info("Rejected request for shared memory region", "path", req.URL.Path)
+		http.Error(w, "shared memory region was not registered through this proxy", http.StatusForbidden)
+		return
+	}
+	p.proxy.ServeHTTP(w, req)
+}
+
+// Only serve infer requests, for servers in front of TRTIS which must not let clients
+// read or change the models of the server
+func InferenceOnly(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, API_INFER_PREFIX) {
+			http.Error(w, "only inference is served", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// Rename the shared memory regions in an infer request header to their server names. Shared memory
+// is registered through the GRPC API so returns false if a region was not registered through it.
+func (p *TrtisHttpProxy) rewriteRegions(req *http.Request) bool {
+	header := req.Header.Get(HEADER_INFER_REQUEST)
+	if p.regions == nil || header == "" {
+		return true
+	}
+	inferHeader := &trtis.InferRequestHeader{}
+	if err := proto.UnmarshalText(header, inferHeader); err != nil {
+		// Left for TRTIS to reject
+		return true
+	}
+	var regions []*trtis.InferSharedMemory
+	for _, input := range inferHeader.Input {
+		if input.SharedMemory != nil {
+			regions = append(regions, input.SharedMemory)
+		}
+	}
+	for _, output := range inferHeader.Output {
+		if output.SharedMemory != nil {
+			regions = append(regions, output.SharedMemory)
+		}
+	}
+	if len(regions) == 0 {
+		return true
+	}
+	for _, region := range regions {
+		if !p.regions.Registered(region.Name) {
+			return false
+		}
+		region.Name = p.regions.ToServer(region.Name)
+	}
+	req.Header.Set(HEADER_INFER_REQUEST, proto.CompactTextString(inferHeader))
+	return true
+}
+
+// Get the path segments following a prefix
+func pathSegments(path, prefix string) []string {
+	return strings.Split(strings.Trim(strings.TrimPrefix(path, prefix), "/"), "/")
+}
+
+// Whether a path has no dot segments or repeated slashes. TRTIS resolves those to another path than
+// the one the model was checked on, e.g. /api/infer/allowed/../other
+func isCleanPath(path string) bool {
+	if !strings.HasPrefix(path, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(strings.TrimSuffix(path[1:], "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func isServerStatus(path string) bool {
+	return path == API_STATUS_PATH || path == API_STATUS_PATH+"/"
+}
+
+// Rewrite the model in a request path to its server name and send requests for the
+// latest version to the active version. Returns false if the request is for a model
+// which is not allowed.
+func (p *TrtisHttpProxy) rewritePath(req *http.Request) bool {
+	path := req.URL.Path
+	if !isCleanPath(path) {
+		return false
+	}
+	var prefix string
+	var segments []string
+	modelSegment := 0
+	switch {
+	case isServerStatus(path):
+		// Server wide status is filtered in the response
+		return true
+	case strings.HasPrefix(path, API_HEALTH_PREFIX):
+		return true
+	case strings.HasPrefix(path, API_STATUS_PATH+"/"):
+		prefix = API_STATUS_PATH + "/"
+		segments = pathSegments(path, prefix)
+	case strings.HasPrefix(path, API_INFER_PREFIX):
+		prefix = API_INFER_PREFIX
+		segments = pathSegments(path, prefix)
+		// Infer requests without a version, /api/infer/<model>, go to the active version
+		if len(segments) == 1 && p.versions != nil {
+			if version := p.versions.ActiveVersion(); version >= 0 {
+				segments = append(segments, strconv.FormatInt(version, 10))
+			}
+		}
+	case strings.HasPrefix(path, API_MODEL_CONTROL_PREFIX):
+		// /api/modelcontrol/<load|unload>/<model>
+		prefix = API_MODEL_CONTROL_PREFIX
+		segments = pathSegments(path, prefix)
+		if len(segments) != 2 {
+			return false
+		}
+		modelSegment = 1
+	default:
+		return false
+	}
+	segments[modelSegment] = p.names.ToServer(segments[modelSegment])
+	if !p.models.Allowed(segments[modelSegment]) {
+		return false
+	}
+	req.URL.Path = prefix + strings.Join(segments, "/")
+	req.URL.RawPath = ""
+	return true
+}
+
+func (p *TrtisHttpProxy) modifyResponse(res *http.Response) error {
+	if header := res.Header.Get(HEADER_INFER_RESPONSE); header != "" {
+		inferHeader := &trtis.InferResponseHeader{}
+		if err := proto.UnmarshalText(header, inferHeader); err == nil {
+			inferHeader.ModelName = p.names.ToClient(inferHeader.ModelName)
+			res.Header.Set(HEADER_INFER_RESPONSE, proto.CompactTextString(inferHeader))
+		}
+	}
+	if strings.HasPrefix(res.Request.URL.Path, API_STATUS_PATH) && res.StatusCode == http.StatusOK {
+		return p.filterStatus(res)
+	}
+	return nil
+}
+
+// Remove models which are not allowed from status responses and give models their client names
+func (p *TrtisHttpProxy) filterStatus(res *http.Response) error {
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	format := res.Request.URL.Query().Get("format")
+	status := &trtis.ServerStatus{}
+	switch format {
+	case "binary":
+		err = proto.Unmarshal(body, status)
+	case "json":
+		err = jsonpb.Unmarshal(bytes.NewReader(body), status)
+	default:
+		err = proto.UnmarshalText(string(body), status)
+	}
+	if err != nil {
+		return err
+	}
+	p.models.FilterStatus(status)
+	p.names.StatusToClient(status)
+	switch format {
+	case "binary":
+		body, err = proto.Marshal(status)
+	case "json":
+		var json string
+		json, err = (&jsonpb.Marshaler{}).MarshalToString(status)
+		body = []byte(json)
+	default:
+		body = []byte(proto.MarshalTextString(status))
+	}
+	if err != nil {
+		return err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
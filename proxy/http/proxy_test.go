@@ -0,0 +1,191 @@
+package http
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/onsi/gomega"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"github.com/seldonio/trtis-scheduler/proxy/model"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"strconv"
+	"testing"
+)
+
+type fixedVersion int64
+
+func (v fixedVersion) ActiveVersion() int64 {
+	return int64(v)
+}
+
+func newTestProxy(g *gomega.GomegaWithT, paths *[]string, names *model.NameMapper, regions *model.RegionNames) (*httptest.Server, *TrtisHttpProxy) {
+	trtisServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*paths = append(*paths, r.URL.Path)
+		// Echo the infer request header so tests can check how it was rewritten
+		w.Header().Set(HEADER_INFER_REQUEST, r.Header.Get(HEADER_INFER_REQUEST))
+		if r.URL.Path == "/api/infer/mine/3" {
+			w.Header().Set(HEADER_INFER_RESPONSE, `model_name: "mine" model_version: 3`)
+		}
+		if r.URL.Path == API_STATUS_PATH {
+			status := &trtis.ServerStatus{
+				ModelStatus: map[string]*trtis.ModelStatus{
+					"mine":   {},
+					"theirs": {},
+				},
+			}
+			w.Write([]byte(proto.MarshalTextString(status)))
+		}
+	}))
+	host, port, err := net.SplitHostPort(trtisServer.Listener.Addr().String())
+	g.Expect(err).Should(gomega.BeNil())
+	portNum, err := strconv.Atoi(port)
+	g.Expect(err).Should(gomega.BeNil())
+	proxy, err := NewTrtisHttpProxy(host, portNum, fixedVersion(3), model.NewAllowList([]string{"mine"}), names, regions, logf.Log)
+	g.Expect(err).Should(gomega.BeNil())
+	return trtisServer, proxy
+}
+
+func TestProxyOnlyAllowsOwnModel(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var paths []string
+	trtisServer, proxy := newTestProxy(g, &paths, model.NewNameMapper("", "mine"), model.NewRegionNames("pod."))
+	defer trtisServer.Close()
+
+	for path, code := range map[string]int{
+		"/api/infer/mine":                 http.StatusOK,
+		"/api/infer/theirs":               http.StatusForbidden,
+		"/api/status/mine":                http.StatusOK,
+		"/api/status/theirs":              http.StatusForbidden,
+		"/api/modelcontrol/load/mine":     http.StatusOK,
+		"/api/modelcontrol/unload/theirs": http.StatusForbidden,
+		"/api/health/live":                http.StatusOK,
+		"/api/sharedmemorycontrol/status": http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		g.Expect(w.Code).Should(gomega.Equal(code), path)
+	}
+	g.Expect(paths).Should(gomega.ContainElement("/api/infer/mine/3"))
+	g.Expect(paths).ShouldNot(gomega.ContainElement("/api/infer/theirs"))
+}
+
+func TestProxyFiltersServerStatus(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var paths []string
+	trtisServer, proxy := newTestProxy(g, &paths, model.NewNameMapper("", "mine"), model.NewRegionNames("pod."))
+	defer trtisServer.Close()
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest("GET", API_STATUS_PATH, nil))
+	g.Expect(w.Code).Should(gomega.Equal(http.StatusOK))
+	body, err := ioutil.ReadAll(w.Body)
+	g.Expect(err).Should(gomega.BeNil())
+	status := &trtis.ServerStatus{}
+	g.Expect(proto.UnmarshalText(string(body), status)).Should(gomega.BeNil())
+	g.Expect(status.ModelStatus).Should(gomega.HaveKey("mine"))
+	g.Expect(status.ModelStatus).ShouldNot(gomega.HaveKey("theirs"))
+}
+
+func TestProxyMapsModelNames(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var paths []string
+	trtisServer, proxy := newTestProxy(g, &paths, model.NewNameMapper("resnet", "mine"), model.NewRegionNames("pod."))
+	defer trtisServer.Close()
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest("GET", "/api/infer/resnet", nil))
+	g.Expect(w.Code).Should(gomega.Equal(http.StatusOK))
+	g.Expect(paths).Should(gomega.ContainElement("/api/infer/mine/3"))
+	inferHeader := &trtis.InferResponseHeader{}
+	g.Expect(proto.UnmarshalText(w.Header().Get(HEADER_INFER_RESPONSE), inferHeader)).Should(gomega.BeNil())
+	g.Expect(inferHeader.ModelName).Should(gomega.Equal("resnet"))
+
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest("GET", API_STATUS_PATH, nil))
+	status := &trtis.ServerStatus{}
+	g.Expect(proto.UnmarshalText(w.Body.String(), status)).Should(gomega.BeNil())
+	g.Expect(status.ModelStatus).Should(gomega.HaveLen(1))
+	g.Expect(status.ModelStatus).Should(gomega.HaveKey("resnet"))
+}
+
+func TestProxyRewritesSharedMemoryRegions(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var paths []string
+	regions := model.NewRegionNames("pod.")
+	regions.Add("input")
+	trtisServer, proxy := newTestProxy(g, &paths, model.NewNameMapper("", "mine"), regions)
+	defer trtisServer.Close()
+
+	req := httptest.NewRequest("POST", "/api/infer/mine", nil)
+	req.Header.Set(HEADER_INFER_REQUEST, `batch_size: 1 input { name: "INPUT0" shared_memory { name: "input" byte_size: 64 } }`)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	g.Expect(w.Code).Should(gomega.Equal(http.StatusOK))
+	inferHeader := &trtis.InferRequestHeader{}
+	g.Expect(proto.UnmarshalText(w.Header().Get(HEADER_INFER_REQUEST), inferHeader)).Should(gomega.BeNil())
+	g.Expect(inferHeader.Input[0].SharedMemory.Name).Should(gomega.Equal("pod.input"))
+
+	// Regions of other tenants can not be read from or written to
+	req = httptest.NewRequest("POST", "/api/infer/mine", nil)
+	req.Header.Set(HEADER_INFER_REQUEST, `batch_size: 1 output { name: "OUTPUT0" shared_memory { name: "other.output" byte_size: 64 } }`)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, req)
+	g.Expect(w.Code).Should(gomega.Equal(http.StatusForbidden))
+}
+
+func TestProxyRejectsPathsResolvingToOtherModels(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var paths []string
+	trtisServer, proxy := newTestProxy(g, &paths, model.NewNameMapper("", "mine"), model.NewRegionNames("pod."))
+	defer trtisServer.Close()
+
+	for _, path := range []string{
+		"/api/infer/mine/../theirs",
+		"/api/infer/mine/./../../infer/theirs",
+		"/api/health/../infer/theirs",
+		"/api/status//theirs",
+		"//api/infer/mine",
+		"/api/modelcontrol/load/mine/..",
+	} {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		g.Expect(w.Code).Should(gomega.Equal(http.StatusForbidden), path)
+	}
+	g.Expect(paths).Should(gomega.BeEmpty())
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest("GET", "/api/status/", nil))
+	g.Expect(w.Code).Should(gomega.Equal(http.StatusOK))
+}
+
+func TestProxySendsOnlyInferenceToInferTarget(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var paths, dispatched []string
+	trtisServer, proxy := newTestProxy(g, &paths, model.NewNameMapper("", "mine"), model.NewRegionNames("pod."))
+	defer trtisServer.Close()
+	dispatcher := httptest.NewServer(InferenceOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dispatched = append(dispatched, r.URL.Path)
+	})))
+	defer dispatcher.Close()
+	host, port, err := net.SplitHostPort(dispatcher.Listener.Addr().String())
+	g.Expect(err).Should(gomega.BeNil())
+	portNum, err := strconv.Atoi(port)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(proxy.SetInferTarget(host, portNum)).Should(gomega.Succeed())
+
+	for _, path := range []string{"/api/infer/mine", "/api/status/mine"} {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		g.Expect(w.Code).Should(gomega.Equal(http.StatusOK), path)
+	}
+	g.Expect(dispatched).Should(gomega.Equal([]string{"/api/infer/mine/3"}))
+	g.Expect(paths).Should(gomega.Equal([]string{"/api/status/mine"}))
+
+	res, err := http.Get(dispatcher.URL + "/api/status")
+	g.Expect(err).Should(gomega.BeNil())
+	res.Body.Close()
+	g.Expect(res.StatusCode).Should(gomega.Equal(http.StatusForbidden))
+	g.Expect(dispatched).Should(gomega.HaveLen(1))
+}
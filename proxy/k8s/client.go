@@ -2,6 +2,9 @@ package k8s
 
 import (
 	"github.com/go-logr/logr"
+	"github.com/seldonio/trtis-scheduler/common/events"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"os"
@@ -10,6 +13,11 @@ import (
 const (
 	POD_NAME_ENV = "POD_NAME"
 	POD_NAMESPACE_ENV = "POD_NAMESPACE"
+	NODE_NAME_ENV = "NODE_NAME"
+
+	ANNOTATION_MODEL_NAME = "seldon.io/trtis-model-name" // Name of model on TRTIS server set by loader
+	ANNOTATION_CLIENT_MODEL_NAME = "seldon.io/trtis-client-model-name" // Name clients use for the model set by loader
+	ANNOTATION_ENSEMBLE_MEMBERS = "seldon.io/trtis-ensemble-members" // Ensemble composing models installed by loader
 )
 
 type K8sManager struct {
@@ -17,6 +25,7 @@ type K8sManager struct {
 	client *kubernetes.Clientset
 	podName string
 	podNamespace string
+	recorder *events.Recorder
 }
 
 func NewK8sManager(log logr.Logger) (*K8sManager, error) {
@@ -39,6 +48,7 @@ func NewK8sManager(log logr.Logger) (*K8sManager, error) {
 			client: client,
 			podName: podName,
 			podNamespace: podNamespace,
+			recorder: newEventRecorder(client),
 		}, nil
 	}
 }
@@ -59,5 +69,14 @@ func getK8sClient(log logr.Logger) (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
+func (k *K8sManager) GetPod() (*v1.Pod, error) {
+	return k.client.CoreV1().Pods(k.podNamespace).Get(k.podName, metav1.GetOptions{})
+}
 
-
+func (k *K8sManager) GetPodAnnotations() (map[string]string, error) {
+	pod, err := k.client.CoreV1().Pods(k.podNamespace).Get(k.podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return pod.Annotations, nil
+}
@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"github.com/go-logr/logr"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Models served for the pods on a node: each pod's model and the ensemble members its loader installed
+type nodeModels struct {
+	mu        sync.Mutex
+	pods      map[string][]string
+	setModels func(models []string)
+}
+
+func podModels(pod *v1.Pod) []string {
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return nil
+	}
+	var models []string
+	if modelName := pod.Annotations[ANNOTATION_MODEL_NAME]; modelName != "" {
+		models = append(models, modelName)
+	}
+	if members := pod.Annotations[ANNOTATION_ENSEMBLE_MEMBERS]; members != "" {
+		models = append(models, strings.Split(members, ",")...)
+	}
+	return models
+}
+
+func (n *nodeModels) update(key string, models []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(models) == 0 {
+		delete(n.pods, key)
+	} else {
+		n.pods[key] = models
+	}
+	seen := map[string]bool{}
+	var all []string
+	for _, models := range n.pods {
+		for _, model := range models {
+			if !seen[model] {
+				seen[model] = true
+				all = append(all, model)
+			}
+		}
+	}
+	sort.Strings(all)
+	n.setModels(all)
+}
+
+// Watch the model pods on a node and call setModels with the models served for them whenever they change
+func WatchNodeModels(nodeName string, setModels func(models []string), stop <-chan struct{}, log logr.Logger) error {
+	n := &nodeModels{pods: map[string][]string{}, setModels: setModels}
+	update := func(obj interface{}) {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			return
+		}
+		n.update(pod.Namespace+"/"+pod.Name, podModels(pod))
+	}
+	return watchNodePods(nodeName, cache.ResourceEventHandlerFuncs{
+		AddFunc: update,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			update(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*v1.Pod); ok {
+				n.update(pod.Namespace+"/"+pod.Name, nil)
+			}
+		},
+	}, stop, log)
+}
@@ -0,0 +1,69 @@
+package k8s
+
+import (
+	"github.com/go-logr/logr"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"strconv"
+)
+
+const ANNOTATION_FAIR_SHARE_WEIGHT = "seldon.io/trtis-fair-share-weight" // Share of the TRTIS server for the pod's model
+
+// Watch the model pods on a node and call setWeight with the fair share weight of each model,
+// and removeWeight when a model's pod goes or drops its weight
+func WatchModelWeights(nodeName string, setWeight func(modelName string, weight float64), removeWeight func(modelName string), stop <-chan struct{}, log logr.Logger) error {
+	update := func(obj interface{}) {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			return
+		}
+		modelName := pod.Annotations[ANNOTATION_MODEL_NAME]
+		weight, ok := pod.Annotations[ANNOTATION_FAIR_SHARE_WEIGHT]
+		if modelName == "" {
+			return
+		}
+		if !ok {
+			removeWeight(modelName)
+			return
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w <= 0 {
+			log.Info("Invalid fair share weight", "pod", pod.Name, "weight", weight)
+			return
+		}
+		log.Info("Model weight", "model", modelName, "weight", w)
+		setWeight(modelName, w)
+	}
+	return watchNodePods(nodeName, cache.ResourceEventHandlerFuncs{
+		AddFunc: update,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			update(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			pod, ok := obj.(*v1.Pod)
+			if !ok || pod.Annotations[ANNOTATION_MODEL_NAME] == "" {
+				return
+			}
+			log.Info("Removing model weight", "model", pod.Annotations[ANNOTATION_MODEL_NAME])
+			removeWeight(pod.Annotations[ANNOTATION_MODEL_NAME])
+		},
+	}, stop, log)
+}
+
+func watchNodePods(nodeName string, handler cache.ResourceEventHandler, stop <-chan struct{}, log logr.Logger) error {
+	client, err := getK8sClient(log)
+	if client == nil || err != nil {
+		return err
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.FieldSelector = "spec.nodeName=" + nodeName
+	}))
+	factory.Core().V1().Pods().Informer().AddEventHandler(handler)
+	factory.Start(stop)
+	return nil
+}
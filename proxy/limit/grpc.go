@@ -0,0 +1,66 @@
+package limit
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	METHOD_INFER        = "/nvidia.inferenceserver.GRPCService/Infer"
+	METHOD_STREAM_INFER = "/nvidia.inferenceserver.GRPCService/StreamInfer"
+)
+
+// Limit Infer calls, rejecting calls over the limits with ResourceExhausted
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if info.FullMethod != METHOD_INFER {
+			return handler(ctx, req)
+		}
+		release, err := l.Acquire()
+		if err != nil {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// Limit StreamInfer calls. An open stream counts as one request in flight and each request
+// received on it takes a rate token. Requests over the rate wait for a token rather than fail,
+// as an error would end the stream and the other requests in flight on it.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if info.FullMethod != METHOD_STREAM_INFER {
+			return handler(srv, stream)
+		}
+		release, err := l.Acquire()
+		if err != nil {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		defer release()
+		return handler(srv, &limitedStream{ServerStream: stream, limiter: l})
+	}
+}
+
+type limitedStream struct {
+	grpc.ServerStream
+	limiter *Limiter
+	first   bool
+}
+
+func (s *limitedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	// The token for the first request was taken when the stream was opened
+	if !s.first {
+		s.first = true
+		return nil
+	}
+	if err := s.limiter.Wait(s.Context()); err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package limit
+
+import (
+	"net/http"
+	"strings"
+)
+
+const API_INFER_PREFIX = "/api/infer/"
+
+// Limit http infer requests, rejecting requests over the limits with 429 Too Many Requests
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, API_INFER_PREFIX) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		release, err := l.Acquire()
+		if err != nil {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,129 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/time/rate"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ANNOTATION_RATE_LIMIT    = "seldon.io/trtis-rate-limit"    // Requests per second
+	ANNOTATION_RATE_BURST    = "seldon.io/trtis-rate-burst"    // Requests allowed above the rate in a burst
+	ANNOTATION_MAX_IN_FLIGHT = "seldon.io/trtis-max-in-flight" // Requests being processed at once
+
+	REASON_RATE      = "rate"
+	REASON_IN_FLIGHT = "in-flight"
+)
+
+var (
+	ErrRateLimited     = errors.New("request rate limit exceeded")
+	ErrTooManyInFlight = errors.New("too many requests in flight")
+)
+
+// Limits on the inference requests of a model. Zero values are unlimited.
+type Limits struct {
+	Rate        float64
+	Burst       int
+	MaxInFlight int
+}
+
+// Override limits with any set in pod annotations
+func (l Limits) WithAnnotations(annotations map[string]string) (Limits, error) {
+	if v, ok := annotations[ANNOTATION_RATE_LIMIT]; ok {
+		r, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || r < 0 {
+			return l, fmt.Errorf("invalid %s annotation %q", ANNOTATION_RATE_LIMIT, v)
+		}
+		l.Rate = r
+	}
+	if v, ok := annotations[ANNOTATION_RATE_BURST]; ok {
+		b, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || b < 0 {
+			return l, fmt.Errorf("invalid %s annotation %q", ANNOTATION_RATE_BURST, v)
+		}
+		l.Burst = b
+	}
+	if v, ok := annotations[ANNOTATION_MAX_IN_FLIGHT]; ok {
+		m, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || m < 0 {
+			return l, fmt.Errorf("invalid %s annotation %q", ANNOTATION_MAX_IN_FLIGHT, v)
+		}
+		l.MaxInFlight = m
+	}
+	return l, nil
+}
+
+// Token bucket rate limit and maximum requests in flight for one model
+type Limiter struct {
+	modelName   string
+	rate        *rate.Limiter
+	maxInFlight int
+	mu          sync.Mutex
+	inFlight    int
+}
+
+func NewLimiter(limits Limits, modelName string) *Limiter {
+	l := &Limiter{
+		modelName:   modelName,
+		maxInFlight: limits.MaxInFlight,
+	}
+	if limits.Rate > 0 {
+		burst := limits.Burst
+		if burst < 1 {
+			// Allow at least one request, and a second's worth of requests by default
+			burst = int(limits.Rate)
+			if burst < 1 {
+				burst = 1
+			}
+		}
+		l.rate = rate.NewLimiter(rate.Limit(limits.Rate), burst)
+	}
+	return l
+}
+
+// Take a rate token without taking an in flight slot
+func (l *Limiter) Allow() error {
+	if l.rate != nil && !l.rate.Allow() {
+		limitedRequests.WithLabelValues(l.modelName, REASON_RATE).Inc()
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// Take a rate token, waiting for one if none is free. Fails if the context ends first.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l.rate == nil || l.rate.Allow() {
+		return nil
+	}
+	delayedRequests.WithLabelValues(l.modelName).Inc()
+	return l.rate.Wait(ctx)
+}
+
+// Start a request if the limits allow it. The release function must be called when the request completes.
+// The in flight limit is checked first so requests rejected for it do not use up rate tokens.
+func (l *Limiter) Acquire() (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxInFlight > 0 && l.inFlight >= l.maxInFlight {
+		limitedRequests.WithLabelValues(l.modelName, REASON_IN_FLIGHT).Inc()
+		return nil, ErrTooManyInFlight
+	}
+	if err := l.Allow(); err != nil {
+		return nil, err
+	}
+	l.inFlight++
+	inFlightRequests.WithLabelValues(l.modelName).Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.inFlight--
+			l.mu.Unlock()
+			inFlightRequests.WithLabelValues(l.modelName).Dec()
+		})
+	}, nil
+}
@@ -0,0 +1,113 @@
+package limit
+
+import (
+	"context"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	l := NewLimiter(Limits{MaxInFlight: 2}, "model")
+	release1, err := l.Acquire()
+	g.Expect(err).Should(gomega.BeNil())
+	release2, err := l.Acquire()
+	g.Expect(err).Should(gomega.BeNil())
+	_, err = l.Acquire()
+	g.Expect(err).Should(gomega.Equal(ErrTooManyInFlight))
+	release1()
+	release1()
+	_, err = l.Acquire()
+	g.Expect(err).Should(gomega.BeNil())
+	_, err = l.Acquire()
+	g.Expect(err).Should(gomega.Equal(ErrTooManyInFlight))
+	release2()
+}
+
+func TestRateLimit(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	l := NewLimiter(Limits{Rate: 0.001, Burst: 2}, "model")
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire()
+		g.Expect(err).Should(gomega.BeNil())
+		release()
+	}
+	_, err := l.Acquire()
+	g.Expect(err).Should(gomega.Equal(ErrRateLimited))
+}
+
+func TestInFlightRejectionKeepsRateToken(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	l := NewLimiter(Limits{Rate: 0.001, Burst: 2, MaxInFlight: 1}, "model")
+	release, err := l.Acquire()
+	g.Expect(err).Should(gomega.BeNil())
+	_, err = l.Acquire()
+	g.Expect(err).Should(gomega.Equal(ErrTooManyInFlight))
+	release()
+	// The rejected request did not take the second token
+	_, err = l.Acquire()
+	g.Expect(err).Should(gomega.BeNil())
+}
+
+func TestLimitsFromAnnotations(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	limits, err := Limits{Rate: 10, MaxInFlight: 4}.WithAnnotations(map[string]string{
+		ANNOTATION_RATE_LIMIT:    "2.5",
+		ANNOTATION_MAX_IN_FLIGHT: "1",
+	})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(limits).Should(gomega.Equal(Limits{Rate: 2.5, MaxInFlight: 1}))
+	_, err = Limits{}.WithAnnotations(map[string]string{ANNOTATION_RATE_BURST: "-1"})
+	g.Expect(err).ShouldNot(gomega.BeNil())
+}
+
+func TestHttpHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	l := NewLimiter(Limits{Rate: 0.001, Burst: 1}, "model")
+	handler := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	codes := []int{}
+	for _, path := range []string{"/api/infer/model", "/api/infer/model", "/api/status"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		codes = append(codes, w.Code)
+	}
+	g.Expect(codes).Should(gomega.Equal([]int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK}))
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	received int
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	s.received++
+	return nil
+}
+
+func TestThrottledStreamStaysOpen(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	l := NewLimiter(Limits{Rate: 20, Burst: 1}, "model")
+	var stream *limitedStream
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		stream = ss.(*limitedStream)
+		return nil
+	}
+	info := &grpc.StreamServerInfo{FullMethod: METHOD_STREAM_INFER}
+	g.Expect(l.StreamServerInterceptor()(nil, &fakeServerStream{}, info, handler)).Should(gomega.BeNil())
+
+	// The first request used the only token, the following ones wait for theirs
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		g.Expect(stream.RecvMsg(nil)).Should(gomega.BeNil())
+	}
+	g.Expect(time.Since(start)).Should(gomega.BeNumerically(">=", 90*time.Millisecond))
+	g.Expect(stream.ServerStream.(*fakeServerStream).received).Should(gomega.Equal(3))
+}
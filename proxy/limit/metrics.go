@@ -0,0 +1,24 @@
+package limit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	limitedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "trtis_proxy_limited_requests_total",
+		Help: "Inference requests rejected by the proxy's limits",
+	}, []string{"model", "reason"})
+	delayedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "trtis_proxy_delayed_requests_total",
+		Help: "Inference requests on a stream held back until a rate token was free",
+	}, []string{"model"})
+	inFlightRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "trtis_proxy_in_flight_requests",
+		Help: "Inference requests being processed",
+	}, []string{"model"})
+)
+
+func init() {
+	prometheus.MustRegister(limitedRequests, delayedRequests, inFlightRequests)
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"context"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// Request messages which name a model
+type modelRequest interface {
+	GetModelName() string
+}
+
+func methodName(fullMethod string) string {
+	return fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+}
+
+func messageSize(m interface{}) int {
+	if msg, ok := m.(proto.Message); ok {
+		return proto.Size(msg)
+	}
+	return 0
+}
+
+func (r *Recorder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, t := withTiming(ctx)
+		record := &request{
+			protocol:     PROTOCOL_GRPC,
+			method:       methodName(info.FullMethod),
+			start:        time.Now(),
+			timing:       t,
+			requestBytes: messageSize(req),
+		}
+		// The handler may rewrite the model name so take it first
+		if modelReq, ok := req.(modelRequest); ok {
+			record.model = modelReq.GetModelName()
+		}
+		res, err := handler(ctx, req)
+		record.code = status.Code(err).String()
+		if err == nil {
+			record.responseBytes = messageSize(res)
+		}
+		requestSize.WithLabelValues(PROTOCOL_GRPC, r.modelLabel(record.model), record.method).Observe(float64(record.requestBytes))
+		if err == nil {
+			responseSize.WithLabelValues(PROTOCOL_GRPC, r.modelLabel(record.model), record.method).Observe(float64(record.responseBytes))
+		}
+		r.record(record)
+		return res, err
+	}
+}
+
+// Record streams as one request with the size of each message
+func (r *Recorder) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, t := withTiming(stream.Context())
+		recorded := &recordedStream{
+			ServerStream: stream,
+			ctx:          ctx,
+			recorder:     r,
+			request: &request{
+				protocol: PROTOCOL_GRPC,
+				method:   methodName(info.FullMethod),
+				start:    time.Now(),
+				timing:   t,
+			},
+		}
+		err := handler(srv, recorded)
+		recorded.request.code = status.Code(err).String()
+		r.record(recorded.request)
+		return err
+	}
+}
+
+type recordedStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	recorder *Recorder
+	request  *request
+}
+
+func (s *recordedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *recordedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if modelReq, ok := m.(modelRequest); ok && s.request.model == "" {
+		s.request.model = modelReq.GetModelName()
+	}
+	size := messageSize(m)
+	s.request.requestBytes += size
+	requestSize.WithLabelValues(PROTOCOL_GRPC, s.recorder.modelLabel(s.request.model), s.request.method).Observe(float64(size))
+	return nil
+}
+
+func (s *recordedStream) SendMsg(m interface{}) error {
+	size := messageSize(m)
+	s.request.responseBytes += size
+	responseSize.WithLabelValues(PROTOCOL_GRPC, s.recorder.modelLabel(s.request.model), s.request.method).Observe(float64(size))
+	return s.ServerStream.SendMsg(m)
+}
+
+// Time calls to TRTIS made while handling a request
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		addUpstream(ctx, time.Since(start))
+		return err
+	}
+}
+
+// Time streams to TRTIS from when they are opened until they end
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			addUpstream(ctx, time.Since(start))
+			return nil, err
+		}
+		return &timedClientStream{ClientStream: stream, ctx: ctx, start: start}, nil
+	}
+}
+
+type timedClientStream struct {
+	grpc.ClientStream
+	ctx   context.Context
+	start time.Time
+	done  bool
+}
+
+func (s *timedClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil && !s.done {
+		s.done = true
+		addUpstream(s.ctx, time.Since(s.start))
+	}
+	return err
+}
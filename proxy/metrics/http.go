@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Get the method and model of a TRTIS http api path, /api/<method>/...
+func parseApiPath(path string) (string, string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 2 || segments[0] != "api" {
+		return "other", ""
+	}
+	method := segments[1]
+	switch method {
+	case "infer", "status":
+		if len(segments) > 2 {
+			return method, segments[2]
+		}
+		return method, ""
+	case "modelcontrol":
+		if len(segments) > 3 {
+			return method, segments[3]
+		}
+		return method, ""
+	case "health", "sharedmemorycontrol":
+		return method, ""
+	}
+	return "other", ""
+}
+
+type countingReader struct {
+	io.ReadCloser
+	count int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.count += n
+	return n, err
+}
+
+type recordingWriter struct {
+	http.ResponseWriter
+	code  int
+	count int
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.count += n
+	return n, err
+}
+
+// Record metrics for requests to the http proxy
+func (r *Recorder) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, t := withTiming(req.Context())
+		method, model := parseApiPath(req.URL.Path)
+		record := &request{
+			protocol: PROTOCOL_HTTP,
+			method:   method,
+			model:    model,
+			start:    time.Now(),
+			timing:   t,
+		}
+		body := &countingReader{ReadCloser: req.Body}
+		if req.Body != nil {
+			req.Body = body
+		}
+		writer := &recordingWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(writer, req.WithContext(ctx))
+
+		record.code = strconv.Itoa(writer.code)
+		record.requestBytes = body.count
+		record.responseBytes = writer.count
+		label := r.modelLabel(model)
+		requestSize.WithLabelValues(PROTOCOL_HTTP, label, method).Observe(float64(body.count))
+		responseSize.WithLabelValues(PROTOCOL_HTTP, label, method).Observe(float64(writer.count))
+		r.record(record)
+	})
+}
+
+type timedTransport struct {
+	next http.RoundTripper
+}
+
+// Time the requests the reverse proxy sends to TRTIS
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return &timedTransport{next: next}
+}
+
+func (t *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	addUpstream(req.Context(), time.Since(start))
+	return res, err
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	PROTOCOL_GRPC = "grpc"
+	PROTOCOL_HTTP = "http"
+	// Label for requests for models the proxy does not serve, so clients can not create unbounded label values
+	OTHER_MODEL = "other"
+)
+
+var (
+	labels = []string{"protocol", "model", "method"}
+
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "trtis_proxy_requests_total",
+		Help: "Requests handled by the proxy",
+	}, append(labels, "code"))
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trtis_proxy_request_duration_seconds",
+		Help:    "Time to handle requests including the upstream TRTIS call",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, labels)
+	upstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trtis_proxy_upstream_duration_seconds",
+		Help:    "Time spent waiting for TRTIS",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, labels)
+	overheadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trtis_proxy_overhead_duration_seconds",
+		Help:    "Time added by the proxy, the request duration less the upstream time",
+		Buckets: prometheus.ExponentialBuckets(0.00005, 2, 16),
+	}, labels)
+	requestSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trtis_proxy_request_size_bytes",
+		Help:    "Size of request payloads",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 12),
+	}, labels)
+	responseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trtis_proxy_response_size_bytes",
+		Help:    "Size of response payloads",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 12),
+	}, labels)
+)
+
+func init() {
+	prometheus.MustRegister(requests, requestDuration, upstreamDuration, overheadDuration, requestSize, responseSize)
+}
+
+// Records metrics and a sampled access log for requests through the proxy
+type Recorder struct {
+	log        logr.Logger
+	modelLabel func(modelName string) string
+	sampleRate float64
+}
+
+// Create a recorder. modelLabel gives the label for a requested model name, and
+// sampleRate is the fraction of requests written to the access log.
+func NewRecorder(modelLabel func(modelName string) string, sampleRate float64, log logr.Logger) *Recorder {
+	return &Recorder{
+		log:        log.WithName("access"),
+		modelLabel: modelLabel,
+		sampleRate: sampleRate,
+	}
+}
+
+// Upstream time of a request, added to by the client side of the proxy
+type timing struct {
+	mu       sync.Mutex
+	upstream time.Duration
+}
+
+type timingKey struct{}
+
+func withTiming(ctx context.Context) (context.Context, *timing) {
+	t := &timing{}
+	return context.WithValue(ctx, timingKey{}, t), t
+}
+
+// Add time spent waiting for TRTIS to the request in the context
+func addUpstream(ctx context.Context, d time.Duration) {
+	if t, ok := ctx.Value(timingKey{}).(*timing); ok {
+		t.mu.Lock()
+		t.upstream += d
+		t.mu.Unlock()
+	}
+}
+
+func (t *timing) get() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.upstream
+}
+
+type request struct {
+	protocol      string
+	model         string
+	method        string
+	code          string
+	start         time.Time
+	timing        *timing
+	requestBytes  int
+	responseBytes int
+}
+
+func (r *Recorder) record(req *request) {
+	model := r.modelLabel(req.model)
+	duration := time.Since(req.start)
+	upstream := req.timing.get()
+	requests.WithLabelValues(req.protocol, model, req.method, req.code).Inc()
+	requestDuration.WithLabelValues(req.protocol, model, req.method).Observe(duration.Seconds())
+	if upstream > 0 {
+		upstreamDuration.WithLabelValues(req.protocol, model, req.method).Observe(upstream.Seconds())
+		overheadDuration.WithLabelValues(req.protocol, model, req.method).Observe((duration - upstream).Seconds())
+	}
+	if r.sampleRate > 0 && rand.Float64() < r.sampleRate {
+		r.log.Info("Request", "protocol", req.protocol, "method", req.method, "model", req.model, "code", req.code,
+			"duration", duration.String(), "upstream", upstream.String(),
+			"requestBytes", req.requestBytes, "responseBytes", req.responseBytes)
+	}
+}
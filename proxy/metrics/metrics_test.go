@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecorder() *Recorder {
+	return NewRecorder(func(name string) string {
+		if name == "mine" {
+			return name
+		}
+		return OTHER_MODEL
+	}, 1, logf.Log)
+}
+
+func TestGrpcMetrics(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	interceptor := testRecorder().UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/nvidia.inferenceserver.GRPCService/Infer"}
+
+	_, err := interceptor(context.Background(), &trtis.InferRequest{ModelName: "mine"}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		addUpstream(ctx, 5*time.Millisecond)
+		return &trtis.InferResponse{RawOutput: [][]byte{[]byte("output")}}, nil
+	})
+	g.Expect(err).Should(gomega.BeNil())
+	_, err = interceptor(context.Background(), &trtis.InferRequest{ModelName: "theirs"}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	})
+	g.Expect(err).ShouldNot(gomega.BeNil())
+
+	g.Expect(testutil.ToFloat64(requests.WithLabelValues(PROTOCOL_GRPC, "mine", "Infer", "OK"))).Should(gomega.Equal(1.0))
+	g.Expect(testutil.ToFloat64(requests.WithLabelValues(PROTOCOL_GRPC, OTHER_MODEL, "Infer", "PermissionDenied"))).Should(gomega.Equal(1.0))
+	upstream := &dto.Metric{}
+	g.Expect(upstreamDuration.WithLabelValues(PROTOCOL_GRPC, "mine", "Infer").(prometheus.Histogram).Write(upstream)).Should(gomega.BeNil())
+	g.Expect(upstream.GetHistogram().GetSampleCount()).Should(gomega.Equal(uint64(1)))
+	g.Expect(upstream.GetHistogram().GetSampleSum()).Should(gomega.BeNumerically("~", 0.005, 0.0001))
+}
+
+func TestHttpMetrics(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	trtisServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("result"))
+	}))
+	defer trtisServer.Close()
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	handler := testRecorder().Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream, err := http.NewRequest("POST", trtisServer.URL, r.Body)
+		g.Expect(err).Should(gomega.BeNil())
+		res, err := client.Do(upstream.WithContext(r.Context()))
+		g.Expect(err).Should(gomega.BeNil())
+		defer res.Body.Close()
+		w.WriteHeader(res.StatusCode)
+		w.Write([]byte("result"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/api/infer/mine/1", strings.NewReader("input")))
+	g.Expect(w.Code).Should(gomega.Equal(http.StatusOK))
+	g.Expect(testutil.ToFloat64(requests.WithLabelValues(PROTOCOL_HTTP, "mine", "infer", "200"))).Should(gomega.Equal(1.0))
+
+	method, model := parseApiPath("/api/modelcontrol/load/mine")
+	g.Expect(method).Should(gomega.Equal("modelcontrol"))
+	g.Expect(model).Should(gomega.Equal("mine"))
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"strings"
+	"sync"
+)
+
+// Models a tenant may send requests for through the proxy
+type AllowList struct {
+	mu     sync.RWMutex
+	models map[string]bool
+	all    bool
+}
+
+// Create an allow list which allows every model
+func NewAllowAll() *AllowList {
+	return &AllowList{all: true}
+}
+
+// Create an allow list from model names. An empty list allows no models.
+func NewAllowList(models []string) *AllowList {
+	return &AllowList{models: toSet(models)}
+}
+
+func toSet(models []string) map[string]bool {
+	allowed := map[string]bool{}
+	for _, model := range models {
+		if model = strings.TrimSpace(model); model != "" {
+			allowed[model] = true
+		}
+	}
+	return allowed
+}
+
+// Replace the allowed models, e.g. as models come and go from a node
+func (a *AllowList) Set(models []string) {
+	allowed := toSet(models)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.models = allowed
+}
+
+func (a *AllowList) Allowed(modelName string) bool {
+	if a.all {
+		return true
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.models[modelName]
+}
+
+// Remove the status of models which are not allowed from a server status
+func (a *AllowList) FilterStatus(status *trtis.ServerStatus) {
+	for modelName := range status.GetModelStatus() {
+		if !a.Allowed(modelName) {
+			delete(status.ModelStatus, modelName)
+		}
+	}
+}
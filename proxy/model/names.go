@@ -0,0 +1,49 @@
+package model
+
+import (
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+)
+
+// Maps the model name clients use to the unique name of the model on the TRTIS server
+type NameMapper struct {
+	clientName string
+	serverName string
+}
+
+// Create a name mapper. An empty client name leaves model names unchanged.
+func NewNameMapper(clientName, serverName string) *NameMapper {
+	if clientName == "" {
+		clientName = serverName
+	}
+	return &NameMapper{
+		clientName: clientName,
+		serverName: serverName,
+	}
+}
+
+func (n *NameMapper) ToServer(modelName string) string {
+	if modelName == n.clientName {
+		return n.serverName
+	}
+	return modelName
+}
+
+func (n *NameMapper) ToClient(modelName string) string {
+	if modelName == n.serverName {
+		return n.clientName
+	}
+	return modelName
+}
+
+// Rename the server model in a server status to the client model name
+func (n *NameMapper) StatusToClient(status *trtis.ServerStatus) {
+	modelStatus, ok := status.GetModelStatus()[n.serverName]
+	if !ok || n.clientName == n.serverName {
+		return
+	}
+	delete(status.ModelStatus, n.serverName)
+	if modelStatus.GetConfig() != nil {
+		modelStatus.Config.Name = n.clientName
+	}
+	status.ModelStatus[n.clientName] = modelStatus
+}
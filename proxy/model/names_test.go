@@ -0,0 +1,28 @@
+package model
+
+import (
+	"github.com/onsi/gomega"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"testing"
+)
+
+func TestNameMapper(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	names := NewNameMapper("resnet", "ns1-deploy-resnet")
+	g.Expect(names.ToServer("resnet")).Should(gomega.Equal("ns1-deploy-resnet"))
+	g.Expect(names.ToServer("other")).Should(gomega.Equal("other"))
+	g.Expect(names.ToClient("ns1-deploy-resnet")).Should(gomega.Equal("resnet"))
+
+	status := &trtis.ServerStatus{
+		ModelStatus: map[string]*trtis.ModelStatus{
+			"ns1-deploy-resnet": {Config: &trtis.ModelConfig{Name: "ns1-deploy-resnet"}},
+		},
+	}
+	names.StatusToClient(status)
+	g.Expect(status.ModelStatus).Should(gomega.HaveLen(1))
+	g.Expect(status.ModelStatus["resnet"].Config.Name).Should(gomega.Equal("resnet"))
+
+	identity := NewNameMapper("", "resnet")
+	g.Expect(identity.ToServer("resnet")).Should(gomega.Equal("resnet"))
+	g.Expect(identity.ToClient("resnet")).Should(gomega.Equal("resnet"))
+}
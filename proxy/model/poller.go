@@ -0,0 +1,71 @@
+package model
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"google.golang.org/grpc"
+	"time"
+)
+
+// Client for the TRTIS status API
+type StatusClient interface {
+	Status(ctx context.Context, in *trtis.StatusRequest, opts ...grpc.CallOption) (*trtis.StatusResponse, error)
+}
+
+// Handler called with each server status polled for the model or the error if the poll failed
+type StatusHandler interface {
+	HandleStatus(status *trtis.ServerStatus, err error)
+}
+
+// Polls the TRTIS server status for a model and passes it to the registered handlers
+type StatusPoller struct {
+	log       logr.Logger
+	client    StatusClient
+	modelName string
+	interval  time.Duration
+	handlers  []StatusHandler
+}
+
+func NewStatusPoller(client StatusClient, modelName string, interval time.Duration, log logr.Logger) *StatusPoller {
+	return &StatusPoller{
+		log:       log.WithName("StatusPoller"),
+		client:    client,
+		modelName: modelName,
+		interval:  interval,
+	}
+}
+
+func (p *StatusPoller) AddHandler(handler StatusHandler) {
+	p.handlers = append(p.handlers, handler)
+}
+
+func (p *StatusPoller) Poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+	response, err := p.client.Status(ctx, &trtis.StatusRequest{ModelName: p.modelName})
+	var status *trtis.ServerStatus
+	if err != nil {
+		p.log.Error(err, "Failed to get server status", "model", p.modelName)
+	} else {
+		status = response.GetServerStatus()
+	}
+	for _, handler := range p.handlers {
+		handler.HandleStatus(status, err)
+	}
+}
+
+// Poll until stop is closed
+func (p *StatusPoller) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	p.Poll()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.Poll()
+		}
+	}
+}
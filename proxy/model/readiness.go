@@ -0,0 +1,98 @@
+package model
+
+import (
+	"github.com/go-logr/logr"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"sync"
+)
+
+// Tracks whether TRTIS has a version of the model ready to serve requests.
+// The model is not ready until the first status poll and whenever a poll fails.
+type Readiness struct {
+	log       logr.Logger
+	modelName string
+	mu        sync.RWMutex
+	ready     bool
+	draining  bool
+	reason    string
+	listeners []func(ready bool)
+}
+
+func NewReadiness(modelName string, log logr.Logger) *Readiness {
+	return &Readiness{
+		log:       log.WithName("Readiness"),
+		modelName: modelName,
+		reason:    "model status not polled yet",
+	}
+}
+
+// Call listener with the readiness each time it changes
+func (r *Readiness) AddListener(listener func(ready bool)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, listener)
+	listener(r.ready)
+}
+
+func (r *Readiness) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ready
+}
+
+// Why the model is not ready
+func (r *Readiness) Reason() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.reason
+}
+
+// Report the model as not ready from now on so traffic drains away before the proxy stops
+func (r *Readiness) SetDraining() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draining = true
+	r.reason = "proxy is shutting down"
+	if r.ready {
+		r.ready = false
+		for _, listener := range r.listeners {
+			listener(false)
+		}
+	}
+}
+
+func (r *Readiness) HandleStatus(status *trtis.ServerStatus, err error) {
+	ready := false
+	reason := ""
+	if err != nil {
+		reason = "failed to get model status: " + err.Error()
+	} else {
+		reason = "no version of the model is ready"
+		for _, versionStatus := range status.GetModelStatus()[r.modelName].GetVersionStatus() {
+			if versionStatus.ReadyState == trtis.ModelReadyState_MODEL_READY {
+				ready = true
+				reason = ""
+				break
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.draining {
+		return
+	}
+	r.reason = reason
+	if ready == r.ready {
+		return
+	}
+	r.ready = ready
+	if ready {
+		r.log.Info("Model ready", "model", r.modelName)
+	} else {
+		r.log.Info("Model not ready", "model", r.modelName, "reason", reason)
+	}
+	for _, listener := range r.listeners {
+		listener(ready)
+	}
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"errors"
+	"github.com/onsi/gomega"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"testing"
+)
+
+func TestReadinessFollowsModelStatus(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	r := NewReadiness("model", logf.Log)
+	var changes []bool
+	r.AddListener(func(ready bool) {
+		changes = append(changes, ready)
+	})
+	g.Expect(r.Ready()).Should(gomega.BeFalse())
+
+	r.HandleStatus(serverStatus("model", map[int64]trtis.ModelReadyState{
+		1: trtis.ModelReadyState_MODEL_LOADING,
+	}), nil)
+	g.Expect(r.Ready()).Should(gomega.BeFalse())
+
+	r.HandleStatus(serverStatus("model", map[int64]trtis.ModelReadyState{
+		1: trtis.ModelReadyState_MODEL_READY,
+	}), nil)
+	g.Expect(r.Ready()).Should(gomega.BeTrue())
+
+	// TRTIS restarted and lost the model
+	r.HandleStatus(&trtis.ServerStatus{}, nil)
+	g.Expect(r.Ready()).Should(gomega.BeFalse())
+
+	r.HandleStatus(nil, errors.New("connection refused"))
+	g.Expect(r.Ready()).Should(gomega.BeFalse())
+	g.Expect(r.Reason()).Should(gomega.ContainSubstring("connection refused"))
+	g.Expect(changes).Should(gomega.Equal([]bool{false, true, false}))
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Maps the shared memory regions a tenant registers to region names on the TRTIS server.
+// Regions are registered server wide so the names are prefixed, e.g. with the pod, to keep
+// tenants apart, and a tenant may only use the regions it registered through the proxy.
+type RegionNames struct {
+	prefix     string
+	mu         sync.Mutex
+	registered map[string]bool
+}
+
+func NewRegionNames(prefix string) *RegionNames {
+	return &RegionNames{
+		prefix:     prefix,
+		registered: map[string]bool{},
+	}
+}
+
+func (r *RegionNames) ToServer(name string) string {
+	return r.prefix + name
+}
+
+// Check the region was registered through the proxy
+func (r *RegionNames) Registered(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registered[name]
+}
+
+func (r *RegionNames) Add(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registered[name] = true
+}
+
+func (r *RegionNames) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.registered, name)
+}
+
+// The regions registered through the proxy
+func (r *RegionNames) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.registered))
+	for name := range r.registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Keep only the regions of a server wide status which carry the prefix, with their client names.
+// The regions found are recorded as registered, so regions registered before the proxy restarted
+// can still be used.
+func (r *RegionNames) StatusToClient(regions []*trtis.SharedMemoryRegion) []*trtis.SharedMemoryRegion {
+	var own []*trtis.SharedMemoryRegion
+	for _, region := range regions {
+		if !strings.HasPrefix(region.Name, r.prefix) {
+			continue
+		}
+		region.Name = strings.TrimPrefix(region.Name, r.prefix)
+		r.Add(region.Name)
+		own = append(own, region)
+	}
+	return own
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"google.golang.org/grpc"
+	"k8s.io/api/core/v1"
+	"time"
+)
+
+// Client for the TRTIS model control API
+type ModelControlClient interface {
+	ModelControl(ctx context.Context, in *trtis.ModelControlRequest, opts ...grpc.CallOption) (*trtis.ModelControlResponse, error)
+}
+
+// The installed model folder
+type ModelFiles interface {
+	Installed() bool
+	Refresh() error
+	Restore() error
+}
+
+// Records events about the model on the pod
+type EventRecorder func(eventType, reason, message string)
+
+// Watches the TRTIS server identity and uptime and, when TRTIS restarts, makes sure the
+// model comes back: reinstalling its files if they have gone and asking TRTIS to load it.
+type RestartRecovery struct {
+	log         logr.Logger
+	client      ModelControlClient
+	modelName   string
+	files       ModelFiles
+	record      EventRecorder
+	loadTimeout time.Duration
+	serverId    string
+	uptimeNs    uint64
+	recovering  bool
+	loadIssued  bool
+}
+
+func NewRestartRecovery(client ModelControlClient, modelName string, files ModelFiles, record EventRecorder, loadTimeout time.Duration, log logr.Logger) *RestartRecovery {
+	return &RestartRecovery{
+		log:         log.WithName("RestartRecovery"),
+		client:      client,
+		modelName:   modelName,
+		files:       files,
+		record:      record,
+		loadTimeout: loadTimeout,
+	}
+}
+
+// Whether the status comes from a different TRTIS server process than the last one seen
+func (r *RestartRecovery) restarted(status *trtis.ServerStatus) bool {
+	if r.serverId == "" {
+		return false
+	}
+	return status.GetId() != r.serverId || status.GetUptimeNs() < r.uptimeNs
+}
+
+func modelState(status *trtis.ServerStatus, modelName string) (ready bool, loading bool) {
+	for _, versionStatus := range status.GetModelStatus()[modelName].GetVersionStatus() {
+		switch versionStatus.ReadyState {
+		case trtis.ModelReadyState_MODEL_READY:
+			ready = true
+		case trtis.ModelReadyState_MODEL_LOADING:
+			loading = true
+		}
+	}
+	return ready, loading
+}
+
+func (r *RestartRecovery) HandleStatus(status *trtis.ServerStatus, err error) {
+	if err != nil || status == nil {
+		return
+	}
+	if r.restarted(status) {
+		r.log.Info("TRTIS restarted", "serverId", status.GetId(), "uptimeNs", status.GetUptimeNs())
+		r.record(v1.EventTypeWarning, "TrtisRestarted", fmt.Sprintf("TRTIS server %s restarted, checking model %s is loaded", status.GetId(), r.modelName))
+		r.recovering = true
+		r.loadIssued = false
+	}
+	r.serverId = status.GetId()
+	r.uptimeNs = status.GetUptimeNs()
+	ready, loading := modelState(status, r.modelName)
+	if !r.recovering {
+		if ready {
+			if err := r.files.Refresh(); err != nil {
+				r.log.Error(err, "Failed to record model files", "model", r.modelName)
+			}
+		}
+		return
+	}
+	if ready {
+		r.log.Info("Model recovered after TRTIS restart", "model", r.modelName)
+		r.record(v1.EventTypeNormal, "ModelRecovered", fmt.Sprintf("Model %s is ready after TRTIS restarted", r.modelName))
+		r.recovering = false
+		return
+	}
+	if loading {
+		return
+	}
+
+	if !r.files.Installed() {
+		r.log.Info("Model files missing after TRTIS restart, restoring them", "model", r.modelName)
+		if err := r.files.Restore(); err != nil {
+			r.log.Error(err, "Failed to restore model files", "model", r.modelName)
+			r.record(v1.EventTypeWarning, "ModelRestoreFailed", fmt.Sprintf("Failed to restore files of model %s: %s", r.modelName, err))
+			return
+		}
+		r.record(v1.EventTypeNormal, "ModelRestored", fmt.Sprintf("Restored files of model %s", r.modelName))
+		r.loadIssued = false
+	}
+
+	// TRTIS polling the repository loads restored files itself, otherwise it has to be asked
+	if r.loadIssued {
+		return
+	}
+	r.loadIssued = true
+	ctx, cancel := context.WithTimeout(context.Background(), r.loadTimeout)
+	defer cancel()
+	r.log.Info("Loading model", "model", r.modelName)
+	response, err := r.client.ModelControl(ctx, &trtis.ModelControlRequest{
+		ModelName: r.modelName,
+		Type:      trtis.ModelControlRequest_LOAD,
+	})
+	if err == nil && response.GetRequestStatus().GetCode() != trtis.RequestStatusCode_SUCCESS {
+		err = fmt.Errorf("%s: %s", response.GetRequestStatus().GetCode(), response.GetRequestStatus().GetMsg())
+	}
+	if err != nil {
+		r.log.Error(err, "Failed to load model", "model", r.modelName)
+		r.record(v1.EventTypeWarning, "ModelLoadFailed", fmt.Sprintf("Failed to load model %s after TRTIS restarted: %s", r.modelName, err))
+		r.loadIssued = false
+	}
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"context"
+	"github.com/onsi/gomega"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"google.golang.org/grpc"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"testing"
+	"time"
+)
+
+type fakeModelControl struct {
+	loads []string
+}
+
+func (f *fakeModelControl) ModelControl(ctx context.Context, in *trtis.ModelControlRequest, opts ...grpc.CallOption) (*trtis.ModelControlResponse, error) {
+	f.loads = append(f.loads, in.ModelName)
+	return &trtis.ModelControlResponse{RequestStatus: &trtis.RequestStatus{Code: trtis.RequestStatusCode_SUCCESS}}, nil
+}
+
+type fakeModelFiles struct {
+	installed bool
+	restores  int
+}
+
+func (f *fakeModelFiles) Installed() bool { return f.installed }
+func (f *fakeModelFiles) Refresh() error  { return nil }
+func (f *fakeModelFiles) Restore() error {
+	f.restores++
+	f.installed = true
+	return nil
+}
+
+func TestRestartRecoveryRestoresAndLoads(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	client := &fakeModelControl{}
+	files := &fakeModelFiles{installed: true}
+	var reasons []string
+	r := NewRestartRecovery(client, "model", files, func(eventType, reason, message string) {
+		reasons = append(reasons, reason)
+	}, time.Second, logf.Log)
+
+	status := serverStatus("model", map[int64]trtis.ModelReadyState{1: trtis.ModelReadyState_MODEL_READY})
+	status.Id = "inference:0"
+	status.UptimeNs = uint64(time.Hour)
+	r.HandleStatus(status, nil)
+	status.UptimeNs += uint64(time.Minute)
+	r.HandleStatus(status, nil)
+	g.Expect(reasons).Should(gomega.BeEmpty())
+
+	// TRTIS restarted and its repository lost the model
+	files.installed = false
+	restarted := &trtis.ServerStatus{Id: "inference:0", UptimeNs: uint64(time.Second)}
+	r.HandleStatus(restarted, nil)
+	g.Expect(files.restores).Should(gomega.Equal(1))
+	g.Expect(client.loads).Should(gomega.Equal([]string{"model"}))
+
+	// Load is only asked for once while waiting for the model
+	restarted.UptimeNs += uint64(time.Second)
+	r.HandleStatus(restarted, nil)
+	g.Expect(client.loads).Should(gomega.HaveLen(1))
+
+	ready := serverStatus("model", map[int64]trtis.ModelReadyState{1: trtis.ModelReadyState_MODEL_READY})
+	ready.Id = "inference:0"
+	ready.UptimeNs = restarted.UptimeNs + uint64(time.Second)
+	r.HandleStatus(ready, nil)
+	g.Expect(reasons).Should(gomega.Equal([]string{"TrtisRestarted", "ModelRestored", "ModelRecovered"}))
+}
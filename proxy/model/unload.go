@@ -0,0 +1,64 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"time"
+)
+
+// Client for the TRTIS status and model control APIs
+type UnloadClient interface {
+	StatusClient
+	ModelControlClient
+}
+
+// Ask TRTIS to unload a model
+func RequestUnload(ctx context.Context, client ModelControlClient, modelName string) error {
+	response, err := client.ModelControl(ctx, &trtis.ModelControlRequest{
+		ModelName: modelName,
+		Type:      trtis.ModelControlRequest_UNLOAD,
+	})
+	if err != nil {
+		return err
+	}
+	if code := response.GetRequestStatus().GetCode(); code != trtis.RequestStatusCode_SUCCESS {
+		return fmt.Errorf("%s: %s", code, response.GetRequestStatus().GetMsg())
+	}
+	return nil
+}
+
+// Check TRTIS has no version of the model loaded or loading
+func unloaded(ctx context.Context, client StatusClient, modelName string) (bool, error) {
+	response, err := client.Status(ctx, &trtis.StatusRequest{ModelName: modelName})
+	if err != nil {
+		return false, err
+	}
+	for _, versionStatus := range response.GetServerStatus().GetModelStatus()[modelName].GetVersionStatus() {
+		switch versionStatus.ReadyState {
+		case trtis.ModelReadyState_MODEL_READY, trtis.ModelReadyState_MODEL_LOADING, trtis.ModelReadyState_MODEL_UNLOADING:
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Poll TRTIS until it confirms the model is unloaded or ctx is done
+func WaitForUnload(ctx context.Context, client StatusClient, modelName string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ok, err := unloaded(ctx, client, modelName)
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("model %s still loaded: %v", modelName, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"github.com/go-logr/logr"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const NO_VERSION = int64(-1)
+
+// Routes traffic to the newest ready version of a model and retires older versions.
+// When a newer version becomes ready requests are switched to it and, once
+// the retire delay has passed, the folders of older versions are removed so TRTIS unloads them.
+type VersionManager struct {
+	log         logr.Logger
+	modelDir    string
+	modelName   string
+	retireDelay time.Duration
+	mu          sync.RWMutex
+	active      int64
+	switchedAt  time.Time
+}
+
+func NewVersionManager(modelRepo, modelName string, retireDelay time.Duration, log logr.Logger) *VersionManager {
+	return &VersionManager{
+		log:         log.WithName("VersionManager"),
+		modelDir:    filepath.Join(modelRepo, modelName),
+		modelName:   modelName,
+		retireDelay: retireDelay,
+		active:      NO_VERSION,
+	}
+}
+
+// The version requests should be sent to or NO_VERSION if no version is ready yet
+func (v *VersionManager) ActiveVersion() int64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.active
+}
+
+func (v *VersionManager) HandleStatus(status *trtis.ServerStatus, err error) {
+	if err != nil {
+		return
+	}
+	newest := NO_VERSION
+	for version, versionStatus := range status.GetModelStatus()[v.modelName].GetVersionStatus() {
+		if versionStatus.ReadyState == trtis.ModelReadyState_MODEL_READY && version > newest {
+			newest = version
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if newest > v.active {
+		v.log.Info("Switching traffic to model version", "model", v.modelName, "from", v.active, "to", newest)
+		v.active = newest
+		v.switchedAt = time.Now()
+	}
+	if v.active != NO_VERSION && v.retireDelay >= 0 && time.Since(v.switchedAt) >= v.retireDelay {
+		v.retireOlderVersions(v.active)
+	}
+}
+
+// Remove version folders older than the active version. Must be called with the lock held.
+func (v *VersionManager) retireOlderVersions(active int64) {
+	entries, err := ioutil.ReadDir(v.modelDir)
+	if err != nil {
+		v.log.Error(err, "Failed to list model versions", "dir", v.modelDir)
+		return
+	}
+	for _, entry := range entries {
+		version, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil || !entry.IsDir() || version >= active {
+			continue
+		}
+		v.log.Info("Retiring model version", "model", v.modelName, "version", version)
+		if err := os.RemoveAll(filepath.Join(v.modelDir, entry.Name())); err != nil {
+			v.log.Error(err, "Failed to remove model version", "version", version)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"github.com/onsi/gomega"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"testing"
+)
+
+func serverStatus(modelName string, states map[int64]trtis.ModelReadyState) *trtis.ServerStatus {
+	versions := map[int64]*trtis.ModelVersionStatus{}
+	for version, state := range states {
+		versions[version] = &trtis.ModelVersionStatus{ReadyState: state}
+	}
+	return &trtis.ServerStatus{
+		ModelStatus: map[string]*trtis.ModelStatus{
+			modelName: {VersionStatus: versions},
+		},
+	}
+}
+
+func TestVersionManagerSwitchesAndRetires(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	repo, err := ioutil.TempDir("", "repo")
+	g.Expect(err).Should(gomega.BeNil())
+	defer os.RemoveAll(repo)
+	for _, dir := range []string{"1", "2"} {
+		g.Expect(os.MkdirAll(filepath.Join(repo, "model", dir), 0755)).Should(gomega.BeNil())
+	}
+
+	v := NewVersionManager(repo, "model", 0, logf.Log)
+	g.Expect(v.ActiveVersion()).Should(gomega.Equal(NO_VERSION))
+
+	v.HandleStatus(serverStatus("model", map[int64]trtis.ModelReadyState{
+		1: trtis.ModelReadyState_MODEL_READY,
+		2: trtis.ModelReadyState_MODEL_LOADING,
+	}), nil)
+	g.Expect(v.ActiveVersion()).Should(gomega.Equal(int64(1)))
+	g.Expect(filepath.Join(repo, "model", "1")).Should(gomega.BeADirectory())
+
+	v.HandleStatus(serverStatus("model", map[int64]trtis.ModelReadyState{
+		1: trtis.ModelReadyState_MODEL_READY,
+		2: trtis.ModelReadyState_MODEL_READY,
+	}), nil)
+	g.Expect(v.ActiveVersion()).Should(gomega.Equal(int64(2)))
+	g.Expect(filepath.Join(repo, "model", "1")).ShouldNot(gomega.BeADirectory())
+	g.Expect(filepath.Join(repo, "model", "2")).Should(gomega.BeADirectory())
+}
+
+func TestVersionManagerKeepsVersionsWhenRetireDisabled(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	repo, err := ioutil.TempDir("", "repo")
+	g.Expect(err).Should(gomega.BeNil())
+	defer os.RemoveAll(repo)
+	for _, dir := range []string{"1", "2"} {
+		g.Expect(os.MkdirAll(filepath.Join(repo, "model", dir), 0755)).Should(gomega.BeNil())
+	}
+
+	v := NewVersionManager(repo, "model", -1, logf.Log)
+	v.HandleStatus(serverStatus("model", map[int64]trtis.ModelReadyState{
+		1: trtis.ModelReadyState_MODEL_READY,
+		2: trtis.ModelReadyState_MODEL_READY,
+	}), nil)
+	g.Expect(v.ActiveVersion()).Should(gomega.Equal(int64(2)))
+	g.Expect(filepath.Join(repo, "model", "1")).Should(gomega.BeADirectory())
+}
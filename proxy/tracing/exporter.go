@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	zipkinexporter "contrib.go.opencensus.io/exporter/zipkin"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	"go.opencensus.io/trace"
+)
+
+const (
+	EXPORTER_NONE   = "none"
+	EXPORTER_LOG    = "log"
+	EXPORTER_ZIPKIN = "zipkin"
+
+	SERVICE_NAME = "trtis-proxy"
+)
+
+// Register one of the supported OpenCensus exporters by name. The returned function flushes
+// and stops the exporter.
+func RegisterExporter(name string, zipkinUrl string, log logr.Logger) (func(), error) {
+	switch name {
+	case EXPORTER_NONE, "":
+		return func() {}, nil
+	case EXPORTER_LOG:
+		exporter := &LogExporter{log: log.WithName("Span")}
+		trace.RegisterExporter(exporter)
+		return func() { trace.UnregisterExporter(exporter) }, nil
+	case EXPORTER_ZIPKIN:
+		endpoint, err := zipkin.NewEndpoint(SERVICE_NAME, "")
+		if err != nil {
+			return nil, err
+		}
+		reporter := zipkinhttp.NewReporter(zipkinUrl)
+		exporter := zipkinexporter.NewExporter(reporter, endpoint)
+		trace.RegisterExporter(exporter)
+		return func() {
+			trace.UnregisterExporter(exporter)
+			if err := reporter.Close(); err != nil {
+				log.Error(err, "Failed to send spans to zipkin", "url", zipkinUrl)
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown trace exporter %s", name)
+}
+
+// Writes spans to the log
+type LogExporter struct {
+	log logr.Logger
+}
+
+func (e *LogExporter) ExportSpan(span *trace.SpanData) {
+	keysAndValues := []interface{}{
+		"name", span.Name,
+		"traceId", span.TraceID.String(),
+		"spanId", span.SpanID.String(),
+		"durationMs", float64(span.EndTime.Sub(span.StartTime).Microseconds()) / 1000,
+	}
+	if span.ParentSpanID != (trace.SpanID{}) {
+		keysAndValues = append(keysAndValues, "parentSpanId", span.ParentSpanID.String())
+	}
+	if span.Code != trace.StatusCodeOK {
+		keysAndValues = append(keysAndValues, "code", span.Code, "error", span.Message)
+	}
+	for k, v := range span.Attributes {
+		keysAndValues = append(keysAndValues, k, v)
+	}
+	e.log.Info("Span", keysAndValues...)
+}
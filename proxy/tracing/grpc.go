@@ -0,0 +1,198 @@
+package tracing
+
+import (
+	"context"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"strings"
+)
+
+// Request messages which name a model
+type modelRequest interface {
+	GetModelName() string
+}
+
+// Response messages which carry the TRTIS request status
+type statusResponse interface {
+	GetRequestStatus() *trtis.RequestStatus
+}
+
+func methodName(fullMethod string) string {
+	return fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+}
+
+func tagRequest(span *trace.Span, req interface{}) {
+	if modelReq, ok := req.(modelRequest); ok && modelReq.GetModelName() != "" {
+		span.AddAttributes(trace.StringAttribute(ATTRIBUTE_MODEL_NAME, modelReq.GetModelName()))
+	}
+	if inferReq, ok := req.(*trtis.InferRequest); ok {
+		span.AddAttributes(
+			trace.Int64Attribute(ATTRIBUTE_MODEL_VERSION, inferReq.GetModelVersion()),
+			trace.Int64Attribute(ATTRIBUTE_BATCH_SIZE, int64(inferReq.GetMetaData().GetBatchSize())),
+		)
+	}
+}
+
+// Tag the TRTIS request status of a response, returning false if the request failed
+func tagResponse(span *trace.Span, res interface{}) bool {
+	statusRes, ok := res.(statusResponse)
+	if !ok || statusRes.GetRequestStatus() == nil {
+		return true
+	}
+	code := statusRes.GetRequestStatus().GetCode()
+	span.AddAttributes(trace.StringAttribute(ATTRIBUTE_REQUEST_STATUS_CODE, code.String()))
+	return code == trtis.RequestStatusCode_SUCCESS
+}
+
+func tagError(span *trace.Span, err error) {
+	if err != nil {
+		s := status.Convert(err)
+		span.SetStatus(trace.Status{Code: int32(s.Code()), Message: s.Message()})
+	}
+}
+
+func (t *Tracer) startServerSpan(ctx context.Context, fullMethod string) (context.Context, *trace.Span) {
+	name := "proxy " + methodName(fullMethod)
+	var span *trace.Span
+	md, _ := metadata.FromIncomingContext(ctx)
+	if sc, ok := extractMetadata(md); ok {
+		ctx, span = trace.StartSpanWithRemoteParent(ctx, name, sc, trace.WithSpanKind(trace.SpanKindServer), trace.WithSampler(t.sampler))
+	} else {
+		ctx, span = trace.StartSpan(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithSampler(t.sampler))
+	}
+	span.AddAttributes(trace.StringAttribute(ATTRIBUTE_RPC_METHOD, fullMethod))
+	return ctx, span
+}
+
+// Continue traces from the incoming metadata and record a span for handling each request
+func (t *Tracer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := t.startServerSpan(ctx, info.FullMethod)
+		defer span.End()
+		// The handler may rewrite the model name so tag it first
+		tagRequest(span, req)
+		res, err := handler(ctx, req)
+		tagError(span, err)
+		if err == nil {
+			tagResponse(span, res)
+		}
+		return res, err
+	}
+}
+
+func (t *Tracer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := t.startServerSpan(stream.Context(), info.FullMethod)
+		defer span.End()
+		err := handler(srv, &tracedServerStream{ServerStream: stream, ctx: ctx, span: span})
+		tagError(span, err)
+		return err
+	}
+}
+
+// Streams are tagged with their first request and first failed response
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	span   *trace.Span
+	tagged bool
+	failed bool
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *tracedServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if !s.tagged {
+		s.tagged = true
+		tagRequest(s.span, m)
+	}
+	return nil
+}
+
+func (s *tracedServerStream) SendMsg(m interface{}) error {
+	if !s.failed {
+		s.failed = !tagResponse(s.span, m)
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (t *Tracer) startClientSpan(ctx context.Context, method string) (context.Context, *trace.Span) {
+	ctx, span := trace.StartSpan(ctx, "trtis "+methodName(method), trace.WithSpanKind(trace.SpanKindClient), trace.WithSampler(t.sampler))
+	span.AddAttributes(trace.StringAttribute(ATTRIBUTE_RPC_METHOD, method))
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	injectMetadata(span.SpanContext(), md)
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// Record a span for each call to TRTIS and pass the trace context on in its metadata
+func (t *Tracer) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := t.startClientSpan(ctx, method)
+		defer span.End()
+		tagRequest(span, req)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		tagError(span, err)
+		if err == nil {
+			tagResponse(span, reply)
+		}
+		return err
+	}
+}
+
+// Record a span for each stream to TRTIS from when it is opened until it ends
+func (t *Tracer) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := t.startClientSpan(ctx, method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			tagError(span, err)
+			span.End()
+			return nil, err
+		}
+		return &tracedClientStream{ClientStream: stream, span: span}, nil
+	}
+}
+
+type tracedClientStream struct {
+	grpc.ClientStream
+	span   *trace.Span
+	tagged bool
+	failed bool
+}
+
+func (s *tracedClientStream) SendMsg(m interface{}) error {
+	if !s.tagged {
+		s.tagged = true
+		tagRequest(s.span, m)
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *tracedClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		if !s.failed {
+			s.failed = !tagResponse(s.span, m)
+		}
+		return nil
+	}
+	if err != io.EOF {
+		tagError(s.span, err)
+	}
+	s.span.End()
+	return err
+}
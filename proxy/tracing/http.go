@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"github.com/golang/protobuf/proto"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/trace"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	HEADER_INFER_REQUEST = "NV-InferRequest"
+	HEADER_STATUS        = "NV-Status"
+)
+
+// Get the method, model and version of a TRTIS http api path, /api/<method>/...
+func parseApiPath(path string) (string, string, string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 2 || segments[0] != "api" {
+		return "other", "", ""
+	}
+	method := segments[1]
+	switch method {
+	case "infer", "status":
+		if len(segments) > 3 {
+			return method, segments[2], segments[3]
+		} else if len(segments) > 2 {
+			return method, segments[2], ""
+		}
+	case "modelcontrol":
+		if len(segments) > 3 {
+			return method, segments[3], ""
+		}
+	}
+	return method, "", ""
+}
+
+func tagHttpRequest(span *trace.Span, req *http.Request) {
+	_, model, version := parseApiPath(req.URL.Path)
+	if model != "" {
+		span.AddAttributes(trace.StringAttribute(ATTRIBUTE_MODEL_NAME, model))
+	}
+	if v, err := strconv.ParseInt(version, 10, 64); err == nil {
+		span.AddAttributes(trace.Int64Attribute(ATTRIBUTE_MODEL_VERSION, v))
+	}
+	if header := req.Header.Get(HEADER_INFER_REQUEST); header != "" {
+		inferHeader := &trtis.InferRequestHeader{}
+		if err := proto.UnmarshalText(header, inferHeader); err == nil {
+			span.AddAttributes(trace.Int64Attribute(ATTRIBUTE_BATCH_SIZE, int64(inferHeader.GetBatchSize())))
+		}
+	}
+}
+
+func tagHttpResponse(span *trace.Span, header http.Header) {
+	if statusHeader := header.Get(HEADER_STATUS); statusHeader != "" {
+		requestStatus := &trtis.RequestStatus{}
+		if err := proto.UnmarshalText(statusHeader, requestStatus); err == nil {
+			span.AddAttributes(trace.StringAttribute(ATTRIBUTE_REQUEST_STATUS_CODE, requestStatus.GetCode().String()))
+		}
+	}
+}
+
+func spanName(prefix string) func(*http.Request) string {
+	return func(req *http.Request) string {
+		method, _, _ := parseApiPath(req.URL.Path)
+		return prefix + method
+	}
+}
+
+// Continue traces from the request headers and record a span for handling each request
+func (t *Tracer) Handler(next http.Handler) http.Handler {
+	return &ochttp.Handler{
+		Propagation:    format,
+		StartOptions:   trace.StartOptions{Sampler: t.sampler, SpanKind: trace.SpanKindServer},
+		FormatSpanName: spanName("proxy "),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			span := trace.FromContext(req.Context())
+			// The proxy rewrites the path so tag the request first
+			tagHttpRequest(span, req)
+			next.ServeHTTP(w, req)
+			tagHttpResponse(span, w.Header())
+		}),
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Record a span for each request the reverse proxy sends to TRTIS and pass the trace context on in its headers
+func (t *Tracer) Transport(next http.RoundTripper) http.RoundTripper {
+	return &ochttp.Transport{
+		Propagation:    format,
+		StartOptions:   trace.StartOptions{Sampler: t.sampler, SpanKind: trace.SpanKindClient},
+		FormatSpanName: spanName("trtis "),
+		Base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			span := trace.FromContext(req.Context())
+			tagHttpRequest(span, req)
+			res, err := next.RoundTrip(req)
+			if err == nil {
+				tagHttpResponse(span, res.Header)
+			}
+			return res, err
+		}),
+	}
+}
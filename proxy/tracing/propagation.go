@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"go.opencensus.io/plugin/ochttp/propagation/b3"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/trace"
+	"go.opencensus.io/trace/propagation"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"strings"
+)
+
+// Reads the trace context from W3C traceparent or B3 headers, preferring traceparent, and writes both
+type multiFormat []propagation.HTTPFormat
+
+var format propagation.HTTPFormat = multiFormat{&tracecontext.HTTPFormat{}, &b3.HTTPFormat{}}
+
+func (f multiFormat) SpanContextFromRequest(req *http.Request) (trace.SpanContext, bool) {
+	for _, each := range f {
+		if sc, ok := each.SpanContextFromRequest(req); ok {
+			return sc, true
+		}
+	}
+	return trace.SpanContext{}, false
+}
+
+func (f multiFormat) SpanContextToRequest(sc trace.SpanContext, req *http.Request) {
+	for _, each := range f {
+		each.SpanContextToRequest(sc, req)
+	}
+}
+
+// GRPC metadata carries the same trace headers as http
+func extractMetadata(md metadata.MD) (trace.SpanContext, bool) {
+	header := http.Header{}
+	for key, values := range md {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	return format.SpanContextFromRequest(&http.Request{Header: header})
+}
+
+func injectMetadata(sc trace.SpanContext, md metadata.MD) {
+	req := &http.Request{Header: http.Header{}}
+	format.SpanContextToRequest(sc, req)
+	for key, values := range req.Header {
+		md.Set(strings.ToLower(key), values...)
+	}
+}
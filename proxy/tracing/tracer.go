@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"go.opencensus.io/trace"
+)
+
+const (
+	ATTRIBUTE_MODEL_NAME          = "trtis.model_name"
+	ATTRIBUTE_MODEL_VERSION       = "trtis.model_version"
+	ATTRIBUTE_BATCH_SIZE          = "trtis.batch_size"
+	ATTRIBUTE_REQUEST_STATUS_CODE = "trtis.request_status_code"
+	ATTRIBUTE_RPC_METHOD          = "rpc.method"
+)
+
+// Starts OpenCensus spans for the requests the proxy handles and the calls it makes to TRTIS.
+// Spans are sent to the exporters registered with OpenCensus, see RegisterExporter.
+type Tracer struct {
+	sampler trace.Sampler
+}
+
+// Create a tracer. The sample rate is the fraction of new traces recorded,
+// traces started upstream keep the sampling decision made there.
+func NewTracer(sampleRate float64) *Tracer {
+	probability := trace.ProbabilitySampler(sampleRate)
+	return &Tracer{
+		sampler: func(p trace.SamplingParameters) trace.SamplingDecision {
+			if p.ParentContext != (trace.SpanContext{}) {
+				return trace.SamplingDecision{Sample: p.ParentContext.IsSampled()}
+			}
+			return probability(p)
+		},
+	}
+}
@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"github.com/onsi/gomega"
+	trtis "github.com/seldonio/trtis-scheduler/common/proto/trtis"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+const (
+	testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	testTraceId     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanId      = "00f067aa0ba902b7"
+)
+
+// Keeps spans in memory so tests can check them
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (e *memoryExporter) ExportSpan(span *trace.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *memoryExporter) Spans() []*trace.SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*trace.SpanData(nil), e.spans...)
+}
+
+func registerMemoryExporter() (*memoryExporter, func()) {
+	exporter := &memoryExporter{}
+	trace.RegisterExporter(exporter)
+	return exporter, func() { trace.UnregisterExporter(exporter) }
+}
+
+func TestExtractMetadata(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	sc, ok := extractMetadata(metadata.Pairs("traceparent", testTraceparent))
+	g.Expect(ok).Should(gomega.BeTrue())
+	g.Expect(sc.TraceID.String()).Should(gomega.Equal(testTraceId))
+	g.Expect(sc.SpanID.String()).Should(gomega.Equal(testSpanId))
+	g.Expect(sc.IsSampled()).Should(gomega.BeTrue())
+
+	sc, ok = extractMetadata(metadata.Pairs("x-b3-traceid", testTraceId, "x-b3-spanid", testSpanId, "x-b3-sampled", "0"))
+	g.Expect(ok).Should(gomega.BeTrue())
+	g.Expect(sc.SpanID.String()).Should(gomega.Equal(testSpanId))
+	g.Expect(sc.IsSampled()).Should(gomega.BeFalse())
+
+	md := metadata.MD{}
+	injectMetadata(sc, md)
+	g.Expect(md.Get("traceparent")).Should(gomega.HaveLen(1))
+	g.Expect(md.Get("x-b3-spanid")).Should(gomega.Equal([]string{testSpanId}))
+}
+
+func TestGrpcSpans(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	exporter, unregister := registerMemoryExporter()
+	defer unregister()
+	tracer := NewTracer(0)
+	server := tracer.UnaryServerInterceptor()
+	client := tracer.UnaryClientInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/nvidia.inferenceserver.GRPCService/Infer"}
+
+	// The client sampled the trace so it is recorded whatever the sample rate
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", testTraceparent))
+	req := &trtis.InferRequest{ModelName: "mine", MetaData: &trtis.InferRequestHeader{BatchSize: 4}}
+	var upstreamMd metadata.MD
+	_, err := server(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		inferReq := req.(*trtis.InferRequest)
+		inferReq.ModelVersion = 2
+		res := &trtis.InferResponse{}
+		err := client(ctx, info.FullMethod, inferReq, res, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			upstreamMd, _ = metadata.FromOutgoingContext(ctx)
+			reply.(*trtis.InferResponse).RequestStatus = &trtis.RequestStatus{Code: trtis.RequestStatusCode_INVALID_ARG}
+			return nil
+		})
+		return res, err
+	})
+	g.Expect(err).Should(gomega.BeNil())
+
+	spans := exporter.Spans()
+	g.Expect(spans).Should(gomega.HaveLen(2))
+	upstream, proxy := spans[0], spans[1]
+	g.Expect(proxy.Name).Should(gomega.Equal("proxy Infer"))
+	g.Expect(proxy.SpanKind).Should(gomega.Equal(trace.SpanKindServer))
+	g.Expect(proxy.TraceID.String()).Should(gomega.Equal(testTraceId))
+	g.Expect(proxy.ParentSpanID.String()).Should(gomega.Equal(testSpanId))
+	g.Expect(upstream.SpanKind).Should(gomega.Equal(trace.SpanKindClient))
+	g.Expect(upstream.ParentSpanID).Should(gomega.Equal(proxy.SpanID))
+	g.Expect(upstream.Attributes[ATTRIBUTE_MODEL_NAME]).Should(gomega.Equal("mine"))
+	g.Expect(upstream.Attributes[ATTRIBUTE_MODEL_VERSION]).Should(gomega.Equal(int64(2)))
+	g.Expect(upstream.Attributes[ATTRIBUTE_BATCH_SIZE]).Should(gomega.Equal(int64(4)))
+	g.Expect(proxy.Attributes[ATTRIBUTE_REQUEST_STATUS_CODE]).Should(gomega.Equal("INVALID_ARG"))
+
+	// TRTIS receives the upstream span as the parent
+	sc, ok := extractMetadata(upstreamMd)
+	g.Expect(ok).Should(gomega.BeTrue())
+	g.Expect(sc.SpanID).Should(gomega.Equal(upstream.SpanID))
+}
+
+func TestHttpSpans(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	exporter, unregister := registerMemoryExporter()
+	defer unregister()
+	tracer := NewTracer(1)
+
+	var received http.Header
+	trtisServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Header().Set(HEADER_STATUS, `code: SUCCESS server_id: "inference:0"`)
+	}))
+	defer trtisServer.Close()
+	client := &http.Client{Transport: tracer.Transport(http.DefaultTransport)}
+	var clientErr error
+	handler := tracer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequest("POST", trtisServer.URL+"/api/infer/server-name/3", nil)
+		res, err := client.Do(req.WithContext(r.Context()))
+		if clientErr = err; err != nil {
+			return
+		}
+		res.Body.Close()
+		w.Header().Set(HEADER_STATUS, res.Header.Get(HEADER_STATUS))
+	}))
+
+	req := httptest.NewRequest("POST", "/api/infer/mine", nil)
+	req.Header.Set(HEADER_INFER_REQUEST, "batch_size: 8")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	g.Expect(clientErr).Should(gomega.BeNil())
+
+	spans := exporter.Spans()
+	g.Expect(spans).Should(gomega.HaveLen(2))
+	upstream, proxy := spans[0], spans[1]
+	g.Expect(proxy.Name).Should(gomega.Equal("proxy infer"))
+	g.Expect(proxy.ParentSpanID).Should(gomega.Equal(trace.SpanID{}))
+	g.Expect(proxy.Attributes[ATTRIBUTE_MODEL_NAME]).Should(gomega.Equal("mine"))
+	g.Expect(proxy.Attributes[ATTRIBUTE_BATCH_SIZE]).Should(gomega.Equal(int64(8)))
+	g.Expect(proxy.Attributes[ATTRIBUTE_REQUEST_STATUS_CODE]).Should(gomega.Equal("SUCCESS"))
+	g.Expect(upstream.ParentSpanID).Should(gomega.Equal(proxy.SpanID))
+	g.Expect(upstream.Attributes[ATTRIBUTE_MODEL_NAME]).Should(gomega.Equal("server-name"))
+	g.Expect(upstream.Attributes[ATTRIBUTE_MODEL_VERSION]).Should(gomega.Equal(int64(3)))
+
+	sc, ok := format.SpanContextFromRequest(&http.Request{Header: received})
+	g.Expect(ok).Should(gomega.BeTrue())
+	g.Expect(sc.SpanID).Should(gomega.Equal(upstream.SpanID))
+}
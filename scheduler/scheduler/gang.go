@@ -0,0 +1,312 @@
+package scheduler
+
+import (
+	"fmt"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ANNOTATION_POD_GROUP            = "seldon.io/trtis-pod-group"            // Pods in a namespace with the same group are scheduled together
+	ANNOTATION_POD_GROUP_MIN_MEMBER = "seldon.io/trtis-pod-group-min-member" // Number of the group's pods that must fit before any is bound
+)
+
+// Pods which are useless unless at least MinMember of them run, such as the shards of an ensemble
+type PodGroup struct {
+	Namespace string
+	Name      string
+	MinMember int
+}
+
+// The group of a pod, or nil if it is not in one
+func NewPodGroup(pod *v1.Pod) (*PodGroup, error) {
+	name := pod.Annotations[ANNOTATION_POD_GROUP]
+	if name == "" {
+		return nil, nil
+	}
+	group := &PodGroup{Namespace: pod.Namespace, Name: name, MinMember: 1}
+	if value, ok := pod.Annotations[ANNOTATION_POD_GROUP_MIN_MEMBER]; ok {
+		minMember, err := strconv.Atoi(value)
+		if err != nil || minMember < 1 {
+			return nil, fmt.Errorf("invalid %s annotation %q, must be a number of pods greater than zero", ANNOTATION_POD_GROUP_MIN_MEMBER, value)
+		}
+		group.MinMember = minMember
+	}
+	return group, nil
+}
+
+func (g *PodGroup) String() string {
+	return g.Namespace + "/" + g.Name
+}
+
+// GPU memory and model IDs held on nodes for pods which have been placed but not yet bound
+type Reservations struct {
+	mu    sync.Mutex
+	nodes map[string]map[string]*PlacementUnit
+}
+
+func NewReservations() *Reservations {
+	return &Reservations{nodes: make(map[string]map[string]*PlacementUnit)}
+}
+
+func podKey(pod *v1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+func (r *Reservations) Reserve(node string, pod *v1.Pod, unit *PlacementUnit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nodes[node] == nil {
+		r.nodes[node] = make(map[string]*PlacementUnit)
+	}
+	r.nodes[node][podKey(pod)] = unit
+}
+
+func (r *Reservations) Release(node string, pod *v1.Pod) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.nodes[node], podKey(pod))
+	if len(r.nodes[node]) == 0 {
+		delete(r.nodes, node)
+	}
+}
+
+// Everything reserved on a node as one unit
+func (r *Reservations) OnNode(node string) *PlacementUnit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reserved := &PlacementUnit{}
+	for _, unit := range r.nodes[node] {
+		reserved.Add(unit)
+	}
+	return reserved
+}
+
+// Failed group attempts waiting to be retried. Every pending member of a group is queued but one attempt
+// places them all, so while the pod which made the attempt backs off the other members wait too rather
+// than each placing the whole group again.
+type GroupBackoff struct {
+	mu       sync.Mutex
+	attempts map[string]groupAttempt
+}
+
+type groupAttempt struct {
+	pod   string
+	retry time.Time
+}
+
+func NewGroupBackoff() *GroupBackoff {
+	return &GroupBackoff{attempts: make(map[string]groupAttempt)}
+}
+
+// Whether another pod's attempt for the group is backing off
+func (b *GroupBackoff) Waiting(group *PodGroup, pod *v1.Pod) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	attempt, ok := b.attempts[group.String()]
+	return ok && attempt.pod != podKey(pod) && time.Now().Before(attempt.retry)
+}
+
+// Record a failed attempt the pod retries after the wait
+func (b *GroupBackoff) Failed(group *PodGroup, pod *v1.Pod, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempts[group.String()] = groupAttempt{pod: podKey(pod), retry: time.Now().Add(wait)}
+}
+
+func (b *GroupBackoff) Succeeded(group *PodGroup) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.attempts, group.String())
+}
+
+// A group member and the node reserved for it
+type placement struct {
+	pod  *v1.Pod
+	node string
+}
+
+// The group's pods which are not terminating or finished
+func (s *Scheduler) groupMembers(group *PodGroup) ([]*v1.Pod, error) {
+	pods, err := s.clientset.CoreV1().Pods(group.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var members []*v1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		finished := pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+		if pod.Annotations[ANNOTATION_POD_GROUP] == group.Name && pod.DeletionTimestamp == nil && !finished {
+			members = append(members, pod)
+		}
+	}
+	return members, nil
+}
+
+// Schedule a pod with the other pending pods of its group. Nodes are reserved for each member in turn
+// and the members are only bound once enough of them fit for the group to reach its minimum. Otherwise
+// the reservations are released and the pods wait for room. Members the group does not need are bound
+// if they fit too.
+func (s *Scheduler) scheduleGroup(pj *PodJob, group *PodGroup) {
+	p := pj.Pod
+	if s.groupBackoff.Waiting(group, p) {
+		s.logger.Info("Waiting for pod group to be retried", "namespace", p.Namespace, "name", p.Name, "group", group.String())
+		s.requeuePod(pj)
+		return
+	}
+	members, err := s.groupMembers(group)
+	if err != nil {
+		s.logger.Error(err, "failed to get pod group members", "group", group.String())
+		s.requeueGroup(pj, group)
+		return
+	}
+	bound := 0
+	var pending []*v1.Pod
+	for _, member := range members {
+		if member.Spec.NodeName != "" {
+			bound++
+		} else if member.Spec.SchedulerName == schedulerName {
+			// The pod being scheduled goes first
+			if member.Name == p.Name {
+				pending = append([]*v1.Pod{member}, pending...)
+			} else {
+				pending = append(pending, member)
+			}
+		}
+	}
+	if len(pending) == 0 || pending[0].Name != p.Name {
+		s.logger.Info("Pod already scheduled with its group", "namespace", p.Namespace, "name", p.Name, "group", group.String())
+		return
+	}
+	if bound+len(pending) < group.MinMember {
+		message := fmt.Sprintf("pod group %s has %d of its %d pods", group, bound+len(pending), group.MinMember)
+		s.logger.Info("Waiting for pod group members", "group", group.String(), "members", bound+len(pending), "minMember", group.MinMember)
+		s.recordUnschedulable(p, message)
+		s.requeueGroup(pj, group)
+		return
+	}
+
+	placements, fitErr, err := s.reserveGroup(pending)
+	if err != nil {
+		s.logger.Error(err, "failed to place pod group", "group", group.String())
+		s.requeueGroup(pj, group)
+		return
+	}
+	// Members may have been bound or deleted while the group was placed
+	placements, boundSince := s.checkPlacements(placements)
+	bound += boundSince
+	if bound+len(placements) < group.MinMember {
+		s.releaseReservations(placements)
+		message := fmt.Sprintf("pod group %s: %d of the %d pods needed fit", group, bound+len(placements), group.MinMember)
+		if fitErr != nil {
+			message = fmt.Sprintf("%s, %s/%s: %s", message, fitErr.Pod.Namespace, fitErr.Pod.Name, fitErr.Error())
+		}
+		s.logger.Info("Pod group does not fit", "group", group.String(), "message", message)
+		s.recordUnschedulable(p, message)
+		s.requeueGroup(pj, group)
+		return
+	}
+
+	for i, placement := range placements {
+		err := s.bindPod(placement.pod, placement.node)
+		s.reservations.Release(placement.node, placement.pod)
+		if err != nil {
+			s.logger.Error(err, "failed to bind pod group member", "group", group.String(), "name", placement.pod.Name)
+			s.releaseReservations(placements[i+1:])
+			if bound+i < group.MinMember {
+				s.unbindGroup(group, placements[:i], placement.pod, err)
+			}
+			s.requeueGroup(pj, group)
+			return
+		}
+		s.recorder.Eventf(placement.pod, v1.EventTypeNormal, "Scheduled", "Successfully assigned %s/%s to %s with pod group %s",
+			placement.pod.Namespace, placement.pod.Name, placement.node, group)
+	}
+	s.groupBackoff.Succeeded(group)
+}
+
+// Retry the group later, its other members wait for the retry
+func (s *Scheduler) requeueGroup(pj *PodJob, group *PodGroup) {
+	s.groupBackoff.Failed(group, pj.Pod, pj.nextScheduleTime)
+	s.requeuePod(pj)
+}
+
+// Drop placements of members which were bound or deleted since the group's pods were listed, returning
+// the placements still to bind and how many members were bound meanwhile
+func (s *Scheduler) checkPlacements(placements []placement) ([]placement, int) {
+	var checked []placement
+	bound := 0
+	for _, placement := range placements {
+		pod, err := s.clientset.CoreV1().Pods(placement.pod.Namespace).Get(placement.pod.Name, metav1.GetOptions{})
+		switch {
+		case err != nil && !errors.IsNotFound(err):
+			s.logger.Error(err, "failed to get pod group member", "namespace", placement.pod.Namespace, "name", placement.pod.Name)
+		case err == nil && pod.Spec.NodeName != "":
+			bound++
+		case err == nil && pod.DeletionTimestamp == nil && pod.UID == placement.pod.UID:
+			checked = append(checked, placement)
+			continue
+		}
+		s.reservations.Release(placement.node, placement.pod)
+	}
+	return checked, bound
+}
+
+// A bind failed and the group is short of its minimum, so delete the members bound in this attempt which
+// have a controller to recreate them to be scheduled together again, rather than leave them running
+// without the rest of the group. Pods without a controller would be lost so are left bound with a warning.
+func (s *Scheduler) unbindGroup(group *PodGroup, placements []placement, failed *v1.Pod, bindErr error) {
+	for _, placement := range placements {
+		if metav1.GetControllerOf(placement.pod) == nil {
+			s.recorder.Eventf(placement.pod, v1.EventTypeWarning, "PodGroupIncomplete", "pod group %s could not be bound, %s/%s: %v; left running as it has no controller to recreate it",
+				group, failed.Namespace, failed.Name, bindErr)
+			continue
+		}
+		s.recorder.Eventf(placement.pod, v1.EventTypeWarning, "FailedScheduling", "pod group %s could not be bound, %s/%s: %v",
+			group, failed.Namespace, failed.Name, bindErr)
+		err := s.clientset.CoreV1().Pods(placement.pod.Namespace).Delete(placement.pod.Name, &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &placement.pod.UID},
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			s.logger.Error(err, "failed to delete pod group member", "group", group.String(), "name", placement.pod.Name)
+		}
+	}
+}
+
+// Reserve a node for each pod that fits, returning the placements and why the first pod which did not fit
+// failed. Any other error releases the reservations so the group is retried rather than found not to fit.
+func (s *Scheduler) reserveGroup(pods []*v1.Pod) ([]placement, *FitError, error) {
+	var placements []placement
+	var firstErr *FitError
+	for _, pod := range pods {
+		unit, err := NewPlacementUnit(pod)
+		if err != nil {
+			s.releaseReservations(placements)
+			return nil, nil, fmt.Errorf("failed to get models for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+		node, err := s.findFit(pod)
+		if fitErr, ok := err.(*FitError); ok {
+			if firstErr == nil {
+				firstErr = fitErr
+			}
+			continue
+		}
+		if err != nil {
+			s.releaseReservations(placements)
+			return nil, nil, fmt.Errorf("failed to find a node for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+		s.reservations.Reserve(node, pod, unit)
+		placements = append(placements, placement{pod: pod, node: node})
+	}
+	return placements, firstErr, nil
+}
+
+func (s *Scheduler) releaseReservations(placements []placement) {
+	for _, placement := range placements {
+		s.reservations.Release(placement.node, placement.pod)
+	}
+}
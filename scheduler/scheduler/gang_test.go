@@ -0,0 +1,193 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func groupPods(minMember int, names ...string) []runtime.Object {
+	var pods []runtime.Object
+	for _, name := range names {
+		pod := modelPod(name, name, "1Gi", "")
+		pod.Annotations[ANNOTATION_POD_GROUP] = "shards"
+		pod.Annotations[ANNOTATION_POD_GROUP_MIN_MEMBER] = strconv.Itoa(minMember)
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+// Pods of a replica set, which recreates them if they are deleted
+func ownedPods(pods []runtime.Object) []runtime.Object {
+	controller := true
+	for _, pod := range pods {
+		pod.(*v1.Pod).OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "shards", UID: "shards", Controller: &controller}}
+	}
+	return pods
+}
+
+func bindings(s *Scheduler) []string {
+	var nodes []string
+	for _, action := range s.clientset.(*fake.Clientset).Actions() {
+		if action.GetVerb() == "create" && action.GetSubresource() == "binding" {
+			nodes = append(nodes, action.(k8stesting.CreateAction).GetObject().(*v1.Binding).Target.Name)
+		}
+	}
+	return nodes
+}
+
+func scheduledCondition(g *gomega.WithT, s *Scheduler, name string) string {
+	pod, err := s.clientset.CoreV1().Pods("default").Get(name, metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(pod.Status.Conditions).Should(gomega.HaveLen(1))
+	return pod.Status.Conditions[0].Message
+}
+
+func TestScheduleGroupOnlyBindsWholeGroup(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	// Each node has room for one of the 1Gi shards
+	nodes := []*v1.Node{gpuNode("gpu-a", "1610612736"), gpuNode("gpu-b", "1610612736")}
+
+	pods := groupPods(3, "shard-0", "shard-1", "shard-2")
+	s := testScheduler(nodes, pods...)
+	group, err := NewPodGroup(pods[0].(*v1.Pod))
+	g.Expect(err).Should(gomega.BeNil())
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod)}, group)
+	g.Expect(bindings(s)).Should(gomega.BeEmpty())
+	g.Expect(s.reservations.nodes).Should(gomega.BeEmpty())
+	g.Expect(scheduledCondition(g, s, "shard-0")).Should(gomega.HavePrefix("pod group default/shards: 2 of the 3 pods needed fit"))
+
+	pods = groupPods(2, "shard-0", "shard-1", "shard-2")
+	s = testScheduler(nodes, pods...)
+	group, _ = NewPodGroup(pods[0].(*v1.Pod))
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod)}, group)
+	g.Expect(bindings(s)).Should(gomega.ConsistOf("gpu-a", "gpu-b"))
+	g.Expect(s.reservations.nodes).Should(gomega.BeEmpty())
+
+	pods = groupPods(4, "shard-0", "shard-1", "shard-2")
+	s = testScheduler(nodes, pods...)
+	group, _ = NewPodGroup(pods[0].(*v1.Pod))
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod)}, group)
+	g.Expect(bindings(s)).Should(gomega.BeEmpty())
+	g.Expect(scheduledCondition(g, s, "shard-0")).Should(gomega.Equal("pod group default/shards has 3 of its 4 pods"))
+
+	bad := modelPod("bad", "bad", "1Gi", "")
+	bad.Annotations[ANNOTATION_POD_GROUP] = "shards"
+	bad.Annotations[ANNOTATION_POD_GROUP_MIN_MEMBER] = "none"
+	_, err = NewPodGroup(bad)
+	g.Expect(err).ShouldNot(gomega.BeNil())
+}
+
+func TestScheduleGroupUnbindsMembersWhenBindFails(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	nodes := []*v1.Node{gpuNode("gpu-a", "1610612736"), gpuNode("gpu-b", "1610612736")}
+	failBind := func(s *Scheduler) {
+		s.clientset.(*fake.Clientset).PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() == "binding" && action.(k8stesting.CreateAction).GetObject().(*v1.Binding).Name == "shard-1" {
+				return true, nil, fmt.Errorf("node gone")
+			}
+			return false, nil, nil
+		})
+	}
+	pods := ownedPods(groupPods(2, "shard-0", "shard-1"))
+	s := testScheduler(nodes, pods...)
+	failBind(s)
+	group, _ := NewPodGroup(pods[0].(*v1.Pod))
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod)}, group)
+	g.Expect(s.reservations.nodes).Should(gomega.BeEmpty())
+	_, err := s.clientset.CoreV1().Pods("default").Get("shard-0", metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).Should(gomega.BeTrue())
+	_, err = s.clientset.CoreV1().Pods("default").Get("shard-1", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+
+	// Pods without a controller would not be recreated so are left bound with a warning
+	pods = groupPods(2, "shard-0", "shard-1")
+	s = testScheduler(nodes, pods...)
+	failBind(s)
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod)}, group)
+	_, err = s.clientset.CoreV1().Pods("default").Get("shard-0", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Eventually(func() []string {
+		list, err := s.clientset.CoreV1().Events("default").List(metav1.ListOptions{})
+		g.Expect(err).Should(gomega.BeNil())
+		var reasons []string
+		for _, event := range list.Items {
+			reasons = append(reasons, event.Reason)
+		}
+		return reasons
+	}, time.Second).Should(gomega.ContainElement("PodGroupIncomplete"))
+}
+
+func TestScheduleGroupRetriesAfterErrors(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	nodes := []*v1.Node{gpuNode("gpu-a", "1610612736"), gpuNode("gpu-b", "1610612736")}
+	pods := groupPods(2, "shard-0", "shard-1")
+	s := testScheduler(nodes, pods...)
+	// Listing the pods nominated to nodes fails
+	s.clientset.(*fake.Clientset).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+		return !selector.Empty() && selector.Matches(fields.Set{"spec.nodeName": ""}), nil, fmt.Errorf("connection refused")
+	})
+	group, _ := NewPodGroup(pods[0].(*v1.Pod))
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod), nextScheduleTime: time.Minute}, group)
+	g.Expect(bindings(s)).Should(gomega.BeEmpty())
+	g.Expect(s.reservations.nodes).Should(gomega.BeEmpty())
+	g.Expect(s.groupBackoff.Waiting(group, pods[1].(*v1.Pod))).Should(gomega.BeTrue())
+	pod, err := s.clientset.CoreV1().Pods("default").Get("shard-0", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(pod.Status.Conditions).Should(gomega.BeEmpty())
+
+	// Finished members do not count toward the minimum
+	pods = groupPods(2, "shard-0", "shard-1")
+	finished := pods[1].(*v1.Pod)
+	finished.Spec.NodeName = "gpu-b"
+	finished.Status.Phase = v1.PodFailed
+	s = testScheduler(nodes, pods...)
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod)}, group)
+	g.Expect(bindings(s)).Should(gomega.BeEmpty())
+	g.Expect(scheduledCondition(g, s, "shard-0")).Should(gomega.Equal("pod group default/shards has 1 of its 2 pods"))
+}
+
+func TestScheduleGroupSkipsMembersBoundMeanwhile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	nodes := []*v1.Node{gpuNode("gpu-a", "1610612736"), gpuNode("gpu-b", "1610612736")}
+	pods := groupPods(2, "shard-0", "shard-1")
+	s := testScheduler(nodes, pods...)
+	s.clientset.(*fake.Clientset).PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.GetAction).GetName() != "shard-1" {
+			return false, nil, nil
+		}
+		bound := pods[1].(*v1.Pod).DeepCopy()
+		bound.Spec.NodeName = "elsewhere"
+		return true, bound, nil
+	})
+	group, _ := NewPodGroup(pods[0].(*v1.Pod))
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod)}, group)
+	g.Expect(bindings(s)).Should(gomega.HaveLen(1))
+	g.Expect(s.reservations.nodes).Should(gomega.BeEmpty())
+}
+
+func TestScheduleGroupMembersWaitForBackoff(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	nodes := []*v1.Node{gpuNode("gpu-a", "1610612736")}
+	pods := groupPods(2, "shard-0", "shard-1")
+	s := testScheduler(nodes, pods...)
+	group, _ := NewPodGroup(pods[0].(*v1.Pod))
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod), nextScheduleTime: time.Minute}, group)
+	listed := len(s.clientset.(*fake.Clientset).Actions())
+
+	// The other member does not place the group again while the first one's attempt backs off
+	s.scheduleGroup(&PodJob{Pod: pods[1].(*v1.Pod), nextScheduleTime: time.Minute}, group)
+	g.Expect(s.clientset.(*fake.Clientset).Actions()).Should(gomega.HaveLen(listed))
+	s.scheduleGroup(&PodJob{Pod: pods[0].(*v1.Pod), nextScheduleTime: time.Minute}, group)
+	g.Expect(len(s.clientset.(*fake.Clientset).Actions())).Should(gomega.BeNumerically(">", listed))
+}
@@ -1,10 +1,10 @@
 package scheduler
 
 import (
-	"errors"
-	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/seldonio/trtis-scheduler/common/events"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	v13 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -13,6 +13,7 @@ import (
 	v12 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"log"
 	log2 "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"time"
@@ -25,7 +26,9 @@ const (
 	MAX_SCHEDULE_WAIT                 = 2*time.Minute + 2*time.Second
 )
 
-type predicateFunc func(clientSet *kubernetes.Clientset, node *v1.Node, pod *v1.Pod, logger logr.Logger) bool
+// A predicate returns nil when the pod fits on the node, otherwise why it does not. Reserved is what
+// pods placed on the node but not yet bound will use.
+type predicateFunc func(clientSet kubernetes.Interface, node *v1.Node, reserved *PlacementUnit, pod *v1.Pod, logger logr.Logger) *FilterStatus
 type priorityFunc func(node *v1.Node, pod *v1.Pod, logger logr.Logger) int
 
 type PodJob struct {
@@ -34,12 +37,15 @@ type PodJob struct {
 }
 
 type Scheduler struct {
-	clientset  *kubernetes.Clientset
-	podQueue   chan *PodJob
-	nodeLister v12.NodeLister
-	predicates []predicateFunc
-	priorities []priorityFunc
-	logger     logr.Logger
+	clientset    kubernetes.Interface
+	podQueue     chan *PodJob
+	nodeLister   v12.NodeLister
+	predicates   []predicateFunc
+	priorities   []priorityFunc
+	reservations *Reservations
+	groupBackoff *GroupBackoff
+	recorder     record.EventRecorder
+	logger       logr.Logger
 }
 
 func NewScheduler(podQueue chan *PodJob, quit chan struct{}) Scheduler {
@@ -66,7 +72,10 @@ func NewScheduler(podQueue chan *PodJob, quit chan struct{}) Scheduler {
 		priorities: []priorityFunc{
 			randomPriority,
 		},
-		logger: logger,
+		reservations: NewReservations(),
+		groupBackoff: NewGroupBackoff(),
+		recorder:     events.NewEventRecorder(clientset.CoreV1().Events(""), v1.EventSource{Component: schedulerName}),
+		logger:       logger,
 	}
 }
 
@@ -141,12 +150,43 @@ func (s *Scheduler) requeuePod(podJob *PodJob) {
 func (s *Scheduler) ScheduleOne() {
 
 	pj := <-s.podQueue
-	p := pj.Pod
+	// The queued pod may have been nominated to a node, bound or deleted since it was queued
+	p, err := s.clientset.CoreV1().Pods(pj.Pod.Namespace).Get(pj.Pod.Name, v13.GetOptions{})
+	if errors.IsNotFound(err) {
+		s.logger.Info("Pod deleted before it was scheduled", "namespace", pj.Pod.Namespace, "name", pj.Pod.Name)
+		return
+	}
+	if err != nil {
+		s.logger.Error(err, "failed to get pod to schedule", "namespace", pj.Pod.Namespace, "name", pj.Pod.Name)
+		s.requeuePod(pj)
+		return
+	}
+	if p.Spec.NodeName != "" {
+		s.logger.Info("Pod already scheduled", "namespace", p.Namespace, "name", p.Name, "node", p.Spec.NodeName)
+		return
+	}
+	pj.Pod = p
 	s.logger.Info("found a pod to schedule", "namespace", p.Namespace, "name", p.Name)
 
+	group, err := NewPodGroup(p)
+	if err != nil {
+		s.logger.Error(err, "invalid pod group")
+		s.recordUnschedulable(p, err.Error())
+		s.requeuePod(pj)
+		return
+	}
+	if group != nil {
+		s.scheduleGroup(pj, group)
+		return
+	}
+
 	node, err := s.findFit(p)
 	if err != nil {
 		s.logger.Error(err, "cannot find node that fits pod")
+		if fitErr, ok := err.(*FitError); ok {
+			s.recordUnschedulable(p, fitErr.Error())
+			s.preempt(p, fitErr)
+		}
 		s.requeuePod(pj)
 		return
 	}
@@ -158,15 +198,13 @@ func (s *Scheduler) ScheduleOne() {
 		return
 	}
 
-	message := fmt.Sprintf("Placed pod [%s/%s] on %s\n", p.Namespace, p.Name, node)
-
-	err = s.emitEvent(p, message)
-	if err != nil {
-		s.logger.Error(err, "failed to emit scheduled event")
-		return
+	s.recorder.Eventf(p, v1.EventTypeNormal, "Scheduled", "Successfully assigned %s/%s to %s", p.Namespace, p.Name, node)
+	// The room made on the nominated node is not needed any more
+	if p.Status.NominatedNodeName != "" && p.Status.NominatedNodeName != node {
+		if err := s.nominate(p, ""); err != nil {
+			s.logger.Error(err, "failed to clear nominated node", "namespace", p.Namespace, "name", p.Name)
+		}
 	}
-
-	s.logger.Info(message)
 }
 
 func (s *Scheduler) findFit(pod *v1.Pod) (string, error) {
@@ -175,9 +213,21 @@ func (s *Scheduler) findFit(pod *v1.Pod) (string, error) {
 		return "", err
 	}
 
-	filteredNodes := s.runPredicates(nodes, pod)
+	nominated, err := s.nominatedOnNodes(pod)
+	if err != nil {
+		return "", err
+	}
+	// A pod which preempted others goes to the node it made room on while it still fits there
+	if nominatedNode := pod.Status.NominatedNodeName; nominatedNode != "" {
+		for _, node := range nodes {
+			if node.Name == nominatedNode && s.predicatesApply(node, pod, nominated) == nil {
+				return node.Name, nil
+			}
+		}
+	}
+	filteredNodes, failedNodes := s.runPredicates(nodes, pod, nominated)
 	if len(filteredNodes) == 0 {
-		return "", errors.New("failed to find node that fits pod")
+		return "", &FitError{Pod: pod, NumNodes: len(nodes), FailedNodes: failedNodes}
 	}
 	priorities := s.prioritize(filteredNodes, pod)
 	return s.findBestNode(priorities), nil
@@ -197,54 +247,82 @@ func (s *Scheduler) bindPod(p *v1.Pod, node string) error {
 	})
 }
 
-func (s *Scheduler) emitEvent(p *v1.Pod, message string) error {
-	timestamp := time.Now().UTC()
-	_, err := s.clientset.CoreV1().Events(p.Namespace).Create(&v1.Event{
-		Count:          1,
-		Message:        message,
-		Reason:         "Scheduled",
-		LastTimestamp:  v13.NewTime(timestamp),
-		FirstTimestamp: v13.NewTime(timestamp),
-		Type:           "Normal",
-		Source: v1.EventSource{
-			Component: schedulerName,
-		},
-		InvolvedObject: v1.ObjectReference{
-			Kind:      "Pod",
-			Name:      p.Name,
-			Namespace: p.Namespace,
-			UID:       p.UID,
-		},
-		ObjectMeta: v13.ObjectMeta{
-			GenerateName: p.Name + "-",
-		},
-	})
+// Tell the user why the pod is still pending with a FailedScheduling event and the PodScheduled condition
+func (s *Scheduler) recordUnschedulable(p *v1.Pod, message string) {
+	s.recorder.Event(p, v1.EventTypeWarning, "FailedScheduling", message)
+	if err := s.updatePodScheduledCondition(p, message); err != nil {
+		s.logger.Error(err, "failed to update pod scheduled condition")
+	}
+}
+
+func (s *Scheduler) updatePodScheduledCondition(p *v1.Pod, message string) error {
+	pod, err := s.clientset.CoreV1().Pods(p.Namespace).Get(p.Name, v13.GetOptions{})
 	if err != nil {
 		return err
 	}
-	return nil
+	condition := v1.PodCondition{
+		Type:               v1.PodScheduled,
+		Status:             v1.ConditionFalse,
+		Reason:             v1.PodReasonUnschedulable,
+		Message:            message,
+		LastProbeTime:      v13.Now(),
+		LastTransitionTime: v13.Now(),
+	}
+	found := false
+	for i, existing := range pod.Status.Conditions {
+		if existing.Type != v1.PodScheduled {
+			continue
+		}
+		found = true
+		if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+			return nil
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		pod.Status.Conditions[i] = condition
+	}
+	if !found {
+		pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	}
+	_, err = s.clientset.CoreV1().Pods(p.Namespace).UpdateStatus(pod)
+	return err
 }
 
-func (s *Scheduler) runPredicates(nodes []*v1.Node, pod *v1.Pod) []*v1.Node {
+func (s *Scheduler) runPredicates(nodes []*v1.Node, pod *v1.Pod, nominated map[string]*PlacementUnit) ([]*v1.Node, map[string]*FilterStatus) {
 	filteredNodes := make([]*v1.Node, 0)
+	failedNodes := make(map[string]*FilterStatus)
 	for _, node := range nodes {
-		if s.predicatesApply(node, pod) {
+		if status := s.predicatesApply(node, pod, nominated); status != nil {
+			s.logger.Info("Node does not fit", "name", node.Name, "reason", status.Reason, "message", status.Message)
+			failedNodes[node.Name] = status
+		} else {
 			filteredNodes = append(filteredNodes, node)
 		}
 	}
 	for _, n := range filteredNodes {
 		s.logger.Info("Node fits: ", "name", n.Name)
 	}
-	return filteredNodes
+	return filteredNodes, failedNodes
 }
 
-func (s *Scheduler) predicatesApply(node *v1.Node, pod *v1.Pod) bool {
+func (s *Scheduler) predicatesApply(node *v1.Node, pod *v1.Pod, nominated map[string]*PlacementUnit) *FilterStatus {
+	reserved := s.reservedOnNode(node.Name, nominated)
 	for _, predicate := range s.predicates {
-		if !predicate(s.clientset, node, pod, s.logger.WithName(node.Name)) {
-			return false
+		if status := predicate(s.clientset, node, reserved, pod, s.logger.WithName(node.Name)); status != nil {
+			return status
 		}
 	}
-	return true
+	return nil
+}
+
+// What pods placed on a node but not yet bound and pods nominated to it will use
+func (s *Scheduler) reservedOnNode(node string, nominated map[string]*PlacementUnit) *PlacementUnit {
+	reserved := s.reservations.OnNode(node)
+	if unit, ok := nominated[node]; ok {
+		reserved.Add(unit)
+	}
+	return reserved
 }
 
 func (s *Scheduler) prioritize(nodes []*v1.Node, pod *v1.Pod) map[string]int {
@@ -262,7 +340,7 @@ func (s *Scheduler) findBestNode(priorities map[string]int) string {
 	var maxP int
 	var bestNode string
 	for node, p := range priorities {
-		if p > maxP {
+		if bestNode == "" || p > maxP {
 			maxP = p
 			bestNode = node
 		}
@@ -0,0 +1,195 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/onsi/gomega"
+	"github.com/seldonio/trtis-scheduler/common/events"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	v12 "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"testing"
+	"time"
+)
+
+func modelPod(name string, modelId string, gpuMemory string, nodeName string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: map[string]string{ANNOTATION_MODEL_ID: modelId},
+		},
+		Spec: v1.PodSpec{
+			NodeName:      nodeName,
+			SchedulerName: schedulerName,
+			Containers: []v1.Container{{
+				Name: "model",
+				Resources: v1.ResourceRequirements{
+					Limits: v1.ResourceList{RESOURCES_TRTIS_GPU_MEMORY: resource.MustParse(gpuMemory)},
+				},
+			}},
+		},
+	}
+}
+
+func gpuNode(name string, total string) *v1.Node {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if total != "" {
+		node.Annotations = map[string]string{ANNOTATION_TRTIS_GPU_MEMORY_TOTAL: total}
+	}
+	return node
+}
+
+// A scheduler over a fake clientset whose pod list honours the spec.nodeName field selector and which
+// does not bind pods
+func testScheduler(nodes []*v1.Node, pods ...runtime.Object) *Scheduler {
+	clientset := fake.NewSimpleClientset(pods...)
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+		if selector == nil || selector.Empty() {
+			return false, nil, nil
+		}
+		list := &v1.PodList{}
+		for _, obj := range pods {
+			pod, ok := obj.(*v1.Pod)
+			if ok && selector.Matches(fields.Set{"spec.nodeName": pod.Spec.NodeName}) {
+				list.Items = append(list.Items, *pod)
+			}
+		}
+		return true, list, nil
+	})
+	// Bindings are only recorded as actions
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return action.GetSubresource() == "binding", nil, nil
+	})
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		indexer.Add(node)
+	}
+	return &Scheduler{
+		clientset:    clientset,
+		nodeLister:   v12.NewNodeLister(indexer),
+		predicates:   []predicateFunc{trtisPredicate},
+		priorities:   []priorityFunc{randomPriority},
+		reservations: NewReservations(),
+		groupBackoff: NewGroupBackoff(),
+		recorder:     events.NewEventRecorder(clientset.CoreV1().Events("default"), v1.EventSource{Component: schedulerName}),
+		logger:       logf.Log.WithName("test"),
+	}
+}
+
+func TestFindFitReportsWhyNodesFail(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	pending := modelPod("resnet-1", "resnet", "1Gi", "")
+	s := testScheduler([]*v1.Node{
+		gpuNode("small-1", "536870912"),
+		gpuNode("small-2", "536870912"),
+		gpuNode("loaded", "17071734784"),
+		gpuNode("cpu", ""),
+	}, pending, modelPod("resnet-0", "resnet", "1Gi", "loaded"))
+
+	_, err := s.findFit(pending)
+	fitErr, ok := err.(*FitError)
+	g.Expect(ok).Should(gomega.BeTrue())
+	g.Expect(fitErr.FailedNodes["small-1"].Message).Should(gomega.Equal("requested 1Gi of GPU memory, available 512Mi"))
+	g.Expect(fitErr.Error()).Should(gomega.Equal("0/4 nodes available: 2 insufficient trtis-gpu-mem, " +
+		"1 missing seldon.io/trtis-gpu-mem-total annotation, 1 model resnet already present"))
+
+	s.recordUnschedulable(pending, fitErr.Error())
+	pod, err := s.clientset.CoreV1().Pods("default").Get("resnet-1", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(pod.Status.Conditions).Should(gomega.HaveLen(1))
+	g.Expect(pod.Status.Conditions[0].Status).Should(gomega.Equal(v1.ConditionFalse))
+	g.Expect(pod.Status.Conditions[0].Reason).Should(gomega.Equal(v1.PodReasonUnschedulable))
+	g.Expect(pod.Status.Conditions[0].Message).Should(gomega.Equal(fitErr.Error()))
+	events := func() []v1.Event {
+		list, err := s.clientset.CoreV1().Events("default").List(metav1.ListOptions{})
+		g.Expect(err).Should(gomega.BeNil())
+		return list.Items
+	}
+	g.Eventually(events, time.Second).Should(gomega.HaveLen(1))
+	g.Expect(events()[0].Reason).Should(gomega.Equal("FailedScheduling"))
+
+	// The same failure again is counted on the first event
+	s.recordUnschedulable(pending, fitErr.Error())
+	g.Eventually(func() int32 {
+		items := events()
+		if len(items) != 1 {
+			return 0
+		}
+		return items[0].Count
+	}, time.Second).Should(gomega.Equal(int32(2)))
+
+	s.nodeLister = testScheduler([]*v1.Node{gpuNode("free", "17071734784")}).nodeLister
+	node, err := s.findFit(pending)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(node).Should(gomega.Equal("free"))
+}
+
+func withVersion(pod *v1.Pod, version string) *v1.Pod {
+	pod.Annotations[ANNOTATION_MODEL_VERSION] = version
+	return pod
+}
+
+func TestFindFitPlacesVersionUpdateWithItsModel(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	serving := modelPod("resnet-v1", "resnet", "1Gi", "gpu")
+	update := withVersion(modelPod("resnet-v2", "resnet", "1Gi", ""), "2")
+	nodes := []*v1.Node{gpuNode("gpu", "3758096384")}
+
+	// A pod adding a new version joins the node already serving the model
+	s := testScheduler(nodes, serving, update)
+	node, err := s.findFit(update)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(node).Should(gomega.Equal("gpu"))
+	g.Expect(s.bindPod(update, node)).Should(gomega.BeNil())
+
+	// Another copy of the model, or of a version the node already has, is still kept off the node
+	bound := withVersion(modelPod("resnet-v2", "resnet", "1Gi", "gpu"), "2")
+	for _, pod := range []*v1.Pod{modelPod("resnet-copy", "resnet", "512Mi", ""), withVersion(modelPod("resnet-v2-copy", "resnet", "512Mi", ""), "2")} {
+		s = testScheduler(nodes, serving, bound, pod)
+		_, err = s.findFit(pod)
+		fitErr, ok := err.(*FitError)
+		g.Expect(ok).Should(gomega.BeTrue())
+		g.Expect(fitErr.FailedNodes["gpu"].Reason).Should(gomega.Equal("model resnet already present"))
+	}
+
+	// The new version needs GPU memory of its own while the old version is served
+	s = testScheduler(nodes, serving, modelPod("other", "other", "2Gi", "gpu"), update)
+	_, err = s.findFit(update)
+	fitErr, ok := err.(*FitError)
+	g.Expect(ok).Should(gomega.BeTrue())
+	g.Expect(fitErr.FailedNodes["gpu"].Reason).Should(gomega.Equal("insufficient trtis-gpu-mem"))
+}
+
+func TestFindFitCountsInvalidPlacedPods(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	invalid := modelPod("invalid", "ensemble", "1Gi", "gpu")
+	invalid.Annotations[ANNOTATION_ENSEMBLE_MODELS] = "resnet=lots"
+	pending := modelPod("simple", "simple", "1Gi", "")
+	s := testScheduler([]*v1.Node{gpuNode("gpu", "3221225472")}, pending, invalid)
+
+	node, err := s.findFit(pending)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(node).Should(gomega.Equal("gpu"))
+
+	// The invalid pod's own memory is still counted
+	s = testScheduler([]*v1.Node{gpuNode("gpu", "1610612736")}, pending, invalid)
+	_, err = s.findFit(pending)
+	g.Expect(err).Should(gomega.BeAssignableToTypeOf(&FitError{}))
+
+	// Failing to list the node's pods is not reported as an invalid annotation
+	s.clientset.(*fake.Clientset).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+		return selector.Matches(fields.Set{"spec.nodeName": "gpu"}), nil, fmt.Errorf("connection refused")
+	})
+	_, err = s.findFit(pending)
+	g.Expect(err.Error()).Should(gomega.Equal("0/1 nodes available: 1 internal error"))
+	g.Expect(err.(*FitError).FailedNodes["gpu"].Message).Should(gomega.Equal("failed to list pods on node: connection refused"))
+}
@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/go-logr/logr"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"strings"
+)
+
+const (
+	// Models composing an ensemble with their GPU memory, e.g. "preprocess=512Mi,resnet=2Gi"
+	ANNOTATION_ENSEMBLE_MODELS = "seldon.io/trtis-ensemble-models"
+	// Version the pod's loader adds to its model, so the pod may join a node already serving the model
+	ANNOTATION_MODEL_VERSION = "seldon.io/trtis-model-version"
+)
+
+// The models a pod loads onto a TRTIS server and the GPU memory they need.
+// An ensemble and its composing models are placed together on one node.
+type PlacementUnit struct {
+	ModelIds  []string
+	GpuMemory int64
+	// Version added to a model by model ID, for pods rolling a new version onto a server
+	Versions map[string]string
+}
+
+// Get the unit of a pod. If an ensemble member's GPU memory is invalid the error is returned with the
+// unit counting the member's model ID but not its memory.
+func NewPlacementUnit(pod *v1.Pod) (*PlacementUnit, error) {
+	unit := &PlacementUnit{}
+	var err error
+	if modelId := pod.Annotations[ANNOTATION_MODEL_ID]; modelId != "" {
+		unit.ModelIds = append(unit.ModelIds, modelId)
+		if version := pod.Annotations[ANNOTATION_MODEL_VERSION]; version != "" {
+			unit.Versions = map[string]string{modelId: version}
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		// There always needs to be a limit for non default resource types
+		if limitMem, ok := c.Resources.Limits[RESOURCES_TRTIS_GPU_MEMORY]; ok {
+			unit.GpuMemory += limitMem.Value()
+		}
+	}
+	if members, ok := pod.Annotations[ANNOTATION_ENSEMBLE_MODELS]; ok {
+		for _, member := range strings.Split(members, ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			parts := strings.SplitN(member, "=", 2)
+			unit.ModelIds = append(unit.ModelIds, parts[0])
+			if len(parts) == 2 {
+				mem, parseErr := resource.ParseQuantity(strings.TrimSpace(parts[1]))
+				if parseErr != nil {
+					if err == nil {
+						err = fmt.Errorf("invalid GPU memory for ensemble model %s: %v", parts[0], parseErr)
+					}
+					continue
+				}
+				unit.GpuMemory += mem.Value()
+			}
+		}
+	}
+	return unit, err
+}
+
+// The unit of a pod on or nominated to a node. One pod with an invalid annotation must not make its node
+// unusable for every other pod, so the error is logged and the memory it declares validly is counted.
+func placedUnit(pod *v1.Pod, logger logr.Logger) *PlacementUnit {
+	unit, err := NewPlacementUnit(pod)
+	if err != nil {
+		logger.Error(err, "Invalid annotation on placed pod", "namespace", pod.Namespace, "name", pod.Name)
+	}
+	return unit
+}
+
+// Add the models and GPU memory of another unit
+func (u *PlacementUnit) Add(other *PlacementUnit) {
+	u.ModelIds = append(u.ModelIds, other.ModelIds...)
+	u.GpuMemory += other.GpuMemory
+	for modelId, version := range other.Versions {
+		if u.Versions == nil {
+			u.Versions = make(map[string]string)
+		}
+		u.Versions[modelId] = version
+	}
+}
+
+// The versions of each model on a node, "" for pods which do not add a version
+type modelSet map[string]map[string]bool
+
+func (m modelSet) add(unit *PlacementUnit) {
+	for _, modelId := range unit.ModelIds {
+		if m[modelId] == nil {
+			m[modelId] = make(map[string]bool)
+		}
+		m[modelId][unit.Versions[modelId]] = true
+	}
+}
+
+// The first of the unit's models which clashes with a model on the node. A model may only be
+// loaded once on a node but a pod may add a version of it the node does not have yet.
+func (m modelSet) conflict(unit *PlacementUnit) (string, bool) {
+	for _, modelId := range unit.ModelIds {
+		versions, ok := m[modelId]
+		if !ok {
+			continue
+		}
+		if version := unit.Versions[modelId]; version == "" || versions[version] {
+			return modelId, true
+		}
+	}
+	return "", false
+}
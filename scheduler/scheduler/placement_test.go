@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestEnsemblePlacementUnit(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				ANNOTATION_MODEL_ID:        "ensemble",
+				ANNOTATION_ENSEMBLE_MODELS: "preprocess=512Mi, resnet=1Gi,postprocess",
+			},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Resources: v1.ResourceRequirements{
+					Limits: v1.ResourceList{RESOURCES_TRTIS_GPU_MEMORY: resource.MustParse("256Mi")},
+				},
+			}},
+		},
+	}
+	unit, err := NewPlacementUnit(pod)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(unit.ModelIds).Should(gomega.Equal([]string{"ensemble", "preprocess", "resnet", "postprocess"}))
+	g.Expect(unit.GpuMemory).Should(gomega.Equal(int64((256 + 512 + 1024) * 1024 * 1024)))
+
+	// The valid parts of an invalid annotation are still counted
+	pod.Annotations[ANNOTATION_ENSEMBLE_MODELS] = "resnet=lots,preprocess=512Mi"
+	unit, err = NewPlacementUnit(pod)
+	g.Expect(err).ShouldNot(gomega.BeNil())
+	g.Expect(unit.ModelIds).Should(gomega.Equal([]string{"ensemble", "resnet", "preprocess"}))
+	g.Expect(unit.GpuMemory).Should(gomega.Equal(int64((256 + 512) * 1024 * 1024)))
+}
@@ -0,0 +1,295 @@
+package scheduler
+
+import (
+	"k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sort"
+	"strconv"
+)
+
+// A node where evicting the victims makes room for the preempting pod
+type preemptionCandidate struct {
+	node              string
+	victims           []*v1.Pod
+	maxVictimPriority int32
+}
+
+// A pod that could be evicted with the GPU memory it frees
+type victim struct {
+	pod       *v1.Pod
+	gpuMemory int64
+	priority  int32
+}
+
+// The priority of a pod from its PriorityClass. The Priority admission plugin resolves the class into
+// spec.priority, the class is only looked up if it has not.
+func (s *Scheduler) podPriority(pod *v1.Pod) int32 {
+	if pod.Spec.Priority != nil {
+		return *pod.Spec.Priority
+	}
+	if pod.Spec.PriorityClassName != "" {
+		class, err := s.clientset.SchedulingV1().PriorityClasses().Get(pod.Spec.PriorityClassName, metav1.GetOptions{})
+		if err == nil {
+			return class.Value
+		}
+		s.logger.Error(err, "Failed to get priority class", "name", pod.Spec.PriorityClassName)
+	}
+	return 0
+}
+
+// Make room for a pod no node fits by evicting lower priority model pods from the node where the fewest
+// have to go. The pod is nominated to that node and bound on a later attempt once the victims have gone.
+func (s *Scheduler) preempt(p *v1.Pod, fitErr *FitError) {
+	pod, err := s.clientset.CoreV1().Pods(p.Namespace).Get(p.Name, metav1.GetOptions{})
+	if err != nil {
+		s.logger.Error(err, "Failed to get pod to preempt for", "namespace", p.Namespace, "name", p.Name)
+		return
+	}
+	priority := s.podPriority(pod)
+	if !s.eligibleToPreempt(pod, priority) {
+		return
+	}
+	candidate, err := s.findPreemptionCandidate(pod, priority, fitErr)
+	if err != nil {
+		s.logger.Error(err, "Failed to find pods to preempt", "namespace", pod.Namespace, "name", pod.Name)
+		return
+	}
+	if candidate == nil {
+		s.logger.Info("No lower priority pods to preempt", "namespace", pod.Namespace, "name", pod.Name, "priority", priority)
+		return
+	}
+
+	s.logger.Info("Preempting pods", "namespace", pod.Namespace, "name", pod.Name, "node", candidate.node, "victims", len(candidate.victims))
+	if err := s.nominate(pod, candidate.node); err != nil {
+		s.logger.Error(err, "Failed to set nominated node", "namespace", pod.Namespace, "name", pod.Name, "node", candidate.node)
+		return
+	}
+	for _, victim := range candidate.victims {
+		if err := s.evict(victim); err != nil {
+			s.logger.Error(err, "Failed to evict pod", "namespace", victim.Namespace, "name", victim.Name)
+			// The pod will not fit on the node without the rest of the victims so stop holding it, whichever
+			// pod fits next may use the room made by the victims already evicted
+			if err := s.nominate(pod, ""); err != nil {
+				s.logger.Error(err, "Failed to clear nominated node", "namespace", pod.Namespace, "name", pod.Name)
+			}
+			return
+		}
+		s.recorder.Eventf(victim, v1.EventTypeNormal, "Preempted", "by %s/%s on node %s", pod.Namespace, pod.Name, candidate.node)
+	}
+}
+
+// Set the node a pod is nominated to, or clear the nomination when node is empty
+func (s *Scheduler) nominate(p *v1.Pod, node string) error {
+	pod, err := s.clientset.CoreV1().Pods(p.Namespace).Get(p.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if pod.Status.NominatedNodeName == node {
+		return nil
+	}
+	pod.Status.NominatedNodeName = node
+	_, err = s.clientset.CoreV1().Pods(pod.Namespace).UpdateStatus(pod)
+	return err
+}
+
+// The models and GPU memory of pending pods on the nodes they were nominated to, so the room preemption
+// made for them is kept. Pods of lower priority than the pod being placed are left out as it may take
+// their room like it could preempt them.
+func (s *Scheduler) nominatedOnNodes(pod *v1.Pod) (map[string]*PlacementUnit, error) {
+	pending, err := podsOnNode(s.clientset, "")
+	if err != nil {
+		return nil, err
+	}
+	priority := s.podPriority(pod)
+	nominated := make(map[string]*PlacementUnit)
+	for i := range pending.Items {
+		other := &pending.Items[i]
+		node := other.Status.NominatedNodeName
+		if node == "" || other.DeletionTimestamp != nil || podKey(other) == podKey(pod) || s.podPriority(other) < priority {
+			continue
+		}
+		unit := placedUnit(other, s.logger)
+		if nominated[node] == nil {
+			nominated[node] = &PlacementUnit{}
+		}
+		nominated[node].Add(unit)
+	}
+	return nominated, nil
+}
+
+// A pod may not preempt while lower priority pods it already preempted on its nominated node are terminating,
+// or if it asked never to preempt
+func (s *Scheduler) eligibleToPreempt(pod *v1.Pod, priority int32) bool {
+	if pod.Spec.PreemptionPolicy != nil && *pod.Spec.PreemptionPolicy == v1.PreemptNever {
+		return false
+	}
+	if pod.Status.NominatedNodeName == "" {
+		return true
+	}
+	pods, err := podsOnNode(s.clientset, pod.Status.NominatedNodeName)
+	if err != nil {
+		s.logger.Error(err, "Failed to get pods on nominated node", "node", pod.Status.NominatedNodeName)
+		return false
+	}
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp != nil && s.podPriority(&pods.Items[i]) < priority {
+			s.logger.Info("Waiting for preempted pods to terminate", "namespace", pod.Namespace, "name", pod.Name, "node", pod.Status.NominatedNodeName)
+			return false
+		}
+	}
+	return true
+}
+
+// Find the node needing the fewest victims, then the lowest priority victims, among the nodes that
+// rejected the pod for its GPU memory
+func (s *Scheduler) findPreemptionCandidate(pod *v1.Pod, priority int32, fitErr *FitError) (*preemptionCandidate, error) {
+	unit, err := NewPlacementUnit(pod)
+	if err != nil {
+		return nil, err
+	}
+	pdbs, err := s.clientset.PolicyV1beta1().PodDisruptionBudgets("").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nominated, err := s.nominatedOnNodes(pod)
+	if err != nil {
+		return nil, err
+	}
+	var best *preemptionCandidate
+	for nodeName, status := range fitErr.FailedNodes {
+		if !status.Resolvable {
+			continue
+		}
+		node, err := s.nodeLister.Get(nodeName)
+		if err != nil {
+			return nil, err
+		}
+		candidate, err := s.selectVictims(node, priority, unit, s.reservedOnNode(nodeName, nominated), pdbs.Items)
+		if err != nil {
+			return nil, err
+		}
+		if candidate != nil && (best == nil || candidate.betterThan(best)) {
+			best = candidate
+		}
+	}
+	return best, nil
+}
+
+func (c *preemptionCandidate) betterThan(other *preemptionCandidate) bool {
+	if len(c.victims) != len(other.victims) {
+		return len(c.victims) < len(other.victims)
+	}
+	if c.maxVictimPriority != other.maxVictimPriority {
+		return c.maxVictimPriority < other.maxVictimPriority
+	}
+	return c.node < other.node
+}
+
+// Choose the fewest lower priority pods to evict from a node for the unit to fit, or nil if it cannot be
+// made to fit. The largest pods are taken first and pods whose eviction would exceed a PodDisruptionBudget
+// are never chosen. Reserved is what pods placed on or nominated to the node will use.
+func (s *Scheduler) selectVictims(node *v1.Node, priority int32, unit *PlacementUnit, reserved *PlacementUnit, pdbs []policyv1beta1.PodDisruptionBudget) (*preemptionCandidate, error) {
+	total, err := strconv.ParseInt(node.Annotations[ANNOTATION_TRTIS_GPU_MEMORY_TOTAL], 0, 64)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := podsOnNode(s.clientset, node.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nodes already holding one of the unit's models are never preempted on, evicting a pod only to
+	// load the same model again frees nothing
+	models := make(modelSet)
+	models.add(reserved)
+	if _, conflicts := models.conflict(unit); conflicts {
+		return nil, nil
+	}
+	used := reserved.GpuMemory
+	var victims []*victim
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// Pods already terminating free their memory without being evicted
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		podUnit := placedUnit(pod, s.logger)
+		used += podUnit.GpuMemory
+		models.add(podUnit)
+		if _, conflicts := models.conflict(unit); conflicts {
+			return nil, nil
+		}
+		podPriority := s.podPriority(pod)
+		if podPriority < priority && podUnit.GpuMemory > 0 {
+			victims = append(victims, &victim{pod: pod, gpuMemory: podUnit.GpuMemory, priority: podPriority})
+		}
+	}
+
+	budgets := make(map[string]int32)
+	for i := range pdbs {
+		budgets[pdbs[i].Namespace+"/"+pdbs[i].Name] = pdbs[i].Status.PodDisruptionsAllowed
+	}
+	candidate := &preemptionCandidate{node: node.Name}
+	available := total - used
+	sort.Slice(victims, func(i, j int) bool {
+		if victims[i].gpuMemory != victims[j].gpuMemory {
+			return victims[i].gpuMemory > victims[j].gpuMemory
+		}
+		return victims[i].priority < victims[j].priority
+	})
+	for _, v := range victims {
+		if available > unit.GpuMemory {
+			break
+		}
+		matching := disruptionBudgetsFor(v.pod, pdbs)
+		allowed := true
+		for _, key := range matching {
+			if budgets[key] <= 0 {
+				allowed = false
+			}
+		}
+		if !allowed {
+			continue
+		}
+		for _, key := range matching {
+			budgets[key]--
+		}
+		candidate.victims = append(candidate.victims, v.pod)
+		if len(candidate.victims) == 1 || v.priority > candidate.maxVictimPriority {
+			candidate.maxVictimPriority = v.priority
+		}
+		available += v.gpuMemory
+	}
+	if available <= unit.GpuMemory {
+		return nil, nil
+	}
+	return candidate, nil
+}
+
+// The PodDisruptionBudgets covering a pod
+func disruptionBudgetsFor(pod *v1.Pod, pdbs []policyv1beta1.PodDisruptionBudget) []string {
+	var keys []string
+	for i := range pdbs {
+		pdb := &pdbs[i]
+		if pdb.Namespace != pod.Namespace || pdb.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() {
+			continue
+		}
+		if selector.Matches(labels.Set(pod.Labels)) {
+			keys = append(keys, pdb.Namespace+"/"+pdb.Name)
+		}
+	}
+	return keys
+}
+
+// Evict through the eviction API, which the API server refuses if a PodDisruptionBudget would be broken
+func (s *Scheduler) evict(pod *v1.Pod) error {
+	return s.clientset.PolicyV1beta1().Evictions(pod.Namespace).Evict(&policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	})
+}
@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"fmt"
+	"github.com/onsi/gomega"
+	"k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"testing"
+)
+
+func withPriority(pod *v1.Pod, priority int32) *v1.Pod {
+	pod.Spec.Priority = &priority
+	pod.Labels = map[string]string{"app": pod.Name}
+	return pod
+}
+
+func evicted(s *Scheduler) []string {
+	var names []string
+	for _, action := range s.clientset.(*fake.Clientset).Actions() {
+		if action.GetSubresource() == "eviction" {
+			names = append(names, action.(k8stesting.CreateAction).GetObject().(*policyv1beta1.Eviction).Name)
+		}
+	}
+	return names
+}
+
+func TestPreemptEvictsFewestLowerPriorityPods(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	pending := withPriority(modelPod("critical", "critical", "1Gi", ""), 1000)
+	pods := []runtime.Object{
+		pending,
+		withPriority(modelPod("large", "large", "1Gi", "gpu"), 0),
+		withPriority(modelPod("small", "small", "512Mi", "gpu"), 0),
+		withPriority(modelPod("tiny", "tiny", "512Mi", "gpu"), 0),
+		withPriority(modelPod("important", "important", "1Gi", "gpu"), 2000),
+	}
+	nodes := []*v1.Node{gpuNode("gpu", "3758096384")}
+
+	s := testScheduler(nodes, pods...)
+	_, err := s.findFit(pending)
+	s.preempt(pending, err.(*FitError))
+	g.Expect(evicted(s)).Should(gomega.Equal([]string{"large"}))
+	pod, err := s.clientset.CoreV1().Pods("default").Get("critical", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(pod.Status.NominatedNodeName).Should(gomega.Equal("gpu"))
+
+	// A PodDisruptionBudget allowing no disruptions keeps the large pod, both smaller ones go instead
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "large", Namespace: "default"},
+		Spec:       policyv1beta1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "large"}}},
+	}
+	s = testScheduler(nodes, append(pods, pdb)...)
+	_, err = s.findFit(pending)
+	s.preempt(pending, err.(*FitError))
+	g.Expect(evicted(s)).Should(gomega.ConsistOf("small", "tiny"))
+
+	// Pods of higher priority are never preempted
+	lowly := withPriority(modelPod("lowly", "lowly", "1Gi", ""), -10)
+	s = testScheduler(nodes, append(pods, lowly)...)
+	_, err = s.findFit(lowly)
+	s.preempt(lowly, err.(*FitError))
+	g.Expect(evicted(s)).Should(gomega.BeEmpty())
+}
+
+func TestPreemptOnlyForGpuMemory(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	pending := withPriority(modelPod("resnet-1", "resnet", "1Gi", ""), 1000)
+	s := testScheduler([]*v1.Node{gpuNode("gpu", "17071734784")},
+		pending, withPriority(modelPod("resnet-0", "resnet", "1Gi", "gpu"), 0))
+
+	_, err := s.findFit(pending)
+	fitErr := err.(*FitError)
+	g.Expect(fitErr.FailedNodes["gpu"].Resolvable).Should(gomega.BeFalse())
+	s.preempt(pending, fitErr)
+	g.Expect(evicted(s)).Should(gomega.BeEmpty())
+	pod, err := s.clientset.CoreV1().Pods("default").Get("resnet-1", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(pod.Status.NominatedNodeName).Should(gomega.BeEmpty())
+}
+
+func TestPreemptClearsNominationWhenEvictionFails(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	pending := withPriority(modelPod("critical", "critical", "1Gi", ""), 1000)
+	s := testScheduler([]*v1.Node{gpuNode("gpu", "1610612736")},
+		pending, withPriority(modelPod("large", "large", "1Gi", "gpu"), 0))
+	s.clientset.(*fake.Clientset).PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return action.GetSubresource() == "eviction", nil, fmt.Errorf("too many requests")
+	})
+
+	_, err := s.findFit(pending)
+	s.preempt(pending, err.(*FitError))
+	pod, err := s.clientset.CoreV1().Pods("default").Get("critical", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(pod.Status.NominatedNodeName).Should(gomega.BeEmpty())
+}
+
+func TestNominatedPodsKeepTheirRoom(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	// Each node has room for one 1Gi pod
+	nodes := []*v1.Node{gpuNode("gpu-a", "1610612736"), gpuNode("gpu-b", "1610612736")}
+	nominated := withPriority(modelPod("nominated", "nominated", "1Gi", ""), 1000)
+	nominated.Status.NominatedNodeName = "gpu-a"
+	lowly := withPriority(modelPod("lowly", "lowly", "1Gi", ""), 0)
+	urgent := withPriority(modelPod("urgent", "urgent", "1Gi", ""), 2000)
+	s := testScheduler(nodes, nominated, lowly, urgent)
+
+	// The nominated pod goes to its node, lower priority pods keep off it and higher priority ones may use it
+	for i := 0; i < 5; i++ {
+		node, err := s.findFit(nominated)
+		g.Expect(err).Should(gomega.BeNil())
+		g.Expect(node).Should(gomega.Equal("gpu-a"))
+		node, err = s.findFit(lowly)
+		g.Expect(err).Should(gomega.BeNil())
+		g.Expect(node).Should(gomega.Equal("gpu-b"))
+	}
+	s.nodeLister = testScheduler(nodes[:1]).nodeLister
+	_, err := s.findFit(lowly)
+	g.Expect(err).ShouldNot(gomega.BeNil())
+	node, err := s.findFit(urgent)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(node).Should(gomega.Equal("gpu-a"))
+
+	// A pod bound to another node than it was nominated to gives up the nomination
+	s = testScheduler(nodes, nominated, withPriority(modelPod("hog", "hog", "1Gi", "gpu-a"), 5000))
+	s.podQueue = make(chan *PodJob, 1)
+	s.podQueue <- &PodJob{Pod: nominated}
+	s.ScheduleOne()
+	g.Expect(bindings(s)).Should(gomega.Equal([]string{"gpu-b"}))
+	pod, err := s.clientset.CoreV1().Pods("default").Get("nominated", metav1.GetOptions{})
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(pod.Status.NominatedNodeName).Should(gomega.BeEmpty())
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"fmt"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sort"
+	"strings"
+)
+
+// Why a predicate rejected a node. Reason is short and shared by every node failing the same way so
+// reasons can be counted across nodes, Message has the details for this node. Resolvable is set when
+// removing pods from the node could make the pod fit, so preemption is worth trying on it.
+type FilterStatus struct {
+	Reason     string
+	Message    string
+	Resolvable bool
+}
+
+func gpuMemory(bytes int64) *resource.Quantity {
+	return resource.NewQuantity(bytes, resource.BinarySI)
+}
+
+func insufficientGpuMemory(requested int64, available int64) *FilterStatus {
+	return &FilterStatus{
+		Reason:     "insufficient trtis-gpu-mem",
+		Message:    fmt.Sprintf("requested %s of GPU memory, available %s", gpuMemory(requested), gpuMemory(available)),
+		Resolvable: true,
+	}
+}
+
+// Not resolvable, a pod only preempts others for GPU memory and not to replace a copy of its model
+func modelAlreadyPresent(modelId string) *FilterStatus {
+	return &FilterStatus{
+		Reason:  fmt.Sprintf("model %s already present", modelId),
+		Message: fmt.Sprintf("model %s is already loaded on the node", modelId),
+	}
+}
+
+func missingNodeAnnotation(annotation string) *FilterStatus {
+	return &FilterStatus{
+		Reason:  fmt.Sprintf("missing %s annotation", annotation),
+		Message: fmt.Sprintf("node has no %s annotation, is the TRTIS monitor running on it?", annotation),
+	}
+}
+
+func internalError(action string, err error) *FilterStatus {
+	return &FilterStatus{
+		Reason:  "internal error",
+		Message: fmt.Sprintf("failed to %s: %v", action, err),
+	}
+}
+
+func parseError(what string, err error) *FilterStatus {
+	return &FilterStatus{
+		Reason:  fmt.Sprintf("invalid %s", what),
+		Message: err.Error(),
+	}
+}
+
+// No node passed the predicates for a pod
+type FitError struct {
+	Pod         *v1.Pod
+	NumNodes    int
+	FailedNodes map[string]*FilterStatus
+}
+
+// Counts the nodes failing for each reason, most common first, e.g.
+// "0/5 nodes available: 3 insufficient trtis-gpu-mem, 2 model resnet already present"
+func (f *FitError) Error() string {
+	counts := make(map[string]int)
+	for _, status := range f.FailedNodes {
+		counts[status.Reason]++
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	message := fmt.Sprintf("0/%d nodes available", f.NumNodes)
+	if len(reasons) == 0 {
+		return message
+	}
+	for i, reason := range reasons {
+		reasons[i] = fmt.Sprintf("%d %s", counts[reason], reason)
+	}
+	return message + ": " + strings.Join(reasons, ", ")
+}